@@ -1,23 +1,56 @@
 package cli
 
 import (
+	"context"
 	"fmt"
-	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/StardustOS/duster/debugger"
 	"github.com/c-bata/go-prompt"
 )
 
 type Debugger interface {
-	Continue(uint32) error
-	SetBreakpoint(string, int, uint32) error
+	Continue(context.Context, uint32) (debugger.StopEvent, error)
+	Interrupt(uint32) (debugger.StopEvent, error)
+	BreakAt(string, string, uint32) (int, string, error)
+	HardwareBreakAt(string, string, uint32) (int, string, error)
+	TemporaryBreakAt(string, string, uint32) (int, string, error)
+	Until(context.Context, string, uint32) (debugger.StopEvent, error)
+	DprintfAt(string, string, []string, uint32) (int, string, error)
+	SetCommands(int, []string) error
+	HitCommands() []string
+	Functions() []string
+	DeleteBreakpoint(int, uint32) error
+	EnableBreakpoint(int, uint32) error
+	DisableBreakpoint(int, uint32) error
+	IgnoreBreakpoint(int, int) error
+	Watch(string, uint32) (int, error)
+	ReadWatch(string, uint32) (int, error)
+	AccessWatch(string, uint32) (int, error)
+	SoftwareWatch(string, uint32) (int, error)
 	RemoveBreakpoint(string, int, uint32) error
-	Step(uint32) error
+	Step(context.Context, uint32) (debugger.StopEvent, error)
+	StepInstructions(context.Context, uint32, int, bool) (debugger.StopEvent, error)
+	CurrentInstruction(uint32) (string, error)
+	Disassemble(uint32, string, bool) (string, error)
+	Next(context.Context, uint32) error
+	Finish(context.Context, uint32) (debugger.StopEvent, string, error)
+	Backtrace(uint32) (string, error)
+	Up(uint32, int) (string, error)
+	Down(uint32, int) (string, error)
+	SelectFrame(uint32, int) (string, error)
+	CurrentFrame(uint32) (string, error)
 	GetLineInformation() string
-	GetVariable(string) (string, error)
+	Print(uint32, string, debugger.Format) (string, error)
+	SetOutputRadix(int) error
+	Value(uint32, string) (*debugger.Value, error)
 	Dereference(uint32, string) (string, error)
 	ListBreakpoints() string
+	Breakpoints() []debugger.Breakpoint
+	Detach(uint32) error
 }
 
 type CLI struct {
@@ -25,23 +58,129 @@ type CLI struct {
 	dbg         Debugger
 	suggestions []prompt.Suggest
 	previous string 
+	//lastBreakpoint is the number of the last breakpoint set
+	lastBreakpoint int
+	//recording is the number of the breakpoint whose commands are being
+	//typed in (0 when they aren't) and recorded holds the commands so far
+	recording int
+	recorded  []string
+	//cancel interrupts the command running the VM (nil if there isn't one)
+	//and terminated is set if Duster was told to exit while it was running
+	mutex      sync.Mutex
+	cancel     context.CancelFunc
+	terminated bool
+	//release hands the domain back to the hypervisor once the debugger
+	//has detached from it (letting it run if resume is set)
+	release  func(resume bool) error
+	detached sync.Once
+	//session is the file the breakpoints are saved to when Duster exits
+	session string
 }
 
-func (cli *CLI) Init(debugger Debugger) {
+//printing are the commands which print a value (and may be given a format)
+var printing = map[string]bool{"print": true, "p": true, "read": true}
+
+//resuming are the commands which run the VM. The rest of the commands of
+//a breakpoint are skipped once one of them has been run.
+var resuming = map[string]bool{"continue": true, "step": true, "next": true, "finish": true, "until": true, "advance": true,
+	"stepi": true, "si": true, "nexti": true, "ni": true}
+
+func (cli *CLI) Init(dbg Debugger) {
 	cli.prompt = ">"
 	cli.suggestions = []prompt.Suggest{
-		prompt.Suggest{Text: "break", Description: "Sets a break point at in a file (argument in the form of file.c:<line no>"},
+		prompt.Suggest{Text: "break", Description: "Sets a break point (argument in the form of file.c:<line no>, a function or *address, optionally followed by if <condition>)"},
+		prompt.Suggest{Text: "hbreak", Description: "Sets a hardware break point using the debug registers (same arguments as break, at most 4 addresses)"},
+		prompt.Suggest{Text: "tbreak", Description: "Sets a temporary break point which is deleted the first time it is hit (same arguments as break)"},
+		prompt.Suggest{Text: "until", Description: "Continues until a location (file.c:<line no>, a function or *address) is reached or the current function returns"},
+		prompt.Suggest{Text: "advance", Description: "The same as until"},
+		prompt.Suggest{Text: "dprintf", Description: "Prints variables each time a location is reached without stopping (dprintf file.c:<line no> \"format\", variables...)"},
+		prompt.Suggest{Text: "commands", Description: "Sets commands to run when a breakpoint is hit (commands [number], ending with a line saying end)"},
+		prompt.Suggest{Text: "watch", Description: "Stops when the value of an expression (such as a variable or p->next) changes (watch -s <expression> single steps instead of using the debug registers)"},
+		prompt.Suggest{Text: "rwatch", Description: "Stops when the value of an expression is read"},
+		prompt.Suggest{Text: "awatch", Description: "Stops when the value of an expression is read or written"},
 		prompt.Suggest{Text: "step", Description: "Steps forward one line (note a breakpoint must be set before hand)"},
-		prompt.Suggest{Text: "continue", Description: "Continue to the next breakpoint"},
-		prompt.Suggest{Text: "quit", Description: "Exit the debugger"},
-		prompt.Suggest{Text: "read", Description: "Read a variable"},
+		prompt.Suggest{Text: "next", Description: "Steps forward one line without going into functions that are called"},
+		prompt.Suggest{Text: "stepi", Description: "Runs one machine instruction, or n with stepi n (alias si)"},
+		prompt.Suggest{Text: "disassemble", Description: "Prints the instructions of a function or range of addresses (disassemble [function|start,end] [/s], /s shows the source lines)"},
+		prompt.Suggest{Text: "nexti", Description: "Runs one machine instruction without going into functions that are called, or n with nexti n (alias ni)"},
+		prompt.Suggest{Text: "continue", Description: "Continue to the next breakpoint (continue --for <duration> pauses the VM again after a time such as 5s), Ctrl-C interrupts it"},
+		prompt.Suggest{Text: "interrupt", Description: "Pauses the VM if it is running"},
+		prompt.Suggest{Text: "finish", Description: "Runs until the current function returns and prints the value returned"},
+		prompt.Suggest{Text: "backtrace", Description: "Prints the functions on the call stack (alias bt)"},
+		prompt.Suggest{Text: "up", Description: "Selects the frame of the caller (optionally n frames up)"},
+		prompt.Suggest{Text: "down", Description: "Selects the frame of the function called (optionally n frames down)"},
+		prompt.Suggest{Text: "frame", Description: "Prints the selected frame or selects frame n of the backtrace"},
+		prompt.Suggest{Text: "quit", Description: "Removes the breakpoints and exits the debugger leaving the domain paused (quit --resume lets it run)"},
+		prompt.Suggest{Text: "detach", Description: "Removes the breakpoints and exits the debugger letting the domain run"},
+		prompt.Suggest{Text: "print", Description: "Prints the value of a C expression such as p->next->val, arr[i] * 2 or (struct foo *)0x1234 (alias p), print/x prints it in hex (or /o /t /d /c /s /f), print --json <expression> prints it as JSON"},
+		prompt.Suggest{Text: "set", Description: "Changes a setting (set output-radix <8, 10 or 16> sets the base integers are printed in)"},
+		prompt.Suggest{Text: "read", Description: "The same as print"},
 		prompt.Suggest{Text: "der", Description: "Deference a variable"},
-		prompt.Suggest{Text: "remove", Description: "Remove breakpoint"},
+		prompt.Suggest{Text: "remove", Description: "Remove breakpoint (argument in the form of file.c:<line no>)"},
+		prompt.Suggest{Text: "delete", Description: "Deletes the breakpoint with the number given"},
+		prompt.Suggest{Text: "disable", Description: "Disables the breakpoint with the number given without deleting it"},
+		prompt.Suggest{Text: "enable", Description: "Enables the breakpoint with the number given"},
+		prompt.Suggest{Text: "ignore", Description: "Ignores the next count hits of a breakpoint (ignore <number> <count>)"},
+		prompt.Suggest{Text: "save", Description: "Saves the commands which set the breakpoints again to a file (save breakpoints <file>)"},
+		prompt.Suggest{Text: "source", Description: "Runs the commands in a file (such as one written by save breakpoints)"},
+	}
+	cli.dbg = dbg
+	cli.handleSignals()
+}
+
+//showStop - prints why the VM stopped followed by the line it stopped
+//at (a step finishing on a new line only needs the line)
+func (cli *CLI) showStop(event debugger.StopEvent) {
+	if event.Reason != debugger.StepComplete {
+		fmt.Println(event)
+	}
+	if !event.Exited() {
+		fmt.Println(cli.dbg.GetLineInformation())
+	}
+}
+
+//interruptible - returns a context which is cancelled when Ctrl-C is pressed
+//(or times out after the timeout if it isn't 0) so a command running the VM
+//can be stopped. The function returned must be called once it has finished.
+func (cli *CLI) interruptible(timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	}
+
+	cli.mutex.Lock()
+	cli.cancel = cancel
+	cli.mutex.Unlock()
+	return ctx, func() {
+		cli.mutex.Lock()
+		cli.cancel = nil
+		cli.mutex.Unlock()
+		cancel()
+	}
+}
+
+//interrupted - checks whether a command stopped early because Ctrl-C was
+//pressed and if so says where the VM was stopped
+func (cli *CLI) interrupted(err error) bool {
+	if err != context.Canceled {
+		return false
 	}
-	cli.dbg = debugger
+	fmt.Println("Interrupted")
+	fmt.Println(cli.dbg.GetLineInformation())
+	return true
 }
 
 func (cli *CLI) completer(d prompt.Document) []prompt.Suggest {
+	//The location of a breakpoint can be the name of a function
+	text := d.TextBeforeCursor()
+	if strings.HasPrefix(text, "break ") || strings.HasPrefix(text, "hbreak ") || strings.HasPrefix(text, "tbreak ") ||
+		strings.HasPrefix(text, "until ") || strings.HasPrefix(text, "advance ") {
+		var functions []prompt.Suggest
+		for _, name := range cli.dbg.Functions() {
+			functions = append(functions, prompt.Suggest{Text: name, Description: "function"})
+		}
+		return prompt.FilterHasPrefix(functions, d.GetWordBeforeCursor(), false)
+	}
 	return prompt.FilterHasPrefix(cli.suggestions, d.GetWordBeforeCursor(), true)
 }
 
@@ -51,7 +190,96 @@ func (cli *CLI) ReadInput() string {
 }
 
 func (cli *CLI) ProcessInput(input string) {
+	defer cli.recoverPanic()
 	input = strings.TrimSpace(input)
+	if cli.recording != 0 {
+		cli.record(input)
+		return
+	}
+	cli.execute(input)
+	cli.runHitCommands()
+	if cli.wasTerminated() {
+		cli.exit(false, 1)
+	}
+}
+
+//runHitCommands - runs the commands of the breakpoint that stopped the VM.
+//A command may run the VM again (e.g. continue) so this carries on until
+//the VM stops somewhere without any commands.
+func (cli *CLI) runHitCommands() {
+	for commands := cli.dbg.HitCommands(); len(commands) > 0; commands = cli.dbg.HitCommands() {
+		for _, command := range commands {
+			cli.execute(command)
+			if resuming[strings.Split(command, " ")[0]] {
+				break
+			}
+		}
+	}
+}
+
+//record - adds a line to the commands being typed in for a breakpoint
+//until a line saying end is reached
+func (cli *CLI) record(input string) {
+	if input != "end" {
+		if len(input) > 0 {
+			cli.recorded = append(cli.recorded, input)
+		}
+		return
+	}
+
+	err := cli.dbg.SetCommands(cli.recording, cli.recorded)
+	cli.recording = 0
+	cli.recorded = nil
+	cli.prompt = ">"
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+//parseDprintf - splits the arguments of dprintf into the format (a C string
+//in double quotes) and the names of the variables printed
+func parseDprintf(arguments string) (string, []string, error) {
+	arguments = strings.TrimSpace(arguments)
+	if !strings.HasPrefix(arguments, "\"") {
+		return "", nil, fmt.Errorf("Error: the format of dprintf must be in double quotes")
+	}
+
+	end := 1
+	for ; end < len(arguments) && arguments[end] != '"'; end++ {
+		if arguments[end] == '\\' {
+			end++
+		}
+	}
+	if end >= len(arguments) {
+		return "", nil, fmt.Errorf("Error: the format of dprintf is missing its closing quote")
+	}
+	format, err := strconv.Unquote(arguments[:end+1])
+	if err != nil {
+		return "", nil, fmt.Errorf("Error: %s is not a valid format", arguments[:end+1])
+	}
+
+	rest := strings.TrimSpace(arguments[end+1:])
+	if len(rest) == 0 {
+		return format, nil, nil
+	}
+	if !strings.HasPrefix(rest, ",") {
+		return "", nil, fmt.Errorf("Error: the variables printed by dprintf must be separated by commas")
+	}
+	var variables []string
+	for _, variable := range strings.Split(rest[1:], ",") {
+		variable = strings.TrimSpace(variable)
+		if len(variable) == 0 {
+			return "", nil, fmt.Errorf("Error: the variables printed by dprintf must be separated by commas")
+		}
+		variables = append(variables, variable)
+	}
+	return format, variables, nil
+}
+
+//execute - runs a single command
+func (cli *CLI) execute(input string) {
+	//$bpnum is the number of the last breakpoint set (saved sessions use it)
+	input = strings.Replace(input, "$bpnum", strconv.Itoa(cli.lastBreakpoint), -1)
 	values := strings.Split(input, " ")
 	var cmd string
 	if len(input) == 0 {
@@ -59,63 +287,293 @@ func (cli *CLI) ProcessInput(input string) {
 	} else {
 		cmd = values[0]
 	}
+	//The format of print can follow it (e.g. print/x)
+	format := ""
+	if slash := strings.Index(cmd, "/"); slash > 0 && printing[cmd[:slash]] {
+		cmd, format = cmd[:slash], cmd[slash+1:]
+	}
 
 	switch cmd {
 	default:
 		fmt.Printf("Error: %s is not a recognised command\n", values[0])
 		return
-	case "break":
+	case "break", "hbreak", "tbreak":
 		if len(values) == 1 {
 			list := cli.dbg.ListBreakpoints()
 			fmt.Println(list)
 			return
 		}
-		if len(values) < 2 {
-			fmt.Println("Error: too few arguments for break (expected argument in the form file.c:<line no>)")
-			return
-		} else if len(values) > 2 {
-			fmt.Println("Error: too many arguments for break (expected argument in the form file.c:<line no>)")
+		//Anything after "if" is the condition of the breakpoint
+		var condition string
+		if len(values) > 3 && values[2] == "if" {
+			condition = strings.Join(values[3:], " ")
+			values = values[:2]
+		}
+		if len(values) > 2 {
+			fmt.Printf("Error: too many arguments for %s (expected file.c:<line no>, a function or *address optionally followed by if <condition>)\n", cmd)
 			return
 		}
 
-		args := strings.Split(values[1], ":")
-		if len(args) != 2 {
-			fmt.Println("Error: argument in the wrong format (expected file.c:<line no>)")
+		breakAt := cli.dbg.BreakAt
+		kind := "Break point"
+		if cmd == "hbreak" {
+			breakAt = cli.dbg.HardwareBreakAt
+			kind = "Hardware break point"
+		} else if cmd == "tbreak" {
+			breakAt = cli.dbg.TemporaryBreakAt
+			kind = "Temporary break point"
+		}
+		id, place, err := breakAt(values[1], condition, 0)
+		if err == nil {
+			cli.lastBreakpoint = id
+			fmt.Printf("%s %d set @ %s\n", kind, id, place)
+		} else {
+			fmt.Println(err)
+		}
+	case "dprintf":
+		if len(values) < 3 {
+			fmt.Println("Error: dprintf must be passed a location and a format (dprintf file.c:<line no> \"format\", variables...)")
 			return
 		}
-		lineNo, err := strconv.Atoi(args[1])
+		format, variables, err := parseDprintf(strings.Join(values[2:], " "))
 		if err != nil {
-			fmt.Printf("Error: %s is not an integer and cannot be used as a line number\n", args[1])
+			fmt.Println(err)
 			return
 		}
-		err = cli.dbg.SetBreakpoint(args[0], lineNo, 0)
-		if err == nil {
-			fmt.Printf("Break point set @ %s:%d\n", args[0], lineNo)
-		} else {
+		id, place, err := cli.dbg.DprintfAt(strings.TrimSuffix(values[1], ","), format, variables, 0)
+		if err != nil {
 			fmt.Println(err)
+			return
 		}
+		cli.lastBreakpoint = id
+		fmt.Printf("Dprintf %d set @ %s\n", id, place)
+	case "commands":
+		id := cli.lastBreakpoint
+		if len(values) > 2 {
+			fmt.Println("Error: too many arguments for commands. Expected a single breakpoint number.")
+			return
+		} else if len(values) == 2 {
+			var err error
+			id, err = strconv.Atoi(values[1])
+			if err != nil {
+				fmt.Printf("Error: %s is not an integer and cannot be used as a breakpoint number\n", values[1])
+				return
+			}
+		}
+		if id == 0 {
+			fmt.Println("Error: no breakpoint number was given and no breakpoints have been set")
+			return
+		}
+		cli.recording = id
+		cli.prompt = ">>"
+		fmt.Printf("Type commands for when breakpoint %d is hit, one per line.\nEnd with a line saying just \"end\".\n", id)
 	case "step":
-		err := cli.dbg.Step(0)
+		ctx, stop := cli.interruptible(0)
+		event, err := cli.dbg.Step(ctx, 0)
+		stop()
 		if err != nil {
 			fmt.Println(err)
+			fmt.Println(cli.dbg.GetLineInformation())
+			return
+		}
+		cli.showStop(event)
+	case "stepi", "si", "nexti", "ni":
+		count := 1
+		if len(values) > 2 {
+			fmt.Printf("Error: too many arguments for %s. Expected the number of instructions to run.\n", cmd)
+			return
+		} else if len(values) == 2 {
+			var err error
+			count, err = strconv.Atoi(values[1])
+			if err != nil {
+				fmt.Printf("Error: %s is not an integer and cannot be used as a number of instructions\n", values[1])
+				return
+			}
+		}
+
+		ctx, stop := cli.interruptible(0)
+		event, err := cli.dbg.StepInstructions(ctx, 0, count, cmd == "nexti" || cmd == "ni")
+		stop()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		cli.showStop(event)
+		if event.Exited() {
+			return
+		}
+		instruction, err := cli.dbg.CurrentInstruction(0)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println(instruction)
+	case "disassemble":
+		//The /s modifier can go before or after what to disassemble
+		source := false
+		var spec []string
+		for _, value := range values[1:] {
+			if value == "/s" {
+				source = true
+			} else {
+				spec = append(spec, value)
+			}
+		}
+		listing, err := cli.dbg.Disassemble(0, strings.Join(spec, " "), source)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println(listing)
+	case "next":
+		ctx, stop := cli.interruptible(0)
+		err := cli.dbg.Next(ctx, 0)
+		stop()
+		if cli.interrupted(err) {
+			return
+		} else if err != nil {
+			fmt.Println(err)
 		}
 		fmt.Println(cli.dbg.GetLineInformation())
-	case "read":
-		if len(values) < 2 {
-			fmt.Println("Error: not enough arguments for read. Must supply variable name.")
+	case "finish":
+		ctx, stop := cli.interruptible(0)
+		event, val, err := cli.dbg.Finish(ctx, 0)
+		stop()
+		if cli.interrupted(err) {
 			return
-		} else if len(values) > 2 {
-			fmt.Println("Error: too many arguments for read. Must supply single variable name.")
+		} else if err != nil {
+			fmt.Println(err)
 			return
 		}
+		if event.Reason == debugger.BreakpointHit {
+			fmt.Printf("Run till exit interrupted by breakpoint %d\n", event.Breakpoint)
+		} else if event.Reason != debugger.LocationReached {
+			fmt.Println(event)
+		}
+		fmt.Println(cli.dbg.GetLineInformation())
+		if len(val) > 0 {
+			fmt.Println(val)
+		}
+	case "backtrace", "bt":
+		trace, err := cli.dbg.Backtrace(0)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println(trace)
+	case "up", "down":
+		count := 1
+		if len(values) > 2 {
+			fmt.Printf("Error: too many arguments for %s. Expected the number of frames to move.\n", cmd)
+			return
+		} else if len(values) == 2 {
+			var err error
+			count, err = strconv.Atoi(values[1])
+			if err != nil {
+				fmt.Printf("Error: %s is not an integer and cannot be used as a number of frames\n", values[1])
+				return
+			}
+		}
 
-		val, err := cli.dbg.GetVariable(values[1])
+		var frame string
+		var err error
+		if cmd == "up" {
+			frame, err = cli.dbg.Up(0, count)
+		} else {
+			frame, err = cli.dbg.Down(0, count)
+		}
 		if err != nil {
 			fmt.Println(err)
+			return
+		}
+		fmt.Println(frame)
+	case "frame":
+		if len(values) > 2 {
+			fmt.Println("Error: too many arguments for frame. Expected a single frame number.")
+			return
+		}
+
+		var frame string
+		var err error
+		if len(values) == 1 {
+			frame, err = cli.dbg.CurrentFrame(0)
 		} else {
-			fmt.Println(val)
+			level, convErr := strconv.Atoi(values[1])
+			if convErr != nil {
+				fmt.Printf("Error: %s is not an integer and cannot be used as a frame number\n", values[1])
+				return
+			}
+			frame, err = cli.dbg.SelectFrame(0, level)
+		}
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println(frame)
+	case "print", "p", "read":
+		//The format can also be given on its own (print /x expression)
+		if format == "" && len(values) > 1 && strings.HasPrefix(values[1], "/") {
+			format = values[1][1:]
+			values = values[1:]
+		}
+		//--json prints the whole value as JSON for tools
+		json := len(values) > 1 && values[1] == "--json"
+		if json {
+			values = values[1:]
+		}
+		//The expression may contain spaces (e.g. print a + b)
+		expression := strings.TrimSpace(strings.Join(values[1:], " "))
+		if len(expression) == 0 {
+			fmt.Printf("Error: not enough arguments for %s. Must supply an expression.\n", cmd)
+			return
+		}
+
+		if json {
+			value, err := cli.dbg.Value(0, expression)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			text, err := value.JSON()
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
+			fmt.Println(text)
+			return
+		}
+		letter := debugger.NaturalFormat
+		if format != "" {
+			var err error
+			letter, err = debugger.ParseFormat(format)
+			if err != nil {
+				fmt.Println(err)
+				return
+			}
 		}
-	
+		val, err := cli.dbg.Print(0, expression, letter)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println(val)
+
+	case "set":
+		if len(values) != 3 || values[1] != "output-radix" {
+			fmt.Println("Error: expected set output-radix <8, 10 or 16>")
+			return
+		}
+		radix, err := strconv.Atoi(values[2])
+		if err == nil {
+			err = cli.dbg.SetOutputRadix(radix)
+		} else {
+			err = fmt.Errorf("Error: %s is not a number", values[2])
+		}
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Printf("Output radix now set to %d\n", radix)
 	case "der":
 		if len(values) < 2 {
 			fmt.Println("Error: not enough arguments for der. Must supply variable name.")
@@ -161,16 +619,158 @@ func (cli *CLI) ProcessInput(input string) {
 		} 
 		fmt.Printf("Removed breakpoint at %s:%d\n", args[0], lineNo)
 		
-	case "quit":
-		fmt.Println("Hasta luego")
-		os.Exit(0)
+	case "delete", "enable", "disable":
+		if len(values) != 2 {
+			fmt.Printf("Error: %s must be passed the number of a breakpoint\n", cmd)
+			return
+		}
+
+		id, err := strconv.Atoi(values[1])
+		if err != nil {
+			fmt.Printf("Error: %s is not an integer and cannot be used as a breakpoint number\n", values[1])
+			return
+		}
+
+		switch cmd {
+		case "delete":
+			err = cli.dbg.DeleteBreakpoint(id, 0)
+		case "enable":
+			err = cli.dbg.EnableBreakpoint(id, 0)
+		case "disable":
+			err = cli.dbg.DisableBreakpoint(id, 0)
+		}
+		if err != nil {
+			fmt.Println(err)
+		}
+	case "ignore":
+		if len(values) != 3 {
+			fmt.Println("Error: ignore must be passed the number of a breakpoint and the number of hits to ignore")
+			return
+		}
+
+		id, err := strconv.Atoi(values[1])
+		if err != nil {
+			fmt.Printf("Error: %s is not an integer and cannot be used as a breakpoint number\n", values[1])
+			return
+		}
+		count, err := strconv.Atoi(values[2])
+		if err != nil {
+			fmt.Printf("Error: %s is not an integer and cannot be used as a number of hits\n", values[2])
+			return
+		}
+
+		err = cli.dbg.IgnoreBreakpoint(id, count)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Printf("Will ignore next %d crossings of breakpoint %d\n", count, id)
+	case "watch", "rwatch", "awatch":
+		if len(values) < 2 || (values[1] == "-s" && len(values) < 3) {
+			fmt.Printf("Error: %s must be passed the expression to watch\n", cmd)
+			return
+		}
+		expression := strings.Join(values[1:], " ")
+
+		var id int
+		var err error
+		var kind string
+		switch cmd {
+		case "watch":
+			if values[1] == "-s" {
+				expression = strings.Join(values[2:], " ")
+				id, err = cli.dbg.SoftwareWatch(expression, 0)
+				kind = "Software watchpoint"
+				break
+			}
+			id, err = cli.dbg.Watch(expression, 0)
+			kind = "Hardware watchpoint"
+		case "rwatch":
+			id, err = cli.dbg.ReadWatch(expression, 0)
+			kind = "Hardware read watchpoint"
+		case "awatch":
+			id, err = cli.dbg.AccessWatch(expression, 0)
+			kind = "Hardware access (read/write) watchpoint"
+		}
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		cli.lastBreakpoint = id
+		fmt.Printf("%s %d: %s\n", kind, id, expression)
+	case "save":
+		if len(values) != 3 || values[1] != "breakpoints" {
+			fmt.Println("Error: expected save breakpoints <file>")
+			return
+		}
+		err := cli.saveBreakpoints(values[2])
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Printf("Saved the breakpoints to %s\n", values[2])
+	case "source":
+		if len(values) != 2 {
+			fmt.Println("Error: source must be passed the file to run the commands of")
+			return
+		}
+		err := cli.source(values[1])
+		if err != nil {
+			fmt.Println(err)
+		}
+	case "quit", "detach":
+		//Detaching lets the domain carry on running whereas quitting
+		//leaves it paused unless --resume is given
+		resume := cmd == "detach"
+		if len(values) == 2 && values[1] == "--resume" {
+			resume = true
+		} else if len(values) > 1 {
+			fmt.Printf("Error: %s only takes --resume\n", cmd)
+			return
+		}
+		cli.exit(resume, 0)
+	case "until", "advance":
+		if len(values) != 2 {
+			fmt.Printf("Error: %s must be passed a location (file.c:<line no>, a function or *address)\n", cmd)
+			return
+		}
+		ctx, stop := cli.interruptible(0)
+		event, err := cli.dbg.Until(ctx, values[1], 0)
+		stop()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		cli.showStop(event)
 	case "continue":
-		err := cli.dbg.Continue(0)
+		var timeout time.Duration
+		if len(values) == 3 && values[1] == "--for" {
+			var err error
+			timeout, err = time.ParseDuration(values[2])
+			if err != nil || timeout <= 0 {
+				fmt.Printf("Error: %s is not a valid length of time (e.g. 5s or 500ms)\n", values[2])
+				return
+			}
+		} else if len(values) != 1 {
+			fmt.Println("Error: continue takes no arguments or --for <duration>")
+			return
+		}
+
+		ctx, stop := cli.interruptible(timeout)
+		event, err := cli.dbg.Continue(ctx, 0)
+		stop()
 		if err != nil {
 			fmt.Println(err)
 			return 
 		}
-		fmt.Println(cli.dbg.GetLineInformation())
+		cli.showStop(event)
+	case "interrupt":
+		event, err := cli.dbg.Interrupt(0)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		cli.showStop(event)
 	}
 	if len(input) > 0 {
 		cli.previous = input
@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"syscall"
+)
+
+//OnDetach sets the function which hands the domain back to the hypervisor
+//(e.g. turning off debugging and unmapping its memory) once the debugger has
+//removed its breakpoints. It must let the domain run if resume is set.
+func (cli *CLI) OnDetach(release func(resume bool) error) {
+	cli.release = release
+}
+
+//detach - removes everything the debugger has changed in the domain and
+//releases it. The domain is only let run if the debugger detached cleanly,
+//as a break instruction left behind would crash it.
+func (cli *CLI) detach(resume bool) {
+	cli.detached.Do(func() {
+		err := cli.dbg.Detach(0)
+		if err != nil {
+			fmt.Println(err)
+			fmt.Println("The domain has been left paused as it may still have breakpoints in it")
+			resume = false
+		}
+		if cli.release == nil {
+			return
+		}
+		err = cli.release(resume)
+		if err != nil {
+			fmt.Println(err)
+		}
+	})
+}
+
+//exit - saves the session, detaches from the domain (letting it run if
+//resume is set) and exits with the code given
+func (cli *CLI) exit(resume bool, code int) {
+	cli.saveSession()
+	cli.detach(resume)
+	if resume {
+		fmt.Println("Detached from the domain, it is now running")
+	} else {
+		fmt.Println("Detached from the domain, it has been left paused")
+	}
+	fmt.Println("Hasta luego")
+	os.Exit(code)
+}
+
+//handleSignals - Ctrl-C (SIGINT) interrupts the command running the VM, if
+//there is one, otherwise it and SIGTERM detach from the domain and exit.
+//The prompt reads Ctrl-C itself so it is only sent while a command runs.
+func (cli *CLI) handleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for received := range signals {
+			cli.mutex.Lock()
+			cancel := cli.cancel
+			if cancel != nil && received != os.Interrupt {
+				//The command has to stop the VM before we detach
+				cli.terminated = true
+			}
+			cli.mutex.Unlock()
+
+			if cancel != nil {
+				cancel()
+				continue
+			}
+			fmt.Printf("\nReceived %s\n", received)
+			cli.exit(false, 1)
+		}
+	}()
+}
+
+//wasTerminated - checks whether Duster was told to exit while a command
+//was running the VM
+func (cli *CLI) wasTerminated() bool {
+	cli.mutex.Lock()
+	defer cli.mutex.Unlock()
+	return cli.terminated
+}
+
+//recoverPanic - detaches from the domain if a command panics so it isn't
+//left full of breakpoints (must be deferred)
+func (cli *CLI) recoverPanic() {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	fmt.Printf("Error: Duster crashed (%v)\n%s", recovered, debug.Stack())
+	cli.exit(false, 2)
+}
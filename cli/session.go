@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/StardustOS/duster/debugger"
+)
+
+//creating are the commands which set a breakpoint or watchpoint. The lines
+//of a saved session after one of them refer to it using $bpnum.
+var creating = map[string]bool{"break": true, "hbreak": true, "tbreak": true, "dprintf": true, "watch": true, "rwatch": true, "awatch": true}
+
+//UseSession restores the breakpoints saved in a session file (if it exists)
+//and saves them back to it when the debugger exits, so the same breakpoints
+//are set each time an image is debugged
+func (cli *CLI) UseSession(filename string) {
+	cli.session = filename
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return
+	}
+	fmt.Printf("Restoring the breakpoints saved in %s\n", filename)
+	err := cli.source(filename)
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+//saveSession - saves the breakpoints to the session file (if there is one)
+func (cli *CLI) saveSession() {
+	if cli.session == "" {
+		return
+	}
+	err := os.MkdirAll(filepath.Dir(cli.session), 0755)
+	if err == nil {
+		err = cli.saveBreakpoints(cli.session)
+	}
+	if err != nil {
+		fmt.Printf("Error: could not save the session to %s (%s)\n", cli.session, err)
+	}
+}
+
+//saveBreakpoints - writes the commands which set each breakpoint and
+//watchpoint again to a file (which can be run with source). Breakpoints are
+//saved by their place in the source rather than their address so they
+//still work after the program has been recompiled.
+func (cli *CLI) saveBreakpoints(filename string) error {
+	var script strings.Builder
+	for _, breakpoint := range cli.dbg.Breakpoints() {
+		for _, line := range breakpointScript(breakpoint) {
+			script.WriteString(line + "\n")
+		}
+	}
+	return ioutil.WriteFile(filename, []byte(script.String()), 0644)
+}
+
+//breakpointScript - returns the commands which set the breakpoint again
+func breakpointScript(breakpoint debugger.Breakpoint) []string {
+	place := fmt.Sprintf("%s:%d", breakpoint.Filename, breakpoint.Line)
+	if breakpoint.Filename == "" && len(breakpoint.Addresses) > 0 {
+		//Code without line information can only be found by its address
+		place = fmt.Sprintf("*0x%x", breakpoint.Addresses[0])
+	}
+
+	var create string
+	switch {
+	case breakpoint.Watch != debugger.NoWatch && !breakpoint.Hardware:
+		create = "watch -s " + breakpoint.Expression
+	case breakpoint.Watch == debugger.WatchWrite:
+		create = "watch " + breakpoint.Expression
+	case breakpoint.Watch == debugger.WatchRead:
+		create = "rwatch " + breakpoint.Expression
+	case breakpoint.Watch == debugger.WatchAccess:
+		create = "awatch " + breakpoint.Expression
+	case breakpoint.Format != "":
+		format := append([]string{strconv.Quote(breakpoint.Format)}, breakpoint.Args...)
+		create = fmt.Sprintf("dprintf %s %s", place, strings.Join(format, ", "))
+	default:
+		create = "break " + place
+		if breakpoint.Hardware {
+			create = "hbreak " + place
+		} else if breakpoint.Temporary {
+			create = "tbreak " + place
+		}
+		if breakpoint.Condition != "" {
+			create += " if " + breakpoint.Condition
+		}
+	}
+
+	lines := []string{create}
+	if !breakpoint.Enabled {
+		lines = append(lines, "disable $bpnum")
+	}
+	if breakpoint.Ignore > 0 {
+		lines = append(lines, fmt.Sprintf("ignore $bpnum %d", breakpoint.Ignore))
+	}
+	if len(breakpoint.Commands) > 0 {
+		lines = append(lines, "commands")
+		lines = append(lines, breakpoint.Commands...)
+		lines = append(lines, "end")
+	}
+	return lines
+}
+
+//source - runs the commands in a file as if they had been typed in (empty
+//lines and lines starting with # are skipped). If a breakpoint cannot be set
+//(e.g. its line no longer has any code) the lines that go with it are skipped.
+func (cli *CLI) source(filename string) error {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("Error: could not read %s (%s)", filename, err)
+	}
+
+	//skipping is set after a breakpoint could not be set and inBlock
+	//while skipping the commands of that breakpoint
+	skipping, inBlock := false, false
+	for number, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if cli.recording != 0 {
+			cli.ProcessInput(line)
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		command := strings.Split(line, " ")[0]
+		//break on its own lists the breakpoints rather than setting one
+		creates := creating[command] && len(strings.Fields(line)) > 1
+		if inBlock {
+			inBlock = line != "end"
+			continue
+		}
+		if skipping && !creates {
+			inBlock = command == "commands"
+			continue
+		}
+		skipping = false
+
+		previous := cli.lastBreakpoint
+		cli.ProcessInput(line)
+		if creates && cli.lastBreakpoint == previous {
+			fmt.Printf("%s:%d: skipped %s\n", filename, number+1, line)
+			skipping = true
+		}
+	}
+
+	if cli.recording != 0 {
+		//The file ended before the end of a list of commands
+		cli.record("end")
+	}
+	return nil
+}
@@ -2,6 +2,9 @@ package debugger
 
 import (
 	"fmt"
+	"sort"
+
+	"github.com/go-delve/delve/pkg/dwarf/op"
 )
 
 type errorType int
@@ -10,10 +13,13 @@ const (
 	breakInt byte      = 0xCC
 	NotFound errorType = iota
 	AlreadyBreakpointSet
+	UnknownID
+	NoDebugRegisters
 )
 
 type BreakPointError struct {
 	Address uint64
+	ID      int
 	errType errorType
 }
 
@@ -23,14 +29,137 @@ func (e BreakPointError) Error() string {
 		return fmt.Sprintf("Error: no breakpoint at %d", e.Address)
 	case AlreadyBreakpointSet:
 		return fmt.Sprintf("Error: breakpoint already at %d", e.Address)
-		
+	case UnknownID:
+		return fmt.Sprintf("Error: no breakpoint number %d", e.ID)
+	case NoDebugRegisters:
+		return fmt.Sprintf("Error: not enough hardware debug registers for a breakpoint at %d (only %d addresses can be watched at once)", e.Address, debugSlots)
 	}
 	return ""
 }
 
+//Breakpoint is a breakpoint set by the user. Each one is given
+//a number (ID) which stays the same until it is deleted.
+type Breakpoint struct {
+	ID int
+
+	//Addresses holds every address the breakpoint was set at (a line
+	//can be compiled into several blocks of code)
+	Addresses []uint64
+	Filename  string
+	Line      int
+
+	//Condition is a C expression which must be true for the
+	//breakpoint to stop the VM (empty if it always stops)
+	Condition string
+
+	//Enabled is false when the break instruction has been lifted
+	//but the breakpoint is kept so it can be enabled again
+	Enabled bool
+
+	//Hits counts the number of times the breakpoint has been hit
+	//(with its condition true)
+	Hits int
+
+	//Ignore is the number of hits to pass over before stopping
+	Ignore int
+
+	//Hardware is true when the breakpoint uses the debug registers
+	//of the CPU rather than a break instruction written to memory
+	Hardware bool
+
+	//Temporary breakpoints are deleted the first time they stop the VM
+	Temporary bool
+
+	//Commands are the CLI commands run each time the breakpoint stops the VM
+	Commands []string
+
+	//Format is printed with the values of the variables named by Args each
+	//time a dprintf breakpoint is hit (the VM is then resumed without stopping)
+	Format string
+	Args   []string
+
+	//Watch is the kind of access which stops the VM for a watchpoint
+	//(NoWatch for breakpoints) and Expression is what is watched
+	Watch      WatchKind
+	Expression string
+
+	//variable describes the memory watched (its size and how to print it)
+	//and value holds the last value seen
+	variable Variable
+	value    []byte
+
+	//scopePC and scopeSP are where the frame of the local variables
+	//watched returns to (scopePC is 0 when only globals are watched)
+	scopePC uint64
+	scopeSP uint64
+
+	//framePC and frameRegisters are the PC and registers of the frame a
+	//software watchpoint was set in (its expression is evaluated in that frame)
+	framePC        uint64
+	frameRegisters *op.DwarfRegisters
+}
+
+//WatchKind is the kind of access a watchpoint stops on
+type WatchKind int
+
+const (
+	NoWatch WatchKind = iota
+	//WatchWrite stops when the value watched is changed
+	WatchWrite
+	//WatchRead stops when the value watched is read
+	WatchRead
+	//WatchAccess stops when the value watched is read or written
+	WatchAccess
+)
+
+func (kind WatchKind) String() string {
+	switch kind {
+	case WatchWrite:
+		return "hw watchpoint"
+	case WatchRead:
+		return "read watchpoint"
+	case WatchAccess:
+		return "acc watchpoint"
+	}
+	return "breakpoint"
+}
+
+//Title returns how a watchpoint of the kind is introduced when it is set or hit
+func (kind WatchKind) Title() string {
+	switch kind {
+	case WatchRead:
+		return "Hardware read watchpoint"
+	case WatchAccess:
+		return "Hardware access (read/write) watchpoint"
+	}
+	return "Hardware watchpoint"
+}
+
+//debugRegions - returns what the breakpoint loads into the debug registers
+func (breakpoint *Breakpoint) debugRegions() []debugRegion {
+	if !breakpoint.Hardware || !breakpoint.Enabled {
+		return nil
+	}
+
+	switch breakpoint.Watch {
+	case WatchWrite:
+		return watchRegions(breakpoint.Addresses[0], breakpoint.variable.Size(), accessWrite, breakpoint.ID)
+	case WatchRead, WatchAccess:
+		return watchRegions(breakpoint.Addresses[0], breakpoint.variable.Size(), accessReadWrite, breakpoint.ID)
+	}
+
+	var regions []debugRegion
+	for _, address := range breakpoint.Addresses {
+		regions = append(regions, debugRegion{address: address, access: accessExecute, length: 1, id: breakpoint.ID})
+	}
+	return regions
+}
+
 //Breakpoints manages the setting and remove of breakpoints
 type Breakpoints struct {
 	breakpoints        map[uint64]byte
+	table              map[int]*Breakpoint
+	nextID             int
 	mem                MemoryAccess
 	restoreBreakpoints []uint64
 }
@@ -40,6 +169,8 @@ type Breakpoints struct {
 func NewBreakpointManager(mem MemoryAccess) *Breakpoints {
 	bp := new(Breakpoints)
 	bp.breakpoints = make(map[uint64]byte)
+	bp.table = make(map[int]*Breakpoint)
+	bp.nextID = 1
 	bp.mem = mem
 	return bp
 }
@@ -82,6 +213,16 @@ func (point *Breakpoints) Addresses() []uint64 {
 	return list
 }
 
+//OriginalBytes - replaces the break instructions in code read from memory
+//starting at the address with the bytes they overwrote
+func (point *Breakpoints) OriginalBytes(address uint64, code []byte) {
+	for i := range code {
+		if original, ok := point.breakpoints[address+uint64(i)]; ok {
+			code[i] = original
+		}
+	}
+}
+
 //RestoreInstruction - writes back the original byte that was overwritten 
 //with the breakpoint
 func (point *Breakpoints) RestoreInstruction(address uint64) error {
@@ -93,7 +234,7 @@ func (point *Breakpoints) RestoreInstruction(address uint64) error {
 		point.restoreBreakpoints = append(point.restoreBreakpoints, address)
 		return nil
 	}
-	return BreakPointError{address, NotFound}
+	return BreakPointError{Address: address, errType: NotFound}
 }
 
 //RestoreBreakpoint - puts breakpoints back in their place (only the ones
@@ -115,3 +256,256 @@ func (point *Breakpoints) AddressIsBreakpoint(address uint64) bool {
 	_, ok := point.breakpoints[address]
 	return ok
 }
+
+//Create - sets a breakpoint at each of the addresses and adds them to the table
+//of the user's breakpoints as a single breakpoint
+func (point *Breakpoints) Create(addresses []uint64, filename string, line int) (*Breakpoint, error) {
+	for _, address := range addresses {
+		if point.At(address) != nil {
+			return nil, BreakPointError{Address: address, errType: AlreadyBreakpointSet}
+		}
+	}
+
+	err := point.addAll(addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	breakpoint := &Breakpoint{ID: point.nextID, Addresses: addresses, Filename: filename, Line: line, Enabled: true}
+	point.table[breakpoint.ID] = breakpoint
+	point.nextID += 1
+	return breakpoint, nil
+}
+
+//Lookup - returns the breakpoint with the ID
+func (point *Breakpoints) Lookup(id int) (*Breakpoint, error) {
+	breakpoint, ok := point.table[id]
+	if !ok {
+		return nil, BreakPointError{ID: id, errType: UnknownID}
+	}
+	return breakpoint, nil
+}
+
+//At - returns the user's breakpoint at the address (nil if there isn't one)
+func (point *Breakpoints) At(address uint64) *Breakpoint {
+	for _, breakpoint := range point.table {
+		if breakpoint.Watch != NoWatch {
+			continue
+		}
+		for _, breakpointAddress := range breakpoint.Addresses {
+			if breakpointAddress == address {
+				return breakpoint
+			}
+		}
+	}
+	return nil
+}
+
+//addAll - writes the break instruction to each address. If one of them fails
+//the ones already written are removed again.
+func (point *Breakpoints) addAll(addresses []uint64) error {
+	for i, address := range addresses {
+		err := point.Add(address)
+		if err != nil {
+			point.removeAll(addresses[:i])
+			return err
+		}
+	}
+	return nil
+}
+
+//removeAll - removes the break instruction from each address
+func (point *Breakpoints) removeAll(addresses []uint64) error {
+	for _, address := range addresses {
+		err := point.Remove(address)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Delete - removes the breakpoint with the ID from the table and the memory
+func (point *Breakpoints) Delete(id int) error {
+	breakpoint, err := point.Lookup(id)
+	if err != nil {
+		return err
+	}
+
+	if breakpoint.Enabled && !breakpoint.Hardware {
+		err = point.removeAll(breakpoint.Addresses)
+		if err != nil {
+			return err
+		}
+	}
+	delete(point.table, id)
+	return nil
+}
+
+//Enable - puts the break instruction of a disabled breakpoint back
+func (point *Breakpoints) Enable(id int) error {
+	breakpoint, err := point.Lookup(id)
+	if err != nil {
+		return err
+	}
+	if breakpoint.Enabled {
+		return nil
+	}
+
+	if breakpoint.Hardware {
+		breakpoint.Enabled = true
+		err = point.checkDebugRegisters(breakpoint)
+		if err != nil {
+			breakpoint.Enabled = false
+		}
+	} else {
+		err = point.addAll(breakpoint.Addresses)
+	}
+	if err != nil {
+		return err
+	}
+	breakpoint.Enabled = true
+	return nil
+}
+
+//Disable - lifts the break instruction of the breakpoint but keeps it in
+//the table so it can be enabled later
+func (point *Breakpoints) Disable(id int) error {
+	breakpoint, err := point.Lookup(id)
+	if err != nil {
+		return err
+	}
+	if !breakpoint.Enabled {
+		return nil
+	}
+
+	if !breakpoint.Hardware {
+		err = point.removeAll(breakpoint.Addresses)
+		if err != nil {
+			return err
+		}
+	}
+	breakpoint.Enabled = false
+	return nil
+}
+
+//List - returns the user's breakpoints ordered by their ID
+func (point *Breakpoints) List() []*Breakpoint {
+	var list []*Breakpoint
+	for _, breakpoint := range point.table {
+		list = append(list, breakpoint)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+//CreateTemporary - the same as Create but the breakpoint is deleted the
+//first time it stops the VM
+func (point *Breakpoints) CreateTemporary(addresses []uint64, filename string, line int) (*Breakpoint, error) {
+	breakpoint, err := point.Create(addresses, filename, line)
+	if err != nil {
+		return nil, err
+	}
+	breakpoint.Temporary = true
+	return breakpoint, nil
+}
+
+//CreateHardware - adds a breakpoint which uses the debug registers of the CPU
+//instead of a break instruction, so the memory of the VM is never modified.
+//Each address of the breakpoint takes up one of the debug registers.
+func (point *Breakpoints) CreateHardware(addresses []uint64, filename string, line int) (*Breakpoint, error) {
+	for _, address := range addresses {
+		if point.At(address) != nil {
+			return nil, BreakPointError{Address: address, errType: AlreadyBreakpointSet}
+		}
+	}
+
+	breakpoint := &Breakpoint{ID: point.nextID, Addresses: addresses, Filename: filename, Line: line, Enabled: true, Hardware: true}
+	err := point.addHardware(breakpoint)
+	if err != nil {
+		return nil, err
+	}
+	return breakpoint, nil
+}
+
+//CreateWatchpoint - adds a watchpoint which stops the VM when the memory at the
+//address described by the variable is accessed. Watchpoints use the debug
+//registers so (like hardware breakpoints) they never modify the memory.
+func (point *Breakpoints) CreateWatchpoint(expression string, address uint64, variable Variable, kind WatchKind) (*Breakpoint, error) {
+	if variable.Size() <= 0 {
+		return nil, fmt.Errorf("Error: cannot watch %s as it has no size", expression)
+	}
+
+	breakpoint := &Breakpoint{ID: point.nextID, Addresses: []uint64{address}, Enabled: true, Hardware: true, Watch: kind, Expression: expression, variable: variable}
+	err := point.addHardware(breakpoint)
+	if err != nil {
+		return nil, err
+	}
+	return breakpoint, nil
+}
+
+//CreateSoftwareWatchpoint - adds a watchpoint which is checked by single stepping
+//the VM and evaluating the expression after each line. It is much slower than one
+//using the debug registers but works for expressions of any size (and ones which
+//aren't stored in memory).
+func (point *Breakpoints) CreateSoftwareWatchpoint(expression string, variable Variable) *Breakpoint {
+	breakpoint := &Breakpoint{ID: point.nextID, Enabled: true, Watch: WatchWrite, Expression: expression, variable: variable}
+	point.table[breakpoint.ID] = breakpoint
+	point.nextID += 1
+	return breakpoint
+}
+
+//addHardware - adds a breakpoint using the debug registers to the table if
+//there are enough registers left for it
+func (point *Breakpoints) addHardware(breakpoint *Breakpoint) error {
+	point.table[breakpoint.ID] = breakpoint
+	err := point.checkDebugRegisters(breakpoint)
+	if err != nil {
+		delete(point.table, breakpoint.ID)
+		return err
+	}
+	point.nextID += 1
+	return nil
+}
+
+//checkDebugRegisters - checks the enabled breakpoints still fit in the debug
+//registers now that the breakpoint given has been added or enabled
+func (point *Breakpoints) checkDebugRegisters(breakpoint *Breakpoint) error {
+	if len(point.debugRegions()) > debugSlots {
+		return BreakPointError{Address: breakpoint.Addresses[0], errType: NoDebugRegisters}
+	}
+	return nil
+}
+
+//debugRegions - returns what the enabled breakpoints load into the debug registers
+//in the order they are given the registers
+func (point *Breakpoints) debugRegions() []debugRegion {
+	var regions []debugRegion
+	for _, breakpoint := range point.List() {
+		regions = append(regions, breakpoint.debugRegions()...)
+	}
+	return regions
+}
+
+//HardwareAddresses - returns the addresses loaded into the debug registers
+//by the enabled hardware breakpoints and watchpoints
+func (point *Breakpoints) HardwareAddresses() []uint64 {
+	var addresses []uint64
+	for _, region := range point.debugRegions() {
+		addresses = append(addresses, region.address)
+	}
+	return addresses
+}
+
+//Watchpoints - returns the watchpoints ordered by their ID
+func (point *Breakpoints) Watchpoints() []*Breakpoint {
+	var list []*Breakpoint
+	for _, breakpoint := range point.List() {
+		if breakpoint.Watch != NoWatch {
+			list = append(list, breakpoint)
+		}
+	}
+	return list
+}
@@ -116,3 +116,153 @@ func TestAddWriteError(t *testing.T) {
 // 		assert.Equal(t, address + uint64(index), current)
 // 	}
 // }
+
+//Tests breakpoints are numbered in the order they are created and
+//numbers aren't reused after a breakpoint is deleted
+func TestCreateAndDelete(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	memoryAccess := mocks.NewMockMemoryAccess(mockCtrl)
+	memoryAccess.EXPECT().Read(gomock.Any(), size).Return(content, nil).AnyTimes()
+	memoryAccess.EXPECT().Write(gomock.Any(), []byte{breakInt}, uint(1)).Return(nil).Times(3)
+	manager := debugger.NewBreakpointManager(memoryAccess)
+
+	first, err := manager.Create([]uint64{0x10}, "test.c", 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, first.ID)
+	second, err := manager.Create([]uint64{0x20}, "test.c", 4)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, second.ID)
+
+	_, err = manager.Create([]uint64{0x10}, "test.c", 3)
+	assert.Equal(t, "Error: breakpoint already at 16", err.Error())
+
+	memoryAccess.EXPECT().Write(uint64(0x10), content, uint(1)).Return(nil)
+	err = manager.Delete(1)
+	assert.Nil(t, err)
+	assert.False(t, manager.AddressIsBreakpoint(0x10))
+	assert.Nil(t, manager.At(0x10))
+
+	third, err := manager.Create([]uint64{0x10}, "test.c", 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, third.ID)
+	assert.Equal(t, []*debugger.Breakpoint{second, third}, manager.List())
+
+	err = manager.Delete(1)
+	assert.Equal(t, "Error: no breakpoint number 1", err.Error())
+}
+
+//Tests disabling a breakpoint lifts the break instruction but keeps the breakpoint
+func TestDisableEnable(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	memoryAccess := mocks.NewMockMemoryAccess(mockCtrl)
+	manager := debugger.NewBreakpointManager(memoryAccess)
+
+	gomock.InOrder(
+		memoryAccess.EXPECT().Read(address, size).Return(content, nil),
+		memoryAccess.EXPECT().Write(address, []byte{breakInt}, uint(1)).Return(nil),
+		memoryAccess.EXPECT().Write(address, content, uint(1)).Return(nil),
+		memoryAccess.EXPECT().Read(address, size).Return(content, nil),
+		memoryAccess.EXPECT().Write(address, []byte{breakInt}, uint(1)).Return(nil),
+	)
+	breakpoint, err := manager.Create([]uint64{address}, "test.c", 3)
+	assert.Nil(t, err)
+
+	err = manager.Disable(breakpoint.ID)
+	assert.Nil(t, err)
+	assert.False(t, breakpoint.Enabled)
+	assert.False(t, manager.AddressIsBreakpoint(address))
+	assert.Equal(t, breakpoint, manager.At(address))
+
+	//Disabling twice doesn't touch the memory again
+	err = manager.Disable(breakpoint.ID)
+	assert.Nil(t, err)
+
+	err = manager.Enable(breakpoint.ID)
+	assert.Nil(t, err)
+	assert.True(t, breakpoint.Enabled)
+	assert.True(t, manager.AddressIsBreakpoint(address))
+}
+
+//Tests a breakpoint covering several blocks of a line is set and lifted as one
+func TestCreateSeveralAddresses(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	memoryAccess := mocks.NewMockMemoryAccess(mockCtrl)
+	memoryAccess.EXPECT().Read(gomock.Any(), size).Return(content, nil).Times(2)
+	memoryAccess.EXPECT().Write(uint64(0x10), []byte{breakInt}, uint(1)).Return(nil)
+	memoryAccess.EXPECT().Write(uint64(0x30), []byte{breakInt}, uint(1)).Return(nil)
+	manager := debugger.NewBreakpointManager(memoryAccess)
+
+	breakpoint, err := manager.Create([]uint64{0x10, 0x30}, "test.c", 8)
+	assert.Nil(t, err)
+	assert.Equal(t, breakpoint, manager.At(0x10))
+	assert.Equal(t, breakpoint, manager.At(0x30))
+
+	//Another breakpoint can't share any of the addresses
+	_, err = manager.Create([]uint64{0x30}, "test.c", 8)
+	assert.Equal(t, "Error: breakpoint already at 48", err.Error())
+
+	memoryAccess.EXPECT().Write(uint64(0x10), content, uint(1)).Return(nil)
+	memoryAccess.EXPECT().Write(uint64(0x30), content, uint(1)).Return(nil)
+	err = manager.Delete(breakpoint.ID)
+	assert.Nil(t, err)
+	assert.False(t, manager.AddressIsBreakpoint(0x10))
+	assert.False(t, manager.AddressIsBreakpoint(0x30))
+}
+
+//Tests hardware breakpoints never touch the memory and are limited
+//to the number of debug registers
+func TestCreateHardware(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	memoryAccess := mocks.NewMockMemoryAccess(mockCtrl)
+	manager := debugger.NewBreakpointManager(memoryAccess)
+
+	first, err := manager.CreateHardware([]uint64{0x10, 0x20, 0x30}, "test.c", 8)
+	assert.Nil(t, err)
+	assert.True(t, first.Hardware)
+	assert.False(t, manager.AddressIsBreakpoint(0x10))
+
+	_, err = manager.CreateHardware([]uint64{0x40, 0x50}, "test.c", 9)
+	assert.Equal(t, "Error: not enough hardware debug registers for a breakpoint at 64 (only 4 addresses can be watched at once)", err.Error())
+	second, err := manager.CreateHardware([]uint64{0x40}, "test.c", 9)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{0x10, 0x20, 0x30, 0x40}, manager.HardwareAddresses())
+
+	//Disabled breakpoints give up their debug registers
+	err = manager.Disable(first.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{0x40}, manager.HardwareAddresses())
+	_, err = manager.CreateHardware([]uint64{0x60, 0x70}, "test.c", 10)
+	assert.Nil(t, err)
+	err = manager.Enable(first.ID)
+	assert.NotNil(t, err)
+	assert.False(t, first.Enabled)
+
+	err = manager.Delete(second.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{0x60, 0x70}, manager.HardwareAddresses())
+}
+
+//Tests a watchpoint is split into aligned regions for the debug registers
+func TestCreateWatchpoint(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	memoryAccess := mocks.NewMockMemoryAccess(mockCtrl)
+	variable := mocks.NewMockVariable(mockCtrl)
+	variable.EXPECT().Size().Return(12).AnyTimes()
+	manager := debugger.NewBreakpointManager(memoryAccess)
+
+	watchpoint, err := manager.CreateWatchpoint("node", 0x1004, variable, debugger.WatchWrite)
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{0x1004, 0x1008}, manager.HardwareAddresses())
+	assert.Equal(t, []*debugger.Breakpoint{watchpoint}, manager.Watchpoints())
+	//Watchpoints aren't breakpoints on code
+	assert.Nil(t, manager.At(0x1004))
+
+	_, err = manager.CreateWatchpoint("other", 0x2001, variable, debugger.WatchAccess)
+	assert.Equal(t, "Error: not enough hardware debug registers for a breakpoint at 8193 (only 4 addresses can be watched at once)", err.Error())
+	assert.Equal(t, []*debugger.Breakpoint{watchpoint}, manager.List())
+}
@@ -0,0 +1,125 @@
+package debugger
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+//timestampFormat is used to timestamp the output of dprintf so it
+//can be lined up with the console of the guest
+const timestampFormat = "15:04:05.000000"
+
+//conversion matches a conversion specification of a C format string (the
+//verb is the last character, length modifiers such as l are ignored)
+var conversion = regexp.MustCompile(`%[-+ #0]*[0-9]*(\.[0-9]+)?(hh|h|ll|l|j|z|t|L)?[diouxXcsfFeEgGp%]`)
+
+//SetCommands sets the CLI commands run each time the breakpoint with the
+//number given stops the VM (an empty list removes them)
+func (debugger *Debugger) SetCommands(id int, commands []string) error {
+	breakpoint, err := debugger.breakpointManager.Lookup(id)
+	if err != nil {
+		return err
+	}
+	breakpoint.Commands = commands
+	return nil
+}
+
+//HitCommands returns the commands of the breakpoint that last stopped the
+//VM. The commands of each stop are only returned once.
+func (debugger *Debugger) HitCommands() []string {
+	breakpoint := debugger.stoppedBy
+	if breakpoint == nil {
+		return nil
+	}
+	debugger.stoppedBy = nil
+	return breakpoint.Commands
+}
+
+//DprintfAt sets a breakpoint at a location (the same as BreakAt) which prints
+//the values of variables using a C style format (e.g. "x = %d\n") each time it
+//is hit and then resumes the VM, so a running program can be traced without
+//being stopped. Returns the number of the breakpoint and where it was set.
+func (debugger *Debugger) DprintfAt(spec string, format string, args []string, vcpu uint32) (int, string, error) {
+	if format == "" {
+		return 0, "", fmt.Errorf("Error: dprintf must be given a format to print")
+	}
+	if count := countValues(format); count != len(args) {
+		return 0, "", fmt.Errorf("Error: the format of dprintf uses %d values but %d were given", count, len(args))
+	}
+
+	return debugger.breakAt(spec, "", func(addresses []uint64, filename string, line int) (*Breakpoint, error) {
+		breakpoint, err := debugger.breakpointManager.Create(addresses, filename, line)
+		if err != nil {
+			return nil, err
+		}
+		breakpoint.Format = format
+		breakpoint.Args = args
+		return breakpoint, nil
+	})
+}
+
+//dprintf - prints the values of a dprintf breakpoint that has just been hit
+func (debugger *Debugger) dprintf(breakpoint *Breakpoint) error {
+	values := make([]*Value, len(breakpoint.Args))
+	for i, name := range breakpoint.Args {
+		value, err := debugger.readVariable(name)
+		if err != nil {
+			return fmt.Errorf("Error: could not read %s for dprintf %d (%s)", name, breakpoint.ID, err)
+		}
+		values[i] = value
+	}
+
+	text := formatValues(breakpoint.Format, values, debugger.radix)
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	_, err := fmt.Fprintf(debugger.output, "[%s] %s", time.Now().Format(timestampFormat), text)
+	return err
+}
+
+//countValues - returns the number of values a C format string uses
+func countValues(format string) int {
+	count := 0
+	for _, spec := range conversion.FindAllString(format, -1) {
+		if spec != "%%" {
+			count += 1
+		}
+	}
+	return count
+}
+
+//formatValues - replaces each conversion specification in a C format string
+//with the next value. Numbers are converted to apply the width, precision and
+//base of the specification, anything else is printed the way print shows it
+//(with integers in the radix given).
+func formatValues(format string, values []*Value, base int) string {
+	next := 0
+	return conversion.ReplaceAllStringFunc(format, func(spec string) string {
+		verb := spec[len(spec)-1]
+		if verb == '%' {
+			return "%"
+		}
+		value := values[next]
+		next += 1
+
+		//Go's fmt uses the same flags, width and precision as C
+		prefix := strings.TrimRight(spec[:len(spec)-1], "hljztL")
+		integer := value.Kind != FloatValue && value.Kind != StructValue && value.Kind != UnionValue && value.Kind != ArrayValue
+		switch {
+		case integer && (verb == 'd' || verb == 'i') && value.signed():
+			return fmt.Sprintf(prefix+"d", value.Int())
+		case integer && (verb == 'd' || verb == 'i' || verb == 'u'):
+			return fmt.Sprintf(prefix+"d", value.Uint())
+		case integer && strings.IndexByte("xXoc", verb) >= 0:
+			return fmt.Sprintf(prefix+string(verb), value.Uint())
+		case integer && strings.IndexByte("fFeEgG", verb) >= 0:
+			return fmt.Sprintf(prefix+string(verb), value.converted())
+		case value.Kind == FloatValue && strings.IndexByte("fFeEgG", verb) >= 0:
+			return fmt.Sprintf(prefix+string(verb), value.Float())
+		}
+		//Anything else (strings, structs, pointers) is printed as it is
+		return fmt.Sprintf(prefix+"s", value.Format(NaturalFormat, base))
+	})
+}
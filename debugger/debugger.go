@@ -4,9 +4,13 @@ import "C"
 
 import (
 	"bufio"
+	"context"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/go-delve/delve/pkg/dwarf/op"
 )
@@ -19,6 +23,8 @@ func (err DebuggingError) Error() string {
 		return "Error: Domain is not paused"
 	case NotPointer:
 		return "Error: Not pointer type"
+	case NoFrame:
+		return "Error: No frame at that level"
 	}
 	return ""
 }
@@ -32,6 +38,10 @@ const (
 	//NotPointer is returned when dereference is run 
 	//non pointer type.
 	NotPointer
+
+	//NoFrame is returned when a frame is selected which
+	//is not on the call stack
+	NoFrame
 )
 
 //Registers is an interface that defines how the debugger
@@ -79,6 +89,17 @@ type Control interface {
 	
 	//Unpause the VM
 	Unpause() error
+
+	//State returns whether the VM is paused, has shut down or has crashed
+	State() (DomainState, error)
+
+	//WaitForStop blocks until the VM is paused, shuts down or crashes and
+	//returns its state. It must return the error of the context (without
+	//pausing the VM) as soon as the context is cancelled or times out.
+	WaitForStop(ctx context.Context) (DomainState, error)
+
+	//VCPUs returns the number of vcpus the domain has
+	VCPUs() (uint32, error)
 }
 
 //LineInformation defines interface for getting information about the 
@@ -100,11 +121,20 @@ type LineInformation interface {
 	//it is your responsability to handle issues because of this.
 	Address(string, int) uint64
 
+	//LineAddresses takes a filename and a line number then returns every address
+	//the line starts at (a line may be compiled into several blocks of code, such
+	//as the condition of a loop). If the line has no code the next line with code
+	//should be used. The line used is returned along with the addresses.
+	LineAddresses(string, int) ([]uint64, int)
 
 	//AddressToLine takes an address and converts it into line information.
 	//Please note this operation cannot affect the operation of the other 
 	//methods.
 	AddressToLine(address uint64) (string, int, error)
+
+	//SkipPrologue takes the range of addresses of a function and returns the
+	//first address after the prologue (where a breakpoint on the function goes).
+	SkipPrologue(lowPC, highPC uint64) uint64
 }
 
 //MemoryAccess defines API that will be used to for reading and writing to memory
@@ -155,6 +185,78 @@ type Symbol interface {
 	//ParsePointer pretty print the content memory pointed by a pointer.
 	//Note the variable passed is the pointer
 	ParsePointer(Variable, []byte, binary.ByteOrder) (string, error)
+
+	//GetFunction given the current PC return the function it is in.
+	//Like GetSymbol not finding the function must return an error.
+	GetFunction(uint64) (Function, error)
+
+	//IsFloat return true if the variable is a floating point type
+	IsFloat(Variable) bool
+
+	//Unwind takes the registers of a frame and returns the registers of the frame
+	//that called it (using memory to read the values the frame saved). The CFA and
+	//FrameBase of the registers passed in must be set to the values of that frame.
+	Unwind(*op.DwarfRegisters, MemoryAccess) (*op.DwarfRegisters, error)
+
+	//SetCFA sets the CFA and FrameBase of the registers of a frame using the
+	//call frame information for its PC (so they are right even before the
+	//function has set up its frame pointer)
+	SetCFA(*op.DwarfRegisters) error
+
+	//LookupFunction returns the function with the name given (in any
+	//compile unit).
+	LookupFunction(string) (Function, error)
+
+	//Functions returns the names of every function in the program.
+	Functions() []string
+
+	//CheckExpression checks whether a C expression is well formed (it
+	//isn't evaluated so the symbols in it don't need to be in scope).
+	CheckExpression(string) error
+
+	//Condition evaluates a C expression in the frame with the PC and
+	//registers given and returns whether the expression is true.
+	Condition(string, uint64, *op.DwarfRegisters, MemoryAccess) (bool, error)
+
+	//Evaluate evaluates a C expression in the frame with the PC and registers
+	//given. It returns a Variable describing the result (used to print it), the
+	//bytes of the result and whether the expression uses local variables.
+	Evaluate(string, uint64, *op.DwarfRegisters, MemoryAccess) (Variable, []byte, bool, error)
+
+	//Value evaluates a C expression in the frame with the PC and registers
+	//given and returns its value as a tree (see Value).
+	Value(string, uint64, *op.DwarfRegisters, MemoryAccess) (*Value, error)
+
+	//VariableValue returns the value of a variable (or the result of Evaluate)
+	//as a tree given the bytes stored in it. The memory is used to follow pointers.
+	VariableValue(Variable, []byte, MemoryAccess) (*Value, error)
+
+	//Watch evaluates a C expression which refers to memory (such as a variable
+	//or a member of a struct) in the frame with the PC and registers given. It
+	//returns a Variable describing the memory (used for its size and to print it),
+	//its address and whether the expression uses local variables (so is only
+	//valid while the frame exists).
+	Watch(string, uint64, *op.DwarfRegisters, MemoryAccess) (Variable, uint64, bool, error)
+}
+
+//Function interface defines how the debugger will interact with
+//the functions (subprograms) of the program.
+type Function interface {
+	//Name returns the name of the function
+	Name() string
+
+	//ReturnType should return a Variable describing the value returned
+	//by the function (it has no location). Return nil if the function
+	//does not return anything (i.e. void).
+	ReturnType() Variable
+
+	//Parameters returns the formal parameters of the function in the
+	//order they are declared.
+	Parameters() []Variable
+
+	//Range returns the addresses of the first instruction of the function
+	//and the one just past its last instruction.
+	Range() (uint64, uint64)
 }
 
 //Debugger struct carries out the debugging
@@ -167,6 +269,24 @@ type Debugger struct {
 	memory            MemoryAccess
 	lineInfo          LineInformation
 	symbols           Symbol
+	//frame is the level of the frame variables are read from
+	//(it goes back to the innermost frame once the VM runs again)
+	frame int
+	//armed holds what was loaded into the debug registers
+	//while the VM is running (nil when they are turned off)
+	armed []debugRegion
+	//stoppedBy is the breakpoint which last stopped the VM (nil if
+	//the VM stopped for another reason)
+	stoppedBy *Breakpoint
+	//output is where dprintf breakpoints print to
+	output io.Writer
+	//radix is the base integers are displayed in (8, 10 or 16)
+	radix int
+	//trap is the address of the break instruction the VM last stopped just
+	//after running and trapped whether it did (the PC alone can't tell us as
+	//single stepping a 1 byte instruction under a breakpoint leaves it there too)
+	trap    uint64
+	trapped bool
 }
 
 //NewDebugger - constructor the debugger struct
@@ -179,9 +299,39 @@ func NewDebugger(memory MemoryAccess, controller Control, lineInfo LineInformati
 	debugger.symbols = symbols
 	debugger.memory = memory
 	debugger.endianess = binary.LittleEndian
+	debugger.output = os.Stdout
+	debugger.radix = 10
 	return debugger
 }
 
+//SetOutput sets where the output of dprintf breakpoints is written
+//(standard output by default)
+func (debugger *Debugger) SetOutput(output io.Writer) {
+	debugger.output = output
+}
+
+//SetOutputRadix sets the base (8, 10 or 16) integers are displayed in
+//unless a format is given
+func (debugger *Debugger) SetOutputRadix(radix int) error {
+	if radix != 8 && radix != 10 && radix != 16 {
+		return fmt.Errorf("Error: unsupported output radix %d (expected 8, 10 or 16)", radix)
+	}
+	debugger.radix = radix
+	return nil
+}
+
+//OutputRadix returns the base integers are displayed in
+func (debugger *Debugger) OutputRadix() int {
+	return debugger.radix
+}
+
+//resetStop - forgets the frame selected and the breakpoint that stopped the
+//VM as it is about to run again
+func (debugger *Debugger) resetStop() {
+	debugger.frame = 0
+	debugger.stoppedBy = nil
+}
+
 func (debugger *Debugger) singleStep(vcpu uint32, start bool) error {
 
 	registers, err := debugger.registers.GetRegisters(vcpu)
@@ -225,80 +375,528 @@ func (debugger *Debugger) GetLineInformation() string {
 	return fmt.Sprintf("%s:%d - %s", filename, lineNo, line)
 }
 
-//Step - moves the program to the next source line
+//Step - moves the program to the next source line and returns where it stopped.
 //Note only works when the process has been paused 
 //and will put into single step mode. 
-func (debugger *Debugger) Step(vcpu uint32) error {
+func (debugger *Debugger) Step(ctx context.Context, vcpu uint32) (StopEvent, error) {
 	if !debugger.controller.IsPaused() {
-		return NotPaused
+		return StopEvent{}, NotPaused
 	}
+	debugger.resetStop()
 
 	err := debugger.singleStep(vcpu, true)
 	if err != nil {
-		return err
+		return StopEvent{}, err
 	}
 
 	isNewline := false
+	var address uint64
 
 	for !isNewline {
-		//Busy wait until the process is no longer running
-		for !debugger.controller.IsPaused() {
+		//Wait until the process is no longer running
+		err = debugger.waitForStop(ctx)
+		if event, exited := exitEvent(err); exited {
+			return event, nil
+		} else if err != nil && err == ctx.Err() {
+			err = debugger.abandonStep(vcpu, err)
+			event, err := debugger.interruptedEvent(vcpu, err)
+			if err != nil {
+				return StopEvent{}, err
+			}
+			return debugger.locate(event), nil
+		} else if err != nil {
+			return StopEvent{}, err
 		}
 
 		registers, err := debugger.registers.GetRegisters(vcpu)
 		if err != nil {
-			return err
+			return StopEvent{}, err
 		}
 
 		rip, err := registers.GetRegister("rip")
 		if err != nil {
-			return err
+			return StopEvent{}, err
 		}
 
 
 		isNewline = debugger.lineInfo.IsNewLine(rip)
+		address = rip
 
 		//Check whether a breakpoint exists here (if we've went through one
 		//we need to fix the instruction that we've broken at before moving on).
-		if debugger.breakpointManager.AddressIsBreakpoint(rip-1) {
+		if trap, trapped := debugger.stoppedOnTrap(rip); trapped {
 
 			//We need to restore the instruction to its original state before 
 			//the breakpoint was inserted because the instruction we over wrote 
 			//may modify some state of the VM.
-			err = debugger.breakpointManager.RestoreInstruction(rip-1)
+			err = debugger.breakpointManager.RestoreInstruction(trap)
 			if err != nil {
-				return err
+				return StopEvent{}, err
 			}
 
 			//We want to rollback to run the instruction that was over written with
 			//the breakpoint 
-			rip -= 1
+			rip = trap
 			err := registers.SetRegister("rip", rip)
 			if err != nil {
-				return err
+				return StopEvent{}, err
 			}
 
 			err = debugger.registers.SetRegisters(vcpu, registers)
 			if err != nil {
-				return err 
+				return StopEvent{}, err
 			}
 		} else {
 			err = debugger.breakpointManager.RestoreBreakpoint()
 			if err != nil {
-				return err
+				return StopEvent{}, err
 			}
 		}
 
+		//Only one instruction is run so it traps if it is one of our
+		//break instructions (i.e. its breakpoint hasn't been lifted)
+		debugger.trap = rip
+		debugger.trapped = debugger.breakpointManager.AddressIsBreakpoint(rip)
 
 		err = debugger.controller.Unpause()
 		if err != nil {
-			return err
+			return StopEvent{}, err
 		}
 	}
 	err = debugger.breakpointManager.RestoreBreakpoint()
+	if err != nil {
+		return StopEvent{}, err
+	}
+	return debugger.locate(StopEvent{Reason: StepComplete, Address: address}), nil
+}
+
+//Helper function for reading the current program counter and stack pointer
+func (debugger *Debugger) stackPosition(vcpu uint32) (Registers, uint64, uint64, error) {
+	registers, err := debugger.registers.GetRegisters(vcpu)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	rip, err := registers.GetRegister("rip")
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	rsp, err := registers.GetRegister("rsp")
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return registers, rip, rsp, nil
+}
+
+//recordTrap - notes whether the VM, which has just stopped after running, ran
+//one of our break instructions. It can't get just past a break instruction in
+//memory without running it (the one under the PC is lifted before it is single
+//stepped) so this must be called before the lifted breakpoints are put back.
+func (debugger *Debugger) recordTrap(vcpu uint32) error {
+	registers, err := debugger.registers.GetRegisters(vcpu)
+	if err != nil {
+		return err
+	}
+
+	rip, err := registers.GetRegister("rip")
+	if err != nil {
+		return err
+	}
+	debugger.trap = rip - 1
+	debugger.trapped = debugger.breakpointManager.AddressIsBreakpoint(debugger.trap)
+	return nil
+}
+
+//stoppedOnTrap - returns the address of the break instruction the VM stopped
+//on if the PC is still just past it (false if the VM didn't stop on one)
+func (debugger *Debugger) stoppedOnTrap(rip uint64) (uint64, bool) {
+	if !debugger.trapped || debugger.trap+1 != rip {
+		return 0, false
+	}
+	return debugger.trap, true
+}
+
+//stopAddress - returns the address the VM is stopped at, which is the break
+//instruction it has just run if it stopped on one (the PC is just past it)
+func (debugger *Debugger) stopAddress(rip uint64) uint64 {
+	if trap, trapped := debugger.stoppedOnTrap(rip); trapped {
+		return trap
+	}
+	return rip
+}
+
+//rewindBreakpoint - if we are paused just after a breakpoint has been
+//hit the PC points to the byte after the break instruction. This moves the
+//PC back so the overwritten instruction gets run when we resume.
+func (debugger *Debugger) rewindBreakpoint(vcpu uint32) error {
+	registers, err := debugger.registers.GetRegisters(vcpu)
+	if err != nil {
+		return err
+	}
+
+	rip, err := registers.GetRegister("rip")
+	if err != nil {
+		return err
+	}
+
+	address, trapped := debugger.stoppedOnTrap(rip)
+	if !trapped {
+		return nil
+	}
+
+	err = registers.SetRegister("rip", address)
+	if err != nil {
+		return err
+	}
+	return debugger.registers.SetRegisters(vcpu, registers)
+}
+
+//stepInstruction - executes exactly one instruction. If that instruction
+//has been overwritten by a breakpoint the original instruction is run and
+//the breakpoint put back afterwards.
+func (debugger *Debugger) stepInstruction(ctx context.Context, vcpu uint32) error {
+	_, err := debugger.stepInstructionArmed(ctx, vcpu, armNone)
+	return err
+}
+
+//stepInstructionArmed - the same as stepInstruction but with what the mode
+//includes loaded into the debug registers. Returns the hardware watchpoint
+//hit by the instruction (if there is one).
+func (debugger *Debugger) stepInstructionArmed(ctx context.Context, vcpu uint32, mode armMode) (*Breakpoint, error) {
+	registers, err := debugger.registers.GetRegisters(vcpu)
+	if err != nil {
+		return nil, err
+	}
+
+	rip, err := registers.GetRegister("rip")
+	if err != nil {
+		return nil, err
+	}
+
+	if debugger.breakpointManager.AddressIsBreakpoint(rip) {
+		err = debugger.breakpointManager.RestoreInstruction(rip)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = debugger.singleStep(vcpu, true)
+	if err != nil {
+		return nil, err
+	}
+
+	//Wait until the instruction has been executed
+	hit, err := debugger.run(ctx, vcpu, mode)
+	if err != nil && err == ctx.Err() {
+		return nil, debugger.abandonStep(vcpu, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = debugger.singleStep(vcpu, false)
+	if err != nil {
+		return nil, err
+	}
+	return hit, debugger.breakpointManager.RestoreBreakpoint()
+}
+
+//abandonStep - tidies up after waiting for a single step was cancelled by
+//turning single stepping off and putting back the breakpoint that was lifted
+//for it. Returns the error that cancelled the step.
+func (debugger *Debugger) abandonStep(vcpu uint32, err error) error {
+	stepErr := debugger.singleStep(vcpu, false)
+	if stepErr != nil {
+		return stepErr
+	}
+	restoreErr := debugger.breakpointManager.RestoreBreakpoint()
+	if restoreErr != nil {
+		return restoreErr
+	}
 	return err
 }
 
+//returnAddress - checks whether the last instruction executed was a call.
+//A call pushes the address of the next instruction onto the stack so the
+//stack will have grown by exactly one word, and the word on top of the stack
+//will point just past the previous PC (x86 instructions are at most 15 bytes).
+//Returns the address the call will return to.
+func (debugger *Debugger) returnAddress(previousRip, previousRsp, rsp uint64) (uint64, bool, error) {
+	if previousRsp-rsp != 8 {
+		return 0, false, nil
+	}
+
+	bytes, err := debugger.memory.Read(rsp, 8)
+	if err != nil {
+		return 0, false, err
+	}
+
+	address := debugger.endianess.Uint64(bytes)
+	if address <= previousRip || address > previousRip+15 {
+		return 0, false, nil
+	}
+	return address, true, nil
+}
+
+//runUntil - resumes the VM until the PC reaches the address with the stack
+//pointer at stackPointer (the stack pointer check stops recursive calls of the
+//same function from being mistaken for the frame we want). A temporary breakpoint
+//is used to stop at the address and always removed before returning. Returns
+//false if we stopped at one of the user's breakpoints before reaching the address.
+func (debugger *Debugger) runUntil(ctx context.Context, vcpu uint32, address, stackPointer uint64) (bool, error) {
+	temporary := !debugger.breakpointManager.AddressIsBreakpoint(address)
+	if temporary {
+		err := debugger.breakpointManager.Add(address)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	reached, err := debugger.resumeUntil(ctx, vcpu, address, stackPointer)
+	if temporary {
+		removeErr := debugger.breakpointManager.Remove(address)
+		if err == nil {
+			err = removeErr
+		}
+	}
+	return reached, err
+}
+
+func (debugger *Debugger) resumeUntil(ctx context.Context, vcpu uint32, address, stackPointer uint64) (bool, error) {
+	for {
+		//Moves us off the current instruction (it may be a breakpoint)
+		err := debugger.stepInstruction(ctx, vcpu)
+		if err != nil {
+			return false, err
+		}
+
+		registers, rip, rsp, err := debugger.stackPosition(vcpu)
+		if err != nil {
+			return false, err
+		}
+
+		if rip != address {
+			hit, err := debugger.run(ctx, vcpu, armBreakpoints)
+			if err != nil {
+				return false, err
+			}
+			hardware := hit != nil
+
+			registers, rip, rsp, err = debugger.stackPosition(vcpu)
+			if err != nil {
+				return false, err
+			}
+
+			//Hardware breakpoints stop before the instruction is run
+			if !hardware {
+				rip = debugger.stopAddress(rip)
+			}
+			if rip != address {
+				//One of the user's breakpoints was hit first
+				stop, err := debugger.breakpointStops(registers, rip)
+				if err != nil || stop {
+					return false, err
+				}
+			}
+
+			err = registers.SetRegister("rip", rip)
+			if err != nil {
+				return false, err
+			}
+
+			err = debugger.registers.SetRegisters(vcpu, registers)
+			if err != nil {
+				return false, err
+			}
+
+			if rip != address {
+				//The condition of the breakpoint is false so we carry on
+				continue
+			}
+		}
+
+		if rsp == stackPointer {
+			return true, nil
+		}
+	}
+}
+
+//Next - moves the program to the next source line in the current function.
+//Unlike Step any function called along the way is run to completion instead
+//of being stepped into. Note only works when the process has been paused.
+func (debugger *Debugger) Next(ctx context.Context, vcpu uint32) error {
+	if !debugger.controller.IsPaused() {
+		return NotPaused
+	}
+	debugger.resetStop()
+
+	err := debugger.rewindBreakpoint(vcpu)
+	if err != nil {
+		return err
+	}
+
+	_, rip, rsp, err := debugger.stackPosition(vcpu)
+	if err != nil {
+		return err
+	}
+	debugger.lineInfo.IsNewLine(rip)
+
+	for {
+		previousRip, previousRsp := rip, rsp
+		err = debugger.stepInstruction(ctx, vcpu)
+		if err != nil {
+			return err
+		}
+
+		_, rip, rsp, err = debugger.stackPosition(vcpu)
+		if err != nil {
+			return err
+		}
+
+		//We've entered a function, so we let it run until it returns to us
+		address, isCall, err := debugger.returnAddress(previousRip, previousRsp, rsp)
+		if err != nil {
+			return err
+		}
+		if isCall {
+			reached, err := debugger.runUntil(ctx, vcpu, address, previousRsp)
+			if err != nil {
+				return err
+			}
+
+			_, rip, rsp, err = debugger.stackPosition(vcpu)
+			if err != nil {
+				return err
+			}
+
+			if !reached {
+				//Stopped at a breakpoint inside the function called
+				debugger.lineInfo.IsNewLine(debugger.stopAddress(rip))
+				return debugger.deleteTemporaryHit(vcpu)
+			}
+		}
+
+		if debugger.lineInfo.IsNewLine(rip) {
+			return nil
+		}
+	}
+}
+
+//Finish - runs the program until the current function returns to its
+//caller. Returns why the VM stopped (LocationReached once the function has
+//returned, otherwise the breakpoint that stopped it first) and a pretty printed
+//string of the value returned (empty if the function returns void or we stopped
+//before it returned).
+func (debugger *Debugger) Finish(ctx context.Context, vcpu uint32) (StopEvent, string, error) {
+	if !debugger.controller.IsPaused() {
+		return StopEvent{}, "", NotPaused
+	}
+	debugger.resetStop()
+
+	err := debugger.rewindBreakpoint(vcpu)
+	if err != nil {
+		return StopEvent{}, "", err
+	}
+
+	registers, err := debugger.registers.GetRegisters(vcpu)
+	if err != nil {
+		return StopEvent{}, "", err
+	}
+
+	rip, err := registers.GetRegister("rip")
+	if err != nil {
+		return StopEvent{}, "", err
+	}
+
+	function, err := debugger.symbols.GetFunction(rip)
+	if err != nil {
+		return StopEvent{}, "", err
+	}
+
+	//When we return the PC and stack pointer will be the ones of the caller
+	caller, err := debugger.symbols.Unwind(registers.DwarfRegisters(), debugger.memory)
+	if err != nil {
+		return StopEvent{}, "", err
+	}
+
+	reached, err := debugger.runUntil(ctx, vcpu, caller.PC(), caller.SP())
+	if err != nil {
+		return StopEvent{}, "", err
+	}
+
+	registers, err = debugger.registers.GetRegisters(vcpu)
+	if err != nil {
+		return StopEvent{}, "", err
+	}
+
+	rip, err = registers.GetRegister("rip")
+	if err != nil {
+		return StopEvent{}, "", err
+	}
+
+	if !reached {
+		//We've stopped at a breakpoint before the function returned
+		event, err := debugger.breakpointInCall(vcpu, rip)
+		return event, "", err
+	}
+	debugger.lineInfo.IsNewLine(rip)
+	event := debugger.locate(StopEvent{Reason: LocationReached, Address: rip})
+
+	returnType := function.ReturnType()
+	if returnType == nil {
+		return event, "", nil
+	}
+
+	bytes, err := debugger.returnValue(registers, returnType)
+	if err != nil {
+		return StopEvent{}, "", err
+	}
+
+	val, err := debugger.display(returnType, bytes)
+	if err != nil {
+		return StopEvent{}, "", err
+	}
+	return event, fmt.Sprintf("Value returned by %s = %s", function.Name(), val), nil
+}
+
+//returnValue - reads the bytes of the value that has just been returned by a
+//function. This follows the System V AMD64 calling convention, floating point
+//values are returned in xmm0, integers and small structs in rax (and rdx for the
+//upper 8 bytes), anything larger is written to memory with its address in rax.
+func (debugger *Debugger) returnValue(registers Registers, returnType Variable) ([]byte, error) {
+	size := returnType.Size()
+	if debugger.symbols.IsFloat(returnType) {
+		xmm0, err := registers.GetRegister("xmm0")
+		if err != nil {
+			return nil, err
+		}
+		bytes := make([]byte, 8)
+		debugger.endianess.PutUint64(bytes, xmm0)
+		return bytes[:size], nil
+	}
+
+	rax, err := registers.GetRegister("rax")
+	if err != nil {
+		return nil, err
+	}
+
+	if size > 16 {
+		return debugger.memory.Read(rax, uint(size))
+	}
+
+	bytes := make([]byte, 16)
+	debugger.endianess.PutUint64(bytes, rax)
+	if size > 8 {
+		rdx, err := registers.GetRegister("rdx")
+		if err != nil {
+			return nil, err
+		}
+		debugger.endianess.PutUint64(bytes[8:], rdx)
+	}
+	return bytes[:size], nil
+}
+
 //Helper function for reading the contents of variables from memory
 //Note we need the registers in the DWARF format, because we'll need to 
 //evaluate a DWARF expression
@@ -322,89 +920,288 @@ func (debugger *Debugger) GetVariable(name string) (string, error) {
 		return "", NotPaused
 	}
 
-	registers, err := debugger.registers.GetRegisters(0)
+	value, err := debugger.readVariable(name)
 	if err != nil {
 		return "", err
 	}
+	return fmt.Sprintf("%s = %s", name, value.Format(NaturalFormat, debugger.radix)), nil
+}
 
-	rip, err := registers.GetRegister("rip")
-	if err != nil {
-		return "", err
+//Value evaluates a C expression (e.g. p->next->val, arr[i] * 2 or
+//(struct foo *)0x1234) in the selected frame and returns its value as a tree
+func (debugger *Debugger) Value(vcpu uint32, expression string) (*Value, error) {
+	if !debugger.controller.IsPaused() {
+		return nil, NotPaused
 	}
 
-	variable, err := debugger.symbols.GetSymbol(name, rip)
+	frame, err := debugger.selectedFrame(vcpu)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	dregs := registers.DwarfRegisters()
-	bytes, err := debugger.readMemory(variable, dregs)
+	return debugger.symbols.Value(expression, frame.ScopePC(), frame.DwarfRegisters(), debugger.memory)
+}
 
+//Print evaluates a C expression in the selected frame and returns its value as
+//text in the format given (e.g. HexFormat for print/x)
+func (debugger *Debugger) Print(vcpu uint32, expression string, format Format) (string, error) {
+	value, err := debugger.Value(vcpu, expression)
 	if err != nil {
 		return "", err
 	}
+	return fmt.Sprintf("%s = %s", expression, value.Format(format, debugger.radix)), nil
+}
 
-	val, err := variable.Parse(bytes, debugger.endianess)
+//display - returns the text of the value of a variable in the output radix
+func (debugger *Debugger) display(variable Variable, bytes []byte) (string, error) {
+	value, err := debugger.symbols.VariableValue(variable, bytes, debugger.memory)
 	if err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("%s = %s", name, val), nil
+	return value.Format(NaturalFormat, debugger.radix), nil
 }
 
-
-//Dereference returns the content of a point in pretty printed string
-func (debugger *Debugger) Dereference(vcpu uint32, name string) (string, error) {
-	if !debugger.controller.IsPaused() {
-		return "", NotPaused
+//readVariable - returns the value of a variable in the selected frame
+func (debugger *Debugger) readVariable(name string) (*Value, error) {
+	frame, err := debugger.selectedFrame(0)
+	if err != nil {
+		return nil, err
 	}
 
-	registers, err := debugger.registers.GetRegisters(0)
+	variable, err := debugger.symbols.GetSymbol(name, frame.ScopePC())
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	bytes, err := debugger.readMemory(variable, frame.DwarfRegisters())
+	if err != nil {
+		return nil, err
+	}
+	return debugger.symbols.VariableValue(variable, bytes, debugger.memory)
+}
 
-	rip, err := registers.GetRegister("rip")
+//Dereference returns the content of a point in pretty printed string
+func (debugger *Debugger) Dereference(vcpu uint32, name string) (string, error) {
+	pointer, err := debugger.Value(vcpu, name)
 	if err != nil {
 		return "", err
 	}
+	if pointer.Kind != PointerValue {
+		return "", NotPointer
+	}
 
-	variable, err := debugger.symbols.GetSymbol(name, rip)
+	target, err := pointer.Target()
 	if err != nil {
 		return "", err
 	}
+	return fmt.Sprintf("*%s = %s", name, target.Format(NaturalFormat, debugger.radix)), nil
+}
 
-	if !debugger.symbols.IsPointer(variable) {
-		return "", NotPointer
+//Interrupt pauses the VM if it is running (e.g. it was unpaused outside of the
+//debugger) and returns where it was interrupted
+func (debugger *Debugger) Interrupt(vcpu uint32) (StopEvent, error) {
+	if debugger.controller.IsPaused() {
+		return StopEvent{}, fmt.Errorf("Error: the domain is not running")
 	}
+	debugger.resetStop()
 
-	dregs := registers.DwarfRegisters()
-	bytes, err := debugger.readMemory(variable, dregs)
+	err := debugger.controller.Pause()
 	if err != nil {
-		return "", err
+		return StopEvent{}, err
 	}
+	err = debugger.recordTrap(vcpu)
+	if err != nil {
+		return StopEvent{}, err
+	}
+	event, err := debugger.interruptedEvent(vcpu, context.Canceled)
+	if err != nil {
+		return StopEvent{}, err
+	}
+	return debugger.locate(event), nil
+}
 
-	//Since we know the variable is a pointer, we know the content 
-	//of its memory is an address 
-	address := debugger.endianess.Uint64(bytes)
-	size := debugger.symbols.GetPointContentSize(variable)
+//Continues to the next breakpoint or until the VM terminates. Breakpoints
+//whose condition is false are passed over without stopping. Returns why the
+//VM stopped (e.g. the breakpoint hit or the domain shutting down). If the
+//context is cancelled or times out first the VM is paused where it is and
+//an Interrupted or TimedOut event is returned.
+func (debugger *Debugger) Continue(ctx context.Context, vcpu uint32) (StopEvent, error) {
+	if !debugger.controller.IsPaused() {
+		return StopEvent{}, NotPaused
+	}
+	return debugger.continueTo(ctx, vcpu, nil)
+}
 
-	bytes, err = debugger.memory.Read(address, uint(size))
+//continueTo - continues until a breakpoint or watchpoint stops the VM or the
+//destination (if there is one) is reached. The temporary breakpoints used are
+//always removed before returning.
+func (debugger *Debugger) continueTo(ctx context.Context, vcpu uint32, dest *destination) (StopEvent, error) {
+	debugger.resetStop()
+
+	//Watchpoints report changes made since the VM was last stopped
+	err := debugger.refreshWatchpoints()
 	if err != nil {
-		return "", err
+		return StopEvent{}, err
 	}
 
-	val, err := debugger.symbols.ParsePointer(variable, bytes, debugger.endianess)
+	traps, err := debugger.addScopeTraps()
+	if err == nil {
+		err = dest.addTraps(debugger, traps)
+	}
+
+	var event StopEvent
+	if err == nil && debugger.softwareWatching() {
+		event, err = debugger.continueStepping(ctx, vcpu, dest)
+	} else if err == nil {
+		event, err = debugger.continueUntilStop(ctx, vcpu, traps, dest)
+	}
+	if exit, exited := exitEvent(err); exited {
+		//There is no memory left to remove the temporary breakpoints from
+		return exit, nil
+	}
+	if err != nil && err == ctx.Err() {
+		event, err = debugger.interruptedEvent(vcpu, err)
+	}
+
+	for address := range traps {
+		removeErr := debugger.breakpointManager.Remove(address)
+		if err == nil {
+			err = removeErr
+		}
+	}
 	if err != nil {
-		return "", err 
+		return StopEvent{}, err
 	}
-	return fmt.Sprintf("*%s = %s", name, val), nil 
+	return debugger.locate(event), debugger.deleteTemporaryHit(vcpu)
 }
 
-//Continues to the next breakpoint or until the VM terminates
-func (debugger *Debugger) Continue(vcpu uint32) error {
-	if !debugger.controller.IsPaused() {
-		return NotPaused
+func (debugger *Debugger) continueUntilStop(ctx context.Context, vcpu uint32, traps map[uint64]bool, dest *destination) (StopEvent, error) {
+	for {
+		hit, err := debugger.resume(ctx, vcpu)
+		if err != nil {
+			return StopEvent{}, err
+		}
+
+		registers, rip, rsp, err := debugger.stackPosition(vcpu)
+		if err != nil {
+			return StopEvent{}, err
+		}
+
+		if hit != nil && hit.Watch != NoWatch {
+			report, stop, err := debugger.watchpointStops(registers, hit, rip, 0)
+			if err != nil || stop {
+				debugger.lineInfo.IsNewLine(rip)
+				return StopEvent{Reason: WatchpointHit, Breakpoint: hit.ID, Address: rip, Report: report}, err
+			}
+			continue
+		}
+
+		address, trapped := debugger.stoppedOnTrap(rip)
+		if hit != nil {
+			//Hardware breakpoints stop before the instruction is run
+			address = rip
+		} else if !trapped {
+			//None of our breakpoints stopped the VM
+			debugger.lineInfo.IsNewLine(rip)
+			return debugger.unexpectedStop(rip)
+		} else if traps[address] {
+			//We've stopped where the frame of a watchpoint on local variables returns to
+			report, err := debugger.leaveScope(vcpu, registers, address, rsp)
+			if err != nil || report != "" {
+				debugger.lineInfo.IsNewLine(address)
+				return StopEvent{Reason: WatchpointScope, Address: address, Report: report}, err
+			}
+		}
+
+		if dest.reached(address, rsp) {
+			debugger.lineInfo.IsNewLine(address)
+			event := StopEvent{Reason: LocationReached, Address: address}
+			if hit != nil {
+				return event, nil
+			}
+			//The temporary breakpoint is removed once we stop so the PC is
+			//moved back to run the instruction it overwrote
+			return event, debugger.moveTo(vcpu, registers, address)
+		}
+		if hit == nil && traps[address] && debugger.breakpointManager.At(address) == nil {
+			continue
+		}
+
+		breakpoint := hit
+		if breakpoint == nil {
+			breakpoint = debugger.breakpointManager.At(address)
+		}
+		if breakpoint == nil {
+			//Bit of hack, just update where we are in the executable so
+			//we can display it to the end user
+			debugger.lineInfo.IsNewLine(rip)
+			return debugger.unexpectedStop(rip)
+		}
+
+		stop, err := debugger.hitStops(registers, breakpoint, address)
+		if err != nil || stop {
+			debugger.lineInfo.IsNewLine(rip)
+			return breakpointEvent(breakpoint, address), err
+		}
+	}
+}
+
+//breakpointStops - checks whether the breakpoint at the address should stop the
+//VM. The condition (evaluated in the innermost frame) must be true and the
+//ignore count used up. Returns true for addresses without a user's breakpoint.
+func (debugger *Debugger) breakpointStops(registers Registers, address uint64) (bool, error) {
+	breakpoint := debugger.breakpointManager.At(address)
+	if breakpoint == nil {
+		return true, nil
+	}
+	return debugger.hitStops(registers, breakpoint, address)
+}
+
+//hitStops - checks whether a breakpoint or watchpoint that has just been hit
+//should stop the VM (the condition is evaluated with the PC given)
+func (debugger *Debugger) hitStops(registers Registers, breakpoint *Breakpoint, address uint64) (bool, error) {
+	if breakpoint.Condition != "" {
+		frame := &Frame{PC: address, live: registers, symbols: debugger.symbols}
+		holds, err := debugger.symbols.Condition(breakpoint.Condition, address, frame.DwarfRegisters(), debugger.memory)
+		if err != nil {
+			return true, fmt.Errorf("Error: could not evaluate the condition %s of breakpoint %d (%s)", breakpoint.Condition, breakpoint.ID, err)
+		}
+		if !holds {
+			return false, nil
+		}
+	}
+
+	breakpoint.Hits += 1
+	if breakpoint.Ignore > 0 {
+		breakpoint.Ignore -= 1
+		return false, nil
+	}
+	if breakpoint.Format != "" {
+		//dprintf breakpoints print their values and let the VM carry on
+		return false, debugger.dprintf(breakpoint)
+	}
+	debugger.stoppedBy = breakpoint
+	return true, nil
+}
+
+//resume - unpauses the VM and waits until it stops again. If we are sat on
+//a breakpoint the original instruction is run first. Returns the hardware
+//breakpoint or watchpoint that stopped the VM (if it was one).
+func (debugger *Debugger) resume(ctx context.Context, vcpu uint32) (*Breakpoint, error) {
+	err := debugger.stepOffBreakpoint(ctx, vcpu)
+	if err != nil {
+		return nil, err
+	}
+
+	//Makes sure we don't break on each new instruction
+	err = debugger.singleStep(vcpu, false)
+	if err != nil {
+		return nil, err
 	}
+	return debugger.run(ctx, vcpu, armAll)
+}
 
+//stepOffBreakpoint - if we are sat on a breakpoint the instruction under it
+//is run so that resuming doesn't stop at the same breakpoint again
+func (debugger *Debugger) stepOffBreakpoint(ctx context.Context, vcpu uint32) error {
 	registers, err := debugger.registers.GetRegisters(vcpu)
 	if err != nil {
 		return err 
@@ -417,10 +1214,10 @@ func (debugger *Debugger) Continue(vcpu uint32) error {
 
 	//If we've been paused because breakpoint we need to carefully
 	//restore the instruction we broke
-	if debugger.breakpointManager.AddressIsBreakpoint(rip-1) {
+	if address, trapped := debugger.stoppedOnTrap(rip); trapped {
 
 		//Rollback to the start of the instruction we broke 
-		rip -= 1
+		rip = address
 		err = debugger.breakpointManager.RestoreInstruction(rip)
 		if err != nil {
 			return err
@@ -447,116 +1244,314 @@ func (debugger *Debugger) Continue(vcpu uint32) error {
 			return err
 		}
 
-		for !debugger.controller.IsPaused() {}
-		
-		err = debugger.breakpointManager.RestoreBreakpoint()
-		registers, err = debugger.registers.GetRegisters(vcpu)
+		err = debugger.waitForStop(ctx)
+		if err != nil && err == ctx.Err() {
+			return debugger.abandonStep(vcpu, err)
+		}
 		if err != nil {
-			return err 
+			return err
 		}
+
+		err = debugger.recordTrap(vcpu)
+		if err != nil {
+			return err
+		}
+		return debugger.breakpointManager.RestoreBreakpoint()
+	} else if debugger.breakpointManager.AddressIsBreakpoint(rip) || debugger.onHardwareBreakpoint(rip) {
+		//We've stepped onto a breakpoint (e.g. by using next) without
+		//executing it or stopped at a hardware breakpoint (these stop
+		//before the instruction is run), so we run the instruction first
+		return debugger.stepInstruction(ctx, vcpu)
 	}
+	return nil
+}
 
+//location is a place in the program that execution can be stopped at
+type location struct {
+	addresses []uint64
+	filename  string
+	line      int
+}
 
-	//Makes sure we don't break on each new instruction
-	err = debugger.singleStep(vcpu, false)
+//String - formats the location as file.c:line (or the address if there is
+//no line information)
+func (place location) String() string {
+	if place.filename == "" {
+		return fmt.Sprintf("*0x%x", place.addresses[0])
+	}
+	return fmt.Sprintf("%s:%d", place.filename, place.line)
+}
+
+//resolveLocation - converts a location written as file.c:line, the name of a
+//function or *address into the addresses to stop at. Breakpoints on functions
+//go after the prologue so the arguments can be read straight away.
+func (debugger *Debugger) resolveLocation(spec string) (location, error) {
+	if strings.HasPrefix(spec, "*") {
+		address, err := strconv.ParseUint(spec[1:], 0, 64)
+		if err != nil {
+			return location{}, fmt.Errorf("Error: %s is not a valid address", spec[1:])
+		}
+		//Code such as assembly stubs may not have any line information
+		filename, line, _ := debugger.lineInfo.AddressToLine(address)
+		return location{addresses: []uint64{address}, filename: filename, line: line}, nil
+	}
+
+	if separator := strings.LastIndex(spec, ":"); separator >= 0 {
+		filename := spec[:separator]
+		line, err := strconv.Atoi(spec[separator+1:])
+		if err != nil {
+			return location{}, fmt.Errorf("Error: %s is not an integer and cannot be used as a line number", spec[separator+1:])
+		}
+
+		//Lines without any code (e.g. comments) are moved on to the next line that has some
+		addresses, used := debugger.lineInfo.LineAddresses(filename, line)
+		if len(addresses) == 0 {
+			return location{}, fmt.Errorf("Error: could not set breakpoint @ %s:%d (there is no code at or after this line)", filename, line)
+		}
+		return location{addresses: addresses, filename: filename, line: used}, nil
+	}
+
+	function, err := debugger.symbols.LookupFunction(spec)
 	if err != nil {
-		return err
+		return location{}, fmt.Errorf("Error: no function named %s", spec)
+	}
+	address := debugger.lineInfo.SkipPrologue(function.Range())
+	filename, line, _ := debugger.lineInfo.AddressToLine(address)
+	return location{addresses: []uint64{address}, filename: filename, line: line}, nil
+}
+
+//BreakAt sets a breakpoint at a location written as file.c:line, the name of a
+//function or *address and returns its number along with where it was actually
+//set (a line without code moves to the next line). If the condition isn't empty the
+//breakpoint only stops the VM when the condition (a C expression) is true.
+func (debugger *Debugger) BreakAt(spec string, condition string, vcpu uint32) (int, string, error) {
+	return debugger.breakAt(spec, condition, debugger.breakpointManager.Create)
+}
+
+//HardwareBreakAt is the same as BreakAt but the breakpoint uses the debug registers
+//of the CPU instead of writing a break instruction into the memory of the VM. Only
+//four addresses can be used at once.
+func (debugger *Debugger) HardwareBreakAt(spec string, condition string, vcpu uint32) (int, string, error) {
+	return debugger.breakAt(spec, condition, debugger.breakpointManager.CreateHardware)
+}
+
+//TemporaryBreakAt is the same as BreakAt but the breakpoint is deleted the first
+//time it stops the VM
+func (debugger *Debugger) TemporaryBreakAt(spec string, condition string, vcpu uint32) (int, string, error) {
+	return debugger.breakAt(spec, condition, debugger.breakpointManager.CreateTemporary)
+}
+
+func (debugger *Debugger) breakAt(spec string, condition string, create func([]uint64, string, int) (*Breakpoint, error)) (int, string, error) {
+	if condition != "" {
+		err := debugger.symbols.CheckExpression(condition)
+		if err != nil {
+			return 0, "", err
+		}
+	}
+
+	if !debugger.controller.IsPaused() {
+		return 0, "", NotPaused
 	}
 
-	err = debugger.controller.Unpause()
+	place, err := debugger.resolveLocation(spec)
 	if err != nil {
-		return err
+		return 0, "", err
 	}
 
-	//Busy wait until we hit the next breakpoint
-	for !debugger.controller.IsPaused() {
+	breakpoint, err := create(place.addresses, place.filename, place.line)
+	if err != nil {
+		return 0, "", err
 	}
+	breakpoint.Condition = condition
+	return breakpoint.ID, place.String(), nil
+}
 
+//SetBreakpoint sets a breakpoint at specific point in the source and
+//returns its number
+func (debugger *Debugger) SetBreakpoint(filename string, line int, vcpu uint32) (int, error) {
+	id, _, err := debugger.BreakAt(fmt.Sprintf("%s:%d", filename, line), "", vcpu)
+	return id, err
+}
 
-	registers, err = debugger.registers.GetRegisters(vcpu)
+//SetConditionalBreakpoint sets a breakpoint which only stops the VM when the
+//condition (a C expression evaluated in the current frame) is true
+func (debugger *Debugger) SetConditionalBreakpoint(filename string, line int, condition string, vcpu uint32) (int, error) {
+	id, _, err := debugger.BreakAt(fmt.Sprintf("%s:%d", filename, line), condition, vcpu)
+	return id, err
+}
+
+//Functions returns the names of the functions in the program
+func (debugger *Debugger) Functions() []string {
+	return debugger.symbols.Functions()
+}
+
+//liftBreakpoint - removes the break instruction of a breakpoint. If we've just
+//stopped at it the PC is moved back so the original instruction gets run.
+func (debugger *Debugger) liftBreakpoint(vcpu uint32, breakpoint *Breakpoint, lift func(int) error) error {
+	registers, err := debugger.registers.GetRegisters(vcpu)
 	if err != nil {
 		return err 
 	}
 
-	rip, err = registers.GetRegister("rip")
+	rip, err := registers.GetRegister("rip")
 	if err != nil {
 		return err 
 	}
 
-	//Bit of hack, just update where we are in the executable so
-	//we can display it to the end user
-	debugger.lineInfo.IsNewLine(rip)
+	//Hardware breakpoints don't move the PC past the address
+	trap, trapped := debugger.stoppedOnTrap(rip)
+	stoppedAt := false
+	for _, address := range breakpoint.Addresses {
+		stoppedAt = stoppedAt || (trapped && breakpoint.Enabled && !breakpoint.Hardware && trap == address)
+	}
+	err = lift(breakpoint.ID)
+	if err != nil {
+		return err
+	}
 
+	if stoppedAt {
+		err = registers.SetRegister("rip", rip-1)
+		if err != nil {
+			return err
+		}
+		return debugger.registers.SetRegisters(vcpu, registers)
+	}
 	return nil
 }
 
-//SetBreakpoint sets a breakpoint at specific point in the source 
-func (debugger *Debugger) SetBreakpoint(filename string, line int, vcpu uint32) error {
+//RemoveBreakpoints removes the breakpoint at a line from the VM
+//(the same as deleting it by its number)
+func (debugger *Debugger) RemoveBreakpoint(filename string, line int, vcpu uint32) error {
 	if !debugger.controller.IsPaused() {
 		return NotPaused
 	}
 
-	address := debugger.lineInfo.Address(filename, line)
-
-	//If the address is zero we're either trying to set a breakpoint 
-	//on an empty line or during the preamble. 
-	if address == 0 {
-		return fmt.Errorf("Error: could not set breakpoint @ %s:%d (most likely empty line or comment)", filename, line)
+	addresses, _ := debugger.lineInfo.LineAddresses(filename, line)
+	if len(addresses) == 0 {
+		return fmt.Errorf("Error: there is no code at %s:%d", filename, line)
 	}
-
-	err := debugger.breakpointManager.Add(address)
-	return err
+	breakpoint := debugger.breakpointManager.At(addresses[0])
+	if breakpoint == nil {
+		return BreakPointError{Address: addresses[0], errType: NotFound}
+	}
+	return debugger.liftBreakpoint(vcpu, breakpoint, debugger.breakpointManager.Delete)
 }
 
-//RemoveBreakpoints removes a breakpoint from the VM
-func (debugger *Debugger) RemoveBreakpoint(filename string, line int, vcpu uint32) error {
+//DeleteBreakpoint removes the breakpoint with the number given
+func (debugger *Debugger) DeleteBreakpoint(id int, vcpu uint32) error {
 	if !debugger.controller.IsPaused() {
 		return NotPaused
 	}
 
-	address := debugger.lineInfo.Address(filename, line)
-
-	registers, err := debugger.registers.GetRegisters(vcpu)
+	breakpoint, err := debugger.breakpointManager.Lookup(id)
 	if err != nil {
-		return err 
+		return err
 	}
+	return debugger.liftBreakpoint(vcpu, breakpoint, debugger.breakpointManager.Delete)
+}
 
-	rip, err := registers.GetRegister("rip")
+//DisableBreakpoint stops the breakpoint with the number given from being
+//hit without deleting it
+func (debugger *Debugger) DisableBreakpoint(id int, vcpu uint32) error {
+	if !debugger.controller.IsPaused() {
+		return NotPaused
+	}
+
+	breakpoint, err := debugger.breakpointManager.Lookup(id)
 	if err != nil {
-		return err 
+		return err
 	}
+	return debugger.liftBreakpoint(vcpu, breakpoint, debugger.breakpointManager.Disable)
+}
 
-	wasBreakpoint := debugger.breakpointManager.AddressIsBreakpoint(rip-1) 
+//EnableBreakpoint puts back a breakpoint which has been disabled
+func (debugger *Debugger) EnableBreakpoint(id int, vcpu uint32) error {
+	if !debugger.controller.IsPaused() {
+		return NotPaused
+	}
+	return debugger.breakpointManager.Enable(id)
+}
 
-	err = debugger.breakpointManager.Remove(address)
-	
-	//Just make sure we execute the instruction that was overwritten by
-	//the breakpoint
-	if wasBreakpoint {
-		rip -= 1
-		err = registers.SetRegister("rip", rip)
-		if err != nil {
-			return err
-		}
-		err = debugger.registers.SetRegisters(vcpu, registers)
-		if err != nil {
-			return err
-		} 
+//IgnoreBreakpoint makes the breakpoint with the number given pass over
+//its next count hits
+func (debugger *Debugger) IgnoreBreakpoint(id int, count int) error {
+	if count < 0 {
+		return fmt.Errorf("Error: cannot ignore a breakpoint a negative number of times")
 	}
 
+	breakpoint, err := debugger.breakpointManager.Lookup(id)
+	if err != nil {
+		return err
+	}
+	breakpoint.Ignore = count
 	return nil
 }
 
-//ListBreakpoints - returns a formatted list of the breakpoints that have been set
+//Breakpoints returns a copy of each of the breakpoints and watchpoints
+//that have been set ordered by their number
+func (debugger *Debugger) Breakpoints() []Breakpoint {
+	var breakpoints []Breakpoint
+	for _, breakpoint := range debugger.breakpointManager.List() {
+		breakpoints = append(breakpoints, *breakpoint)
+	}
+	return breakpoints
+}
+
+//ListBreakpoints - returns a formatted table of the breakpoints that have been set
 func (debugger *Debugger) ListBreakpoints() string {
-	addresses := debugger.breakpointManager.Addresses()
-	var formattedList string
-	for _, address := range addresses {
-		filename, line, _ := debugger.lineInfo.AddressToLine(address)
-		formattedList = fmt.Sprintf("%s0x%x (%s:%d)\n", formattedList, address, filename, line)
+	breakpoints := debugger.breakpointManager.List()
+	if len(breakpoints) == 0 {
+		return "No breakpoints have been set!"
 	}
-	if len(formattedList) == 0 {
-		formattedList = "No breakpoints have been set!"
+
+	formattedList := "Num  Enabled  Address  What"
+	for _, breakpoint := range breakpoints {
+		enabled := "n"
+		if breakpoint.Enabled {
+			enabled = "y"
+		}
+		what := fmt.Sprintf("%s:%d", breakpoint.Filename, breakpoint.Line)
+		if breakpoint.Watch != NoWatch && !breakpoint.Hardware {
+			what = fmt.Sprintf("sw watchpoint %s", breakpoint.Expression)
+		} else if breakpoint.Watch != NoWatch {
+			what = fmt.Sprintf("%s %s", breakpoint.Watch, breakpoint.Expression)
+		} else if breakpoint.Filename == "" {
+			what = "<no line information>"
+		}
+		//Software watchpoints aren't tied to an address
+		address := fmt.Sprintf("%-8s", "")
+		if len(breakpoint.Addresses) > 0 {
+			address = fmt.Sprintf("0x%-6x", breakpoint.Addresses[0])
+		}
+		formattedList = fmt.Sprintf("%s\n%-4d %-8s %s %s", formattedList, breakpoint.ID, enabled, address, what)
+		if len(breakpoint.Addresses) > 1 {
+			var addresses []string
+			for _, address := range breakpoint.Addresses {
+				addresses = append(addresses, fmt.Sprintf("0x%x", address))
+			}
+			formattedList = fmt.Sprintf("%s\n\tset at %d addresses: %s", formattedList, len(addresses), strings.Join(addresses, ", "))
+		}
+		if breakpoint.Hardware && breakpoint.Watch == NoWatch {
+			formattedList = fmt.Sprintf("%s\n\thardware breakpoint", formattedList)
+		}
+		if breakpoint.Temporary {
+			formattedList = fmt.Sprintf("%s\n\ttemporary breakpoint (deleted once hit)", formattedList)
+		}
+		if breakpoint.Condition != "" {
+			formattedList = fmt.Sprintf("%s\n\tstop only if %s", formattedList, breakpoint.Condition)
+		}
+		if breakpoint.Hits > 0 {
+			formattedList = fmt.Sprintf("%s\n\tbreakpoint already hit %d time(s)", formattedList, breakpoint.Hits)
+		}
+		if breakpoint.Ignore > 0 {
+			formattedList = fmt.Sprintf("%s\n\twill ignore next %d crossing(s) of breakpoint", formattedList, breakpoint.Ignore)
+		}
+		if breakpoint.Format != "" {
+			formattedList = fmt.Sprintf("%s\n\tprintf %s", formattedList, strings.Join(append([]string{strconv.Quote(breakpoint.Format)}, breakpoint.Args...), ", "))
+		}
+		for _, command := range breakpoint.Commands {
+			formattedList = fmt.Sprintf("%s\n\t\t%s", formattedList, command)
+		}
 	}
 	return formattedList
-}
\ No newline at end of file
+}
@@ -1,7 +1,13 @@
 package debugger_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 	"encoding/binary"
 
 	"github.com/StardustOS/duster/debugger"
@@ -37,14 +43,16 @@ func TestStep(t *testing.T) {
 		dummyRegisters.EXPECT().GetRegister("rflags").Return(uint64(0x0), nil),
 		dummyRegisters.EXPECT().SetRegister("rflags", uint64(256)).Return(nil),
 		regs.EXPECT().SetRegisters(vcpu, dummyRegisters).Return(nil),
-		cntrl.EXPECT().IsPaused().Return(true),
+		cntrl.EXPECT().WaitForStop(gomock.Any()).Return(debugger.DomainState{Paused: true}, nil),
 		regs.EXPECT().GetRegisters(vcpu).Return(dummyRegisters, nil),
 		dummyRegisters.EXPECT().GetRegister("rip").Return(rip, nil),
 		lineInfo.EXPECT().IsNewLine(rip).Return(true),
 		cntrl.EXPECT().Unpause().Return(nil),
+		lineInfo.EXPECT().AddressToLine(rip).Return("test.c", 4, nil),
 	)
-	err := dbg.Step(vcpu)
+	event, err := dbg.Step(context.Background(), vcpu)
 	assert.Nil(t, err)
+	assert.Equal(t, "Stepped to test.c:4", event.String())
 }
 
 //Step should return an error if the VM isn't paused
@@ -56,7 +64,7 @@ func TestStepNotPaused(t *testing.T) {
 	gomock.InOrder(
 		cntrl.EXPECT().IsPaused().Return(false),
 	)
-	err := dbg.Step(vcpu)
+	_, err := dbg.Step(context.Background(), vcpu)
 	assert.NotNil(t, err)
 	assert.Equal(t, debugger.NotPaused, err)
 }
@@ -72,11 +80,11 @@ func TestAddBreakpoint(t *testing.T) {
 	line := 3
 	gomock.InOrder(
 		cntrl.EXPECT().IsPaused().Return(true),
-		lineInfo.EXPECT().Address(filename, line).Return(address),
+		lineInfo.EXPECT().LineAddresses(filename, line).Return([]uint64{address}, line),
 		mem.EXPECT().Read(address, uint(1)).Return([]byte{0x1}, nil),
 		mem.EXPECT().Write(address, []byte{0xCC}, uint(1)).Return(nil),
 	)
-	err := dbg.SetBreakpoint(filename, line, vcpu)
+	_, err := dbg.SetBreakpoint(filename, line, vcpu)
 	assert.Nil(t, err)
 }
 
@@ -89,7 +97,7 @@ func TestAddBreakpointNotPaused(t *testing.T) {
 	gomock.InOrder(
 		cntrl.EXPECT().IsPaused().Return(false),
 	)
-	err := dbg.SetBreakpoint("startup.c", 10, vcpu)
+	_, err := dbg.SetBreakpoint("startup.c", 10, vcpu)
 	assert.NotNil(t, err)
 	assert.Equal(t, debugger.NotPaused, err)
 }
@@ -107,14 +115,14 @@ func TestRemoveBreakpoint(t *testing.T) {
 	line := 3
 	gomock.InOrder(
 		cntrl.EXPECT().IsPaused().Return(true),
-		lineInfo.EXPECT().Address(filename, line).Return(address),
+		lineInfo.EXPECT().LineAddresses(filename, line).Return([]uint64{address}, line),
 		mem.EXPECT().Read(address, uint(1)).Return([]byte{0x1}, nil),
 		mem.EXPECT().Write(address, []byte{0xCC}, uint(1)).Return(nil),
 		cntrl.EXPECT().IsPaused().Return(true),
-		lineInfo.EXPECT().Address(filename, line).Return(address),
+		lineInfo.EXPECT().LineAddresses(filename, line).Return([]uint64{address}, line),
 		mem.EXPECT().Write(address, []byte{0x1}, uint(1)).Return(nil),
 	)
-	err := dbg.SetBreakpoint(filename, line, vcpu)
+	_, err := dbg.SetBreakpoint(filename, line, vcpu)
 	assert.Nil(t, err)
 	err = dbg.RemoveBreakpoint(filename, line, vcpu)
 	assert.Nil(t, err)
@@ -151,10 +159,10 @@ func TestContinue(t *testing.T) {
 		dummyRegisters.EXPECT().SetRegister("rflags", uint64(0)).Return(nil),
 		regs.EXPECT().SetRegisters(vcpu, dummyRegisters).Return(nil),
 		cntrl.EXPECT().Unpause().Return(nil),
-		cntrl.EXPECT().IsPaused().Return(true),
+		cntrl.EXPECT().WaitForStop(gomock.Any()).Return(debugger.DomainState{Paused: true}, nil),
 	)
 
-	err := dbg.Continue(vcpu)
+	_, err := dbg.Continue(context.Background(), vcpu)
 	assert.Nil(t, err)
 }
 
@@ -167,7 +175,7 @@ func TestContinueNotPaused(t *testing.T) {
 	gomock.InOrder(
 		cntrl.EXPECT().IsPaused().Return(false),
 	)
-	err := dbg.Continue(vcpu)
+	_, err := dbg.Continue(context.Background(), vcpu)
 	assert.NotNil(t, err)
 	assert.Equal(t, debugger.NotPaused, err)
 }
@@ -197,10 +205,11 @@ func TestGetVariable(t *testing.T) {
 		dummyRegisters.EXPECT().GetRegister("rip").Return(rip, nil),
 		sym.EXPECT().GetSymbol(varName, rip).Return(variable, nil),
 		dummyRegisters.EXPECT().DwarfRegisters().Return(&op.DwarfRegisters{}),
+		sym.EXPECT().SetCFA(gomock.Any()).Return(nil),
 		variable.EXPECT().Location().Return(location),
 		variable.EXPECT().Size().Return(size),
 		mem.EXPECT().Read(address, uint(size)).Return(content, nil),
-		variable.EXPECT().Parse(content, binary.LittleEndian).Return("50", nil),
+		sym.EXPECT().VariableValue(variable, content, mem).Return(intValue([]byte{50, 0, 0, 0}), nil),
 	)
 	val, err := dbg.GetVariable("myvar")
 	assert.Nil(t, err)
@@ -220,47 +229,104 @@ func TestGetVariableNotPaused(t *testing.T) {
 	assert.Equal(t, debugger.NotPaused, err)
 }
 
+//intValue - returns the value of an int (or long) stored in bytes
+func intValue(bytes []byte) *debugger.Value {
+	return &debugger.Value{Kind: debugger.SignedValue, Type: "int", Bytes: bytes, Endianess: binary.LittleEndian}
+}
+
+//Tests Print evaluates the expression in the selected frame and renders its value
+func TestPrint(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, _, regs, sym, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+	dregs := &op.DwarfRegisters{}
+	value := &debugger.Value{Name: "p->values[1] * 2", Kind: debugger.SignedValue, Type: "int", Bytes: []byte{4, 0, 0, 0}, Endianess: binary.LittleEndian}
+
+	gomock.InOrder(
+		cntrl.EXPECT().IsPaused().Return(true),
+		regs.EXPECT().GetRegisters(uint32(0)).Return(dummyRegisters, nil),
+		dummyRegisters.EXPECT().GetRegister("rip").Return(uint64(0x33), nil),
+		dummyRegisters.EXPECT().DwarfRegisters().Return(dregs),
+		sym.EXPECT().SetCFA(dregs).Return(nil),
+		sym.EXPECT().Value("p->values[1] * 2", uint64(0x33), dregs, mem).Return(value, nil),
+	)
+	val, err := dbg.Print(0, "p->values[1] * 2", debugger.NaturalFormat)
+	assert.Nil(t, err)
+	assert.Equal(t, "p->values[1] * 2 = 4", val)
+
+	cntrl.EXPECT().IsPaused().Return(false)
+	_, err = dbg.Value(0, "p->values[1] * 2")
+	assert.Equal(t, debugger.NotPaused, err)
+}
+
+//Tests the output radix is used to print values unless a format is given
+func TestOutputRadix(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, _, regs, sym, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+
+	assert.NotNil(t, dbg.SetOutputRadix(2))
+	assert.Equal(t, 10, dbg.OutputRadix())
+	assert.Nil(t, dbg.SetOutputRadix(16))
+	assert.Equal(t, 16, dbg.OutputRadix())
+
+	cntrl.EXPECT().IsPaused().Return(true).AnyTimes()
+	regs.EXPECT().GetRegisters(uint32(0)).Return(dummyRegisters, nil).AnyTimes()
+	dummyRegisters.EXPECT().GetRegister("rip").Return(uint64(0x33), nil).AnyTimes()
+	dummyRegisters.EXPECT().DwarfRegisters().Return(&op.DwarfRegisters{}).AnyTimes()
+	sym.EXPECT().SetCFA(gomock.Any()).Return(nil).AnyTimes()
+	sym.EXPECT().Value("flags", uint64(0x33), gomock.Any(), mem).Return(intValue([]byte{0xff, 0, 0, 0}), nil).AnyTimes()
+
+	val, err := dbg.Print(0, "flags", debugger.NaturalFormat)
+	assert.Nil(t, err)
+	assert.Equal(t, "flags = 0xff", val)
+	val, err = dbg.Print(0, "flags", debugger.BinaryFormat)
+	assert.Nil(t, err)
+	assert.Equal(t, "flags = 11111111", val)
+}
+
 //Test Derefence works correctly
 func TestDereference(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
 	mem, cntrl, _, regs, sym, dbg := setup(mockCtrl)
-	variable := mocks.NewMockVariable(mockCtrl)
 	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+	dregs := &op.DwarfRegisters{}
 
-	vcpu := uint32(0)
-	varName := "myvar"
-	rip := uint64(0x33)
-	address := uint64(0x492384)
-	bytes := make([]byte, 8)
-	binary.LittleEndian.PutUint64(bytes, address)
-	size := 5
-	c := uint64(2392)
+	pointer := &debugger.Value{Name: "myvar", Kind: debugger.PointerValue, Type: "long *", Bytes: []byte{0x84, 0x23, 0x49, 0, 0, 0, 0, 0}, Endianess: binary.LittleEndian}
+	pointer.SetTarget(func() (*debugger.Value, error) {
+		content, err := mem.Read(0x492384, 8)
+		return &debugger.Value{Name: "*myvar", Kind: debugger.SignedValue, Type: "long", Bytes: content, Endianess: binary.LittleEndian}, err
+	})
 	content := make([]byte, 8)
-	binary.LittleEndian.PutUint64(content, c)
-	location := []byte{0x03}
-	//Note the DWARF expression just says 0x492384 is a literal address
-	location = append(location, bytes...)
+	binary.LittleEndian.PutUint64(content, 2392)
 
 	gomock.InOrder(
 		cntrl.EXPECT().IsPaused().Return(true),
-		regs.EXPECT().GetRegisters(vcpu).Return(dummyRegisters, nil),
-		dummyRegisters.EXPECT().GetRegister("rip").Return(rip, nil),
-		sym.EXPECT().GetSymbol(varName, rip).Return(variable, nil),
-		sym.EXPECT().IsPointer(variable).Return(true),
-		dummyRegisters.EXPECT().DwarfRegisters().Return(&op.DwarfRegisters{}),
-		variable.EXPECT().Location().Return(location),
-		variable.EXPECT().Size().Return(size),
-		mem.EXPECT().Read(address, uint(size)).Return(content, nil),
-		sym.EXPECT().GetPointContentSize(variable).Return(len(content)),
-		mem.EXPECT().Read(uint64(2392), uint(len(content))).Return(content, nil),
-		sym.EXPECT().ParsePointer(variable, content, binary.LittleEndian).Return("0x21241", nil),
+		regs.EXPECT().GetRegisters(uint32(0)).Return(dummyRegisters, nil),
+		dummyRegisters.EXPECT().GetRegister("rip").Return(uint64(0x33), nil),
+		dummyRegisters.EXPECT().DwarfRegisters().Return(dregs),
+		sym.EXPECT().SetCFA(dregs).Return(nil),
+		sym.EXPECT().Value("myvar", uint64(0x33), dregs, mem).Return(pointer, nil),
+		mem.EXPECT().Read(uint64(0x492384), uint(8)).Return(content, nil),
 	)
 
-	m, err := dbg.Dereference(0, varName)
+	m, err := dbg.Dereference(0, "myvar")
 	assert.Nil(t, err)
-	assert.Equal(t, m, "*myvar = 0x21241")
+	assert.Equal(t, "*myvar = 2392", m)
+
+	//Only pointers can be dereferenced
+	cntrl.EXPECT().IsPaused().Return(true)
+	regs.EXPECT().GetRegisters(uint32(0)).Return(dummyRegisters, nil)
+	dummyRegisters.EXPECT().GetRegister("rip").Return(uint64(0x33), nil)
+	dummyRegisters.EXPECT().DwarfRegisters().Return(dregs)
+	sym.EXPECT().SetCFA(dregs).Return(nil)
+	sym.EXPECT().Value("total", uint64(0x33), dregs, mem).Return(intValue(content), nil)
+	_, err = dbg.Dereference(0, "total")
+	assert.Equal(t, debugger.NotPointer, err)
 }
 
 //Test the Dereference will not work when the VM is running
@@ -275,3 +341,1564 @@ func TestDereferencePaused(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Equal(t, debugger.NotPaused, err)
 }
+
+//state is a snapshot of the registers when the VM pauses
+type state struct {
+	rip uint64
+	rsp uint64
+	rbp uint64
+	rax uint64
+	//dr6 is set when a debug register stopped the VM
+	dr6 uint64
+	//store holds bytes written to memory by the VM before it paused
+	store map[uint64]byte
+	//exit is set when the domain shuts down or crashes instead of pausing
+	exit *debugger.DomainState
+}
+
+//machine simulates a VM running through a fixed trace of states. Each
+//time the VM is unpaused it moves on to the next state of the trace.
+type machine struct {
+	t         *testing.T
+	trace     []state
+	current   int
+	registers map[string]uint64
+	memory    map[uint64]byte
+	lines     map[uint64]int
+	line      int
+	//dr7 records the value of DR7 each time the VM was unpaused
+	dr7 []uint64
+}
+
+func newMachine(t *testing.T, trace []state, lines map[uint64]int) *machine {
+	m := &machine{t: t, trace: trace, lines: lines, memory: make(map[uint64]byte)}
+	m.load(trace[0])
+	return m
+}
+
+func (m *machine) load(s state) {
+	//The debug registers keep their values while the VM runs
+	previous := m.registers
+	m.registers = map[string]uint64{"rip": s.rip, "rsp": s.rsp, "rbp": s.rbp, "rax": s.rax, "dr6": s.dr6}
+	for _, name := range []string{"dr0", "dr1", "dr2", "dr3", "dr7"} {
+		m.registers[name] = previous[name]
+	}
+	for address, b := range s.store {
+		m.memory[address] = b
+	}
+}
+
+func (m *machine) unpause() error {
+	m.dr7 = append(m.dr7, m.registers["dr7"])
+	m.current += 1
+	if m.current >= len(m.trace) {
+		m.t.Fatalf("Error: VM ran past the end of the trace")
+	}
+	m.load(m.trace[m.current])
+	return nil
+}
+
+func (m *machine) isPaused() bool {
+	return m.trace[m.current].exit == nil
+}
+
+func (m *machine) state() (debugger.DomainState, error) {
+	if exit := m.trace[m.current].exit; exit != nil {
+		return *exit, nil
+	}
+	return debugger.DomainState{Paused: true}, nil
+}
+
+func (m *machine) waitForStop(ctx context.Context) (debugger.DomainState, error) {
+	return m.state()
+}
+
+func (m *machine) getRegister(name string) (uint64, error) {
+	return m.registers[name], nil
+}
+
+func (m *machine) setRegister(name string, value uint64) error {
+	m.registers[name] = value
+	return nil
+}
+
+//dwarfRegisters follows the convention of the xen package where the
+//CFA sits just above the saved frame pointer and return address
+func (m *machine) dwarfRegisters() *op.DwarfRegisters {
+	regs := callerRegisters(m.registers["rip"], m.registers["rsp"])
+	regs.AddReg(6, op.DwarfRegisterFromUint64(m.registers["rbp"]))
+	regs.CFA = int64(m.registers["rbp"]) + 16
+	regs.FrameBase = regs.CFA
+	return regs
+}
+
+func (m *machine) read(address uint64, size uint) ([]byte, error) {
+	bytes := make([]byte, size)
+	for i := range bytes {
+		bytes[i] = m.memory[address+uint64(i)]
+	}
+	return bytes, nil
+}
+
+func (m *machine) write(address uint64, bytes []byte, size uint) error {
+	for i := uint(0); i < size; i++ {
+		m.memory[address+uint64(i)] = bytes[i]
+	}
+	return nil
+}
+
+func (m *machine) writeWord(address, value uint64) {
+	bytes := make([]byte, 8)
+	binary.LittleEndian.PutUint64(bytes, value)
+	m.write(address, bytes, 8)
+}
+
+func (m *machine) isNewLine(rip uint64) bool {
+	line, ok := m.lines[rip]
+	if !ok {
+		return false
+	}
+	changed := line != m.line
+	m.line = line
+	return changed
+}
+
+//addressToLine looks an address up in the lines of the machine (which
+//are all in test.c)
+func (m *machine) addressToLine(address uint64) (string, int, error) {
+	line, ok := m.lines[address]
+	if !ok {
+		return "", 0, errors.New("no line information")
+	}
+	return "test.c", line, nil
+}
+
+//attachLines wires AddressToLine up to the lines of the machine
+func (m *machine) attachLines(lineInfo *mocks.MockLineInformation) {
+	lineInfo.EXPECT().AddressToLine(gomock.Any()).DoAndReturn(m.addressToLine).AnyTimes()
+}
+
+//attachFrames makes the symbols keep the CFA the registers of the machine
+//guess from the frame pointer (as if the call frame information agreed)
+func (m *machine) attachFrames(sym *mocks.MockSymbol) {
+	sym.EXPECT().SetCFA(gomock.Any()).Return(nil).AnyTimes()
+}
+
+//attach wires the machine up to the mocks used by the debugger
+func (m *machine) attach(mem *mocks.MockMemoryAccess, cntrl *mocks.MockControl, lineInfo *mocks.MockLineInformation, regs *mocks.MockRegisterHandler, dummyRegisters *mocks.MockRegisters) {
+	cntrl.EXPECT().IsPaused().DoAndReturn(m.isPaused).AnyTimes()
+	cntrl.EXPECT().State().DoAndReturn(m.state).AnyTimes()
+	cntrl.EXPECT().WaitForStop(gomock.Any()).DoAndReturn(m.waitForStop).AnyTimes()
+	cntrl.EXPECT().Unpause().DoAndReturn(m.unpause).AnyTimes()
+	regs.EXPECT().GetRegisters(gomock.Any()).Return(dummyRegisters, nil).AnyTimes()
+	regs.EXPECT().SetRegisters(gomock.Any(), dummyRegisters).Return(nil).AnyTimes()
+	dummyRegisters.EXPECT().GetRegister(gomock.Any()).DoAndReturn(m.getRegister).AnyTimes()
+	dummyRegisters.EXPECT().SetRegister(gomock.Any(), gomock.Any()).DoAndReturn(m.setRegister).AnyTimes()
+	dummyRegisters.EXPECT().DwarfRegisters().DoAndReturn(m.dwarfRegisters).AnyTimes()
+	mem.EXPECT().Read(gomock.Any(), gomock.Any()).DoAndReturn(m.read).AnyTimes()
+	mem.EXPECT().Write(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(m.write).AnyTimes()
+	lineInfo.EXPECT().IsNewLine(gomock.Any()).DoAndReturn(m.isNewLine).AnyTimes()
+}
+
+//Tests next runs a function that is called to completion rather than stepping into it
+func TestNextOverCall(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, _, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x10, rsp: 0x1000},
+		state{rip: 0x14, rsp: 0x1000},
+		//call instruction at 0x14 pushes the return address 0x19
+		state{rip: 0x100, rsp: 0xff8},
+		state{rip: 0x101, rsp: 0xff0},
+		//the temporary breakpoint at the return address is hit
+		state{rip: 0x1a, rsp: 0x1000},
+		state{rip: 0x1e, rsp: 0x1000},
+	}
+	lines := map[uint64]int{0x10: 5, 0x14: 5, 0x100: 20, 0x101: 20, 0x19: 5, 0x1e: 6}
+	m := newMachine(t, trace, lines)
+	m.writeWord(0xff8, 0x19)
+	m.memory[0x19] = 0x90
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+
+	err := dbg.Next(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0x1e), m.registers["rip"])
+	assert.Equal(t, 6, m.line)
+	//The temporary breakpoint must have been removed
+	assert.Equal(t, byte(0x90), m.memory[0x19])
+}
+
+//Tests next stops when a breakpoint inside the function called is hit
+func TestNextStopsAtBreakpointInCall(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, _, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x10, rsp: 0x1000},
+		//call instruction at 0x10 pushes the return address 0x15
+		state{rip: 0x100, rsp: 0xff8},
+		state{rip: 0x101, rsp: 0xff0},
+		//the user's breakpoint at 0x104 is hit
+		state{rip: 0x105, rsp: 0xff0},
+	}
+	lines := map[uint64]int{0x10: 5, 0x15: 5, 0x100: 20, 0x101: 20, 0x104: 21}
+	m := newMachine(t, trace, lines)
+	m.writeWord(0xff8, 0x15)
+	m.memory[0x15] = 0x90
+	m.memory[0x104] = 0x55
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	lineInfo.EXPECT().LineAddresses("f.c", 21).Return([]uint64{0x104}, 21)
+
+	_, err := dbg.SetBreakpoint("f.c", 21, 0)
+	assert.Nil(t, err)
+	err = dbg.Next(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0x105), m.registers["rip"])
+	assert.Equal(t, 21, m.line)
+	assert.Equal(t, byte(0x90), m.memory[0x15])
+	assert.Equal(t, byte(0xCC), m.memory[0x104])
+}
+
+//Tests finish runs until the function returns and reads the value returned
+func TestFinish(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, sym, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+	function := mocks.NewMockFunction(mockCtrl)
+	returnType := mocks.NewMockVariable(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x104, rsp: 0xfe0, rbp: 0xff0},
+		state{rip: 0x108, rsp: 0xfe0, rbp: 0xff0},
+		//the temporary breakpoint at the return address is hit
+		state{rip: 0x1a, rsp: 0x1000, rbp: 0x1010, rax: 16},
+	}
+	lines := map[uint64]int{0x104: 20, 0x108: 20, 0x19: 5}
+	m := newMachine(t, trace, lines)
+	m.memory[0x19] = 0x90
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachLines(lineInfo)
+
+	sym.EXPECT().GetFunction(uint64(0x104)).Return(function, nil)
+	sym.EXPECT().Unwind(gomock.Any(), mem).Return(callerRegisters(0x19, 0x1000), nil)
+	function.EXPECT().ReturnType().Return(returnType)
+	function.EXPECT().Name().Return("square")
+	returnType.EXPECT().Size().Return(4).AnyTimes()
+	sym.EXPECT().IsFloat(returnType).Return(false)
+	sym.EXPECT().VariableValue(returnType, []byte{16, 0, 0, 0}, mem).Return(intValue([]byte{16, 0, 0, 0}), nil)
+
+	event, val, err := dbg.Finish(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, debugger.LocationReached, event.Reason)
+	assert.Equal(t, "Value returned by square = 16", val)
+	assert.Equal(t, uint64(0x19), m.registers["rip"])
+	assert.Equal(t, 5, m.line)
+	assert.Equal(t, byte(0x90), m.memory[0x19])
+}
+
+//callerRegisters - creates the registers of a frame unwound by the symbol table
+func callerRegisters(pc, sp uint64) *op.DwarfRegisters {
+	regs := &op.DwarfRegisters{PCRegNum: 16, SPRegNum: 7, BPRegNum: 6}
+	regs.AddReg(16, op.DwarfRegisterFromUint64(pc))
+	regs.AddReg(7, op.DwarfRegisterFromUint64(sp))
+	return regs
+}
+
+//Tests finish doesn't print anything for functions returning void
+func TestFinishVoid(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, sym, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+	function := mocks.NewMockFunction(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x104, rsp: 0xfe0, rbp: 0xff0},
+		state{rip: 0x108, rsp: 0xfe0, rbp: 0xff0},
+		state{rip: 0x1a, rsp: 0x1000, rbp: 0x1010},
+	}
+	m := newMachine(t, trace, map[uint64]int{})
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachLines(lineInfo)
+
+	sym.EXPECT().GetFunction(uint64(0x104)).Return(function, nil)
+	sym.EXPECT().Unwind(gomock.Any(), mem).Return(callerRegisters(0x19, 0x1000), nil)
+	function.EXPECT().ReturnType().Return(nil)
+
+	_, val, err := dbg.Finish(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "", val)
+}
+
+//Tests finish says which breakpoint stopped the VM before the function returned
+func TestFinishInterruptedByBreakpoint(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, sym, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+	function := mocks.NewMockFunction(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x104, rsp: 0xfe0, rbp: 0xff0},
+		state{rip: 0x108, rsp: 0xfe0, rbp: 0xff0},
+		//the breakpoint further down the function is hit
+		state{rip: 0x111, rsp: 0xfe0, rbp: 0xff0},
+	}
+	m := newMachine(t, trace, map[uint64]int{0x104: 20, 0x108: 20, 0x110: 22})
+	m.memory[0x19] = 0x90
+	m.memory[0x110] = 0x90
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachLines(lineInfo)
+	lineInfo.EXPECT().LineAddresses("test.c", 22).Return([]uint64{0x110}, 22)
+
+	sym.EXPECT().GetFunction(uint64(0x104)).Return(function, nil)
+	sym.EXPECT().Unwind(gomock.Any(), mem).Return(callerRegisters(0x19, 0x1000), nil)
+
+	id, _, err := dbg.BreakAt("test.c:22", "", 0)
+	assert.Nil(t, err)
+
+	event, val, err := dbg.Finish(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "", val)
+	assert.Equal(t, debugger.BreakpointHit, event.Reason)
+	assert.Equal(t, id, event.Breakpoint)
+	assert.Equal(t, fmt.Sprintf("Breakpoint %d hit at test.c:22", id), event.String())
+	assert.Equal(t, 22, m.line)
+	//the temporary breakpoint at the return address is removed
+	assert.Equal(t, byte(0x90), m.memory[0x19])
+}
+
+//Checks finish won't run if the VM is not paused
+func TestFinishNotPaused(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	_, cntrl, _, _, _, dbg := setup(mockCtrl)
+	cntrl.EXPECT().IsPaused().Return(false)
+	_, _, err := dbg.Finish(context.Background(), 0)
+	assert.Equal(t, debugger.NotPaused, err)
+}
+
+//Tests backtrace lists each frame with its arguments and location
+func TestBacktrace(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, sym, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+	inner := mocks.NewMockFunction(mockCtrl)
+	main := mocks.NewMockFunction(mockCtrl)
+	parameter := mocks.NewMockVariable(mockCtrl)
+
+	m := newMachine(t, []state{state{rip: 0x104, rsp: 0xfe0, rbp: 0xff0}}, map[uint64]int{})
+	//b is stored at fbreg -20
+	m.write(0xfec, []byte{3, 0, 0, 0}, 4)
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachFrames(sym)
+
+	caller := callerRegisters(0x19, 0x1000)
+	sym.EXPECT().GetFunction(uint64(0x104)).Return(inner, nil)
+	sym.EXPECT().Unwind(gomock.Any(), mem).Return(caller, nil)
+	//The scope of the caller is looked up using the address of the call
+	sym.EXPECT().GetFunction(uint64(0x18)).Return(main, nil)
+	sym.EXPECT().Unwind(caller, mem).Return(nil, errors.New("no frame information"))
+
+	inner.EXPECT().Name().Return("inner")
+	inner.EXPECT().Parameters().Return([]debugger.Variable{parameter})
+	main.EXPECT().Name().Return("main")
+	main.EXPECT().Parameters().Return(nil)
+	parameter.EXPECT().Name().Return("b")
+	parameter.EXPECT().Location().Return([]byte{0x91, 0x6c})
+	parameter.EXPECT().Size().Return(4)
+	sym.EXPECT().VariableValue(parameter, []byte{3, 0, 0, 0}, mem).Return(intValue([]byte{3, 0, 0, 0}), nil)
+	lineInfo.EXPECT().AddressToLine(uint64(0x104)).Return("test.c", 20, nil)
+	lineInfo.EXPECT().AddressToLine(uint64(0x18)).Return("test.c", 5, nil)
+
+	trace, err := dbg.Backtrace(0)
+	assert.Nil(t, err)
+	assert.Equal(t, "#0  0x104 in inner (b = 3) at test.c:20\n#1  0x19 in main () at test.c:5", trace)
+}
+
+//Tests backtrace stops at the first frame without debugging information
+func TestBacktraceUnknownFunction(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, sym, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+
+	m := newMachine(t, []state{state{rip: 0x104, rsp: 0xfe0, rbp: 0xff0}}, map[uint64]int{})
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	sym.EXPECT().GetFunction(uint64(0x104)).Return(nil, errors.New("no frame information"))
+
+	trace, err := dbg.Backtrace(0)
+	assert.Nil(t, err)
+	assert.Equal(t, "#0  0x104 in ?? ()", trace)
+}
+
+//Tests variables are read from the frame selected with up
+func TestUpReadsCallerVariable(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, sym, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+	inner := mocks.NewMockFunction(mockCtrl)
+	main := mocks.NewMockFunction(mockCtrl)
+	variable := mocks.NewMockVariable(mockCtrl)
+
+	m := newMachine(t, []state{state{rip: 0x104, rsp: 0xfe0, rbp: 0xff0}}, map[uint64]int{})
+	//x is stored at fbreg -20 in the frame of main whose CFA is 0x1020
+	m.write(0x100c, []byte{7, 0, 0, 0}, 4)
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachFrames(sym)
+
+	caller := callerRegisters(0x19, 0x1000)
+	sym.EXPECT().GetFunction(uint64(0x104)).Return(inner, nil).AnyTimes()
+	sym.EXPECT().GetFunction(uint64(0x18)).Return(main, nil).AnyTimes()
+	sym.EXPECT().Unwind(gomock.Any(), mem).DoAndReturn(func(r *op.DwarfRegisters, _ debugger.MemoryAccess) (*op.DwarfRegisters, error) {
+		if r.PC() == 0x19 {
+			r.CFA = 0x1020
+			r.FrameBase = 0x1020
+			return nil, errors.New("no frame information")
+		}
+		return caller, nil
+	}).AnyTimes()
+	main.EXPECT().Name().Return("main")
+	main.EXPECT().Parameters().Return(nil)
+	lineInfo.EXPECT().AddressToLine(uint64(0x18)).Return("test.c", 5, nil)
+
+	val, err := dbg.Up(0, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "#1  0x19 in main () at test.c:5", val)
+
+	sym.EXPECT().GetSymbol("x", uint64(0x18)).Return(variable, nil)
+	variable.EXPECT().Location().Return([]byte{0x91, 0x6c})
+	variable.EXPECT().Size().Return(4)
+	sym.EXPECT().VariableValue(variable, []byte{7, 0, 0, 0}, mem).Return(intValue([]byte{7, 0, 0, 0}), nil)
+	val, err = dbg.GetVariable("x")
+	assert.Nil(t, err)
+	assert.Equal(t, "x = 7", val)
+
+	_, err = dbg.Up(0, 1)
+	assert.Equal(t, debugger.NoFrame, err)
+}
+
+//Tests a parameter is read from the CFA given by the call frame information
+//when the VM stops on the first instruction of a function (before its
+//prologue has set up the frame pointer)
+func TestGetVariableAtFunctionEntry(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, sym, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+	variable := mocks.NewMockVariable(mockCtrl)
+
+	//rbp still holds the frame pointer of the caller
+	m := newMachine(t, []state{state{rip: 0x100, rsp: 0xff8, rbp: 0x2000}}, map[uint64]int{})
+	//n is stored at fbreg -20 and the CFA is just above the return address
+	m.write(0xfec, []byte{3, 0, 0, 0}, 4)
+	//this is where n would be if the CFA was guessed from rbp
+	m.write(0x1ffc, []byte{9, 0, 0, 0}, 4)
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+
+	sym.EXPECT().SetCFA(gomock.Any()).DoAndReturn(func(r *op.DwarfRegisters) error {
+		r.CFA = int64(r.SP()) + 8
+		r.FrameBase = r.CFA
+		return nil
+	}).AnyTimes()
+	sym.EXPECT().GetSymbol("n", uint64(0x100)).Return(variable, nil)
+	variable.EXPECT().Location().Return([]byte{0x91, 0x6c})
+	variable.EXPECT().Size().Return(4)
+	sym.EXPECT().VariableValue(variable, []byte{3, 0, 0, 0}, mem).Return(intValue([]byte{3, 0, 0, 0}), nil)
+
+	val, err := dbg.GetVariable("n")
+	assert.Nil(t, err)
+	assert.Equal(t, "n = 3", val)
+}
+
+//Tests continue passes over a conditional breakpoint until its condition is true
+func TestContinueConditionalBreakpoint(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, sym, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x10, rsp: 0x1000},
+		//the breakpoint is hit but the condition is false
+		state{rip: 0x21, rsp: 0x1000},
+		//the instruction under the breakpoint is executed
+		state{rip: 0x25, rsp: 0x1000},
+		state{rip: 0x21, rsp: 0x1000},
+	}
+	m := newMachine(t, trace, map[uint64]int{0x21: 7})
+	m.memory[0x20] = 0x90
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachFrames(sym)
+	m.attachLines(lineInfo)
+
+	lineInfo.EXPECT().LineAddresses("test.c", 7).Return([]uint64{0x20}, 7).AnyTimes()
+	sym.EXPECT().CheckExpression("i == 1").Return(nil)
+	gomock.InOrder(
+		sym.EXPECT().Condition("i == 1", uint64(0x20), gomock.Any(), mem).Return(false, nil),
+		sym.EXPECT().Condition("i == 1", uint64(0x20), gomock.Any(), mem).Return(true, nil),
+	)
+
+	_, err := dbg.SetConditionalBreakpoint("test.c", 7, "i == 1", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(0xcc), m.memory[0x20])
+
+	_, err = dbg.Continue(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0x21), m.registers["rip"])
+	assert.Equal(t, 3, m.current)
+	assert.Equal(t, byte(0xcc), m.memory[0x20])
+}
+
+//Tests a breakpoint isn't set when its condition can't be parsed
+func TestSetConditionalBreakpointInvalid(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	_, _, _, _, sym, dbg := setup(mockCtrl)
+	invalid := errors.New("Error: unexpected end of expression")
+	sym.EXPECT().CheckExpression("i ==").Return(invalid)
+
+	_, err := dbg.SetConditionalBreakpoint("test.c", 7, "i ==", 0)
+	assert.Equal(t, invalid, err)
+	assert.Equal(t, "No breakpoints have been set!", dbg.ListBreakpoints())
+}
+
+//Tests continue passes over the number of hits given by ignore and counts every hit
+func TestContinueIgnoreBreakpoint(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, _, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x10, rsp: 0x1000},
+		state{rip: 0x21, rsp: 0x1000},
+		state{rip: 0x25, rsp: 0x1000},
+		state{rip: 0x21, rsp: 0x1000},
+		state{rip: 0x25, rsp: 0x1000},
+		state{rip: 0x21, rsp: 0x1000},
+	}
+	m := newMachine(t, trace, map[uint64]int{0x21: 7})
+	m.memory[0x20] = 0x90
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachLines(lineInfo)
+	lineInfo.EXPECT().LineAddresses("test.c", 7).Return([]uint64{0x20}, 7).AnyTimes()
+
+	id, err := dbg.SetBreakpoint("test.c", 7, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, id)
+	err = dbg.IgnoreBreakpoint(id, 2)
+	assert.Nil(t, err)
+
+	_, err = dbg.Continue(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, m.current)
+	assert.Equal(t, "Num  Enabled  Address  What\n1    y        0x20     test.c:7\n\tbreakpoint already hit 3 time(s)", dbg.ListBreakpoints())
+}
+
+//Tests disabling the breakpoint we've stopped at makes the VM run the original instruction
+func TestDisableBreakpointStoppedAt(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, _, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x10, rsp: 0x1000},
+		state{rip: 0x21, rsp: 0x1000},
+	}
+	m := newMachine(t, trace, map[uint64]int{})
+	m.memory[0x20] = 0x90
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachLines(lineInfo)
+	lineInfo.EXPECT().LineAddresses("test.c", 7).Return([]uint64{0x20}, 7).AnyTimes()
+
+	id, err := dbg.SetBreakpoint("test.c", 7, 0)
+	assert.Nil(t, err)
+	_, err = dbg.Continue(context.Background(), 0)
+	assert.Nil(t, err)
+
+	err = dbg.DisableBreakpoint(id, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0x20), m.registers["rip"])
+	assert.Equal(t, byte(0x90), m.memory[0x20])
+	assert.Equal(t, "Num  Enabled  Address  What\n1    n        0x20     test.c:7\n\tbreakpoint already hit 1 time(s)", dbg.ListBreakpoints())
+
+	err = dbg.DeleteBreakpoint(id, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "No breakpoints have been set!", dbg.ListBreakpoints())
+}
+
+//Tests a breakpoint on a function is set after its prologue
+func TestBreakAtFunction(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, _, sym, dbg := setup(mockCtrl)
+	function := mocks.NewMockFunction(mockCtrl)
+
+	cntrl.EXPECT().IsPaused().Return(true)
+	sym.EXPECT().LookupFunction("walk").Return(function, nil)
+	function.EXPECT().Range().Return(uint64(0x1129), uint64(0x1166))
+	lineInfo.EXPECT().SkipPrologue(uint64(0x1129), uint64(0x1166)).Return(uint64(0x1131))
+	lineInfo.EXPECT().AddressToLine(uint64(0x1131)).Return("conditions.c", 7, nil)
+	mem.EXPECT().Read(uint64(0x1131), uint(1)).Return([]byte{0xc7}, nil)
+	mem.EXPECT().Write(uint64(0x1131), []byte{0xcc}, uint(1)).Return(nil)
+
+	id, place, err := dbg.BreakAt("walk", "", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, id)
+	assert.Equal(t, "conditions.c:7", place)
+	assert.Equal(t, "Num  Enabled  Address  What\n1    y        0x1131   conditions.c:7", dbg.ListBreakpoints())
+}
+
+//Tests breakpoints can be set on addresses without any line information
+func TestBreakAtAddress(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, _, _, dbg := setup(mockCtrl)
+
+	cntrl.EXPECT().IsPaused().Return(true).Times(2)
+	lineInfo.EXPECT().AddressToLine(uint64(0xffff800000001234)).Return("", 0, errors.New("no line information"))
+	mem.EXPECT().Read(uint64(0xffff800000001234), uint(1)).Return([]byte{0x55}, nil)
+	mem.EXPECT().Write(uint64(0xffff800000001234), []byte{0xcc}, uint(1)).Return(nil)
+
+	id, place, err := dbg.BreakAt("*0xffff800000001234", "", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, id)
+	assert.Equal(t, "*0xffff800000001234", place)
+	assert.Equal(t, "Num  Enabled  Address  What\n1    y        0xffff800000001234 <no line information>", dbg.ListBreakpoints())
+
+	_, _, err = dbg.BreakAt("*main", "", 0)
+	assert.Equal(t, "Error: main is not a valid address", err.Error())
+}
+
+//Tests an error is returned for functions that don't exist
+func TestBreakAtUnknownFunction(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	_, cntrl, _, _, sym, dbg := setup(mockCtrl)
+
+	cntrl.EXPECT().IsPaused().Return(true)
+	sym.EXPECT().LookupFunction("run").Return(nil, errors.New("Error: function not found"))
+	_, _, err := dbg.BreakAt("run", "", 0)
+	assert.Equal(t, "Error: no function named run", err.Error())
+}
+
+//Tests a breakpoint on a line without code moves to the next line and
+//is set at every block of code the line was compiled into
+func TestBreakAtLineSeveralAddresses(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, _, _, dbg := setup(mockCtrl)
+
+	cntrl.EXPECT().IsPaused().Return(true)
+	lineInfo.EXPECT().LineAddresses("conditions.c", 7).Return([]uint64{0x1138, 0x1156}, 8)
+	mem.EXPECT().Read(uint64(0x1138), uint(1)).Return([]byte{0xc7}, nil)
+	mem.EXPECT().Write(uint64(0x1138), []byte{0xcc}, uint(1)).Return(nil)
+	mem.EXPECT().Read(uint64(0x1156), uint(1)).Return([]byte{0x83}, nil)
+	mem.EXPECT().Write(uint64(0x1156), []byte{0xcc}, uint(1)).Return(nil)
+
+	id, place, err := dbg.BreakAt("conditions.c:7", "", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, id)
+	assert.Equal(t, "conditions.c:8", place)
+	assert.Equal(t, "Num  Enabled  Address  What\n1    y        0x1138   conditions.c:8\n\tset at 2 addresses: 0x1138, 0x1156", dbg.ListBreakpoints())
+}
+
+//Tests a hardware breakpoint stops the VM without writing to its memory and
+//the debug registers are only turned on while running to the breakpoint
+func TestContinueHardwareBreakpoint(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, _, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x10, rsp: 0x1000},
+		//DR0 is hit (the CPU stops before the instruction is run)
+		state{rip: 0x20, rsp: 0x1000, dr6: 0x1},
+		//the instruction at the breakpoint is stepped over
+		state{rip: 0x24, rsp: 0x1000},
+		state{rip: 0x20, rsp: 0x1000, dr6: 0x1},
+	}
+	m := newMachine(t, trace, map[uint64]int{0x20: 7})
+	m.memory[0x20] = 0x90
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachLines(lineInfo)
+
+	id, place, err := dbg.HardwareBreakAt("*0x20", "", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, id)
+	assert.Equal(t, "test.c:7", place)
+	assert.Equal(t, byte(0x90), m.memory[0x20])
+
+	_, err = dbg.Continue(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0x20), m.registers["rip"])
+	assert.Equal(t, uint64(0x20), m.registers["dr0"])
+
+	_, err = dbg.Continue(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0x20), m.registers["rip"])
+	assert.Equal(t, 3, m.current)
+	assert.Equal(t, []uint64{0x1, 0x0, 0x1}, m.dr7)
+	assert.Equal(t, uint64(0), m.registers["dr7"])
+	assert.Equal(t, byte(0x90), m.memory[0x20])
+	assert.Equal(t, "Num  Enabled  Address  What\n1    y        0x20     test.c:7\n\thardware breakpoint\n\tbreakpoint already hit 2 time(s)", dbg.ListBreakpoints())
+}
+
+//Tests a watchpoint only stops once the value watched has changed and
+//reports the old and new values
+func TestContinueWatchpoint(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, sym, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+	variable := mocks.NewMockVariable(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x10, rsp: 0x1000},
+		//the same value is written back so we carry on
+		state{rip: 0x30, rsp: 0x1000, dr6: 0x1},
+		state{rip: 0x34, rsp: 0x1000, dr6: 0x1, store: map[uint64]byte{0x5000: 5}},
+	}
+	m := newMachine(t, trace, map[uint64]int{0x34: 9})
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachFrames(sym)
+	m.attachLines(lineInfo)
+
+	sym.EXPECT().Watch("counter", uint64(0x10), gomock.Any(), mem).Return(variable, uint64(0x5000), false, nil)
+	variable.EXPECT().Size().Return(4).AnyTimes()
+	sym.EXPECT().VariableValue(variable, []byte{0, 0, 0, 0}, mem).Return(intValue([]byte{0, 0, 0, 0}), nil)
+	sym.EXPECT().VariableValue(variable, []byte{5, 0, 0, 0}, mem).Return(intValue([]byte{5, 0, 0, 0}), nil)
+
+	id, err := dbg.Watch("counter", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, id)
+	assert.Equal(t, "Num  Enabled  Address  What\n1    y        0x5000   hw watchpoint counter", dbg.ListBreakpoints())
+
+	event, err := dbg.Continue(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, debugger.WatchpointHit, event.Reason)
+	assert.Equal(t, "Hardware watchpoint 1: counter\n\nOld value = 0\nNew value = 5", event.String())
+	assert.Equal(t, uint64(0x34), m.registers["rip"])
+	assert.Equal(t, 9, m.line)
+	//DR0 watches 4 bytes (LEN 11) for writes (R/W 01)
+	assert.Equal(t, uint64(0x5000), m.registers["dr0"])
+	assert.Equal(t, []uint64{0xd0001, 0xd0001}, m.dr7)
+}
+
+//Tests a watchpoint on a local variable is deleted once its frame returns
+func TestWatchpointLeavesScope(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, sym, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+	variable := mocks.NewMockVariable(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x100, rsp: 0xff0},
+		//the function returns to 0x19 and hits the temporary breakpoint
+		state{rip: 0x1a, rsp: 0x1000},
+	}
+	m := newMachine(t, trace, map[uint64]int{0x19: 5})
+	m.memory[0x19] = 0x90
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachFrames(sym)
+	m.attachLines(lineInfo)
+
+	sym.EXPECT().Watch("total", uint64(0x100), gomock.Any(), mem).Return(variable, uint64(0xfe8), true, nil)
+	sym.EXPECT().Unwind(gomock.Any(), mem).Return(callerRegisters(0x19, 0x1000), nil)
+	variable.EXPECT().Size().Return(4).AnyTimes()
+
+	id, err := dbg.Watch("total", 0)
+	assert.Nil(t, err)
+
+	event, err := dbg.Continue(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, debugger.WatchpointScope, event.Reason)
+	assert.Equal(t, fmt.Sprintf("Watchpoint %d deleted because the program has left the block in which its expression is valid.", id), event.String())
+	assert.Equal(t, uint64(0x19), m.registers["rip"])
+	assert.Equal(t, byte(0x90), m.memory[0x19])
+	assert.Equal(t, "No breakpoints have been set!", dbg.ListBreakpoints())
+}
+
+//Tests a software watchpoint single steps until a line changes the value
+func TestContinueSoftwareWatchpoint(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, sym, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+	variable := mocks.NewMockVariable(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x10, rsp: 0x1000},
+		state{rip: 0x14, rsp: 0x1000},
+		//line 3 leaves the value the same and line 4 changes it
+		state{rip: 0x18, rsp: 0x1000},
+		state{rip: 0x1c, rsp: 0x1000, store: map[uint64]byte{0x5000: 7}},
+	}
+	m := newMachine(t, trace, map[uint64]int{0x10: 3, 0x14: 3, 0x18: 4, 0x1c: 5})
+	m.line = 3
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachFrames(sym)
+	m.attachLines(lineInfo)
+
+	evaluate := func(expression string, pc uint64, regs *op.DwarfRegisters, memory debugger.MemoryAccess) (debugger.Variable, []byte, bool, error) {
+		value, _ := m.read(0x5000, 4)
+		return variable, value, false, nil
+	}
+	sym.EXPECT().Evaluate("a + b", uint64(0x10), gomock.Any(), mem).DoAndReturn(evaluate).AnyTimes()
+	sym.EXPECT().VariableValue(variable, []byte{0, 0, 0, 0}, mem).Return(intValue([]byte{0, 0, 0, 0}), nil)
+	sym.EXPECT().VariableValue(variable, []byte{7, 0, 0, 0}, mem).Return(intValue([]byte{7, 0, 0, 0}), nil)
+
+	id, err := dbg.SoftwareWatch("a + b", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "Num  Enabled  Address  What\n1    y                 sw watchpoint a + b", dbg.ListBreakpoints())
+
+	event, err := dbg.Continue(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, fmt.Sprintf("Software watchpoint %d: a + b\n\nOld value = 0\nNew value = 7\nChanged by test.c:4", id), event.String())
+	assert.Equal(t, uint64(0x1c), m.registers["rip"])
+	assert.Equal(t, 5, m.line)
+	//Nothing is loaded into the debug registers while stepping
+	assert.Equal(t, []uint64{0, 0, 0}, m.dr7)
+}
+
+//Tests a temporary breakpoint is deleted once it stops the VM
+func TestContinueTemporaryBreakpoint(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, _, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x10, rsp: 0x1000},
+		state{rip: 0x21, rsp: 0x1000},
+	}
+	m := newMachine(t, trace, map[uint64]int{0x20: 7})
+	m.memory[0x20] = 0x90
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachLines(lineInfo)
+	lineInfo.EXPECT().LineAddresses("test.c", 7).Return([]uint64{0x20}, 7)
+
+	id, place, err := dbg.TemporaryBreakAt("test.c:7", "", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "test.c:7", place)
+	assert.Equal(t, "Num  Enabled  Address  What\n1    y        0x20     test.c:7\n\ttemporary breakpoint (deleted once hit)", dbg.ListBreakpoints())
+
+	event, err := dbg.Continue(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, fmt.Sprintf("Temporary breakpoint %d hit at test.c:7", id), event.String())
+	assert.Equal(t, uint64(0x20), m.registers["rip"])
+	assert.Equal(t, byte(0x90), m.memory[0x20])
+	assert.Equal(t, "No breakpoints have been set!", dbg.ListBreakpoints())
+}
+
+//Tests until stops at a breakpoint hit before the location and removes its
+//temporary breakpoints, then stops once the frame returns (but not when a
+//recursive call returns to the same address)
+func TestUntil(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, sym, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x10, rsp: 0x1000},
+		//the breakpoint at 0x30 is hit first
+		state{rip: 0x31, rsp: 0x1000},
+		//the instruction under the breakpoint is executed
+		state{rip: 0x34, rsp: 0x1000},
+		//a recursive call returns
+		state{rip: 0x51, rsp: 0xff0},
+		state{rip: 0x54, rsp: 0xff0},
+		//the frame returns
+		state{rip: 0x51, rsp: 0x1010},
+	}
+	m := newMachine(t, trace, map[uint64]int{0x20: 7, 0x30: 9, 0x50: 12})
+	m.memory[0x20] = 0x90
+	m.memory[0x30] = 0x90
+	m.memory[0x50] = 0x90
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachLines(lineInfo)
+	lineInfo.EXPECT().LineAddresses("test.c", 9).Return([]uint64{0x30}, 9)
+	lineInfo.EXPECT().LineAddresses("test.c", 7).Return([]uint64{0x20}, 7).Times(2)
+	sym.EXPECT().Unwind(gomock.Any(), mem).Return(callerRegisters(0x50, 0x1010), nil).Times(2)
+
+	_, _, err := dbg.BreakAt("test.c:9", "", 0)
+	assert.Nil(t, err)
+
+	event, err := dbg.Until(context.Background(), "test.c:7", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "Breakpoint 1 hit at test.c:9", event.String())
+	assert.Equal(t, uint64(0x31), m.registers["rip"])
+	assert.Equal(t, byte(0x90), m.memory[0x20])
+	assert.Equal(t, byte(0xcc), m.memory[0x30])
+	assert.Equal(t, byte(0x90), m.memory[0x50])
+
+	event, err = dbg.Until(context.Background(), "test.c:7", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "Reached test.c:12", event.String())
+	assert.Equal(t, uint64(0x50), m.registers["rip"])
+	assert.Equal(t, 12, m.line)
+	assert.Equal(t, 5, m.current)
+	assert.Equal(t, byte(0x90), m.memory[0x20])
+	assert.Equal(t, byte(0x90), m.memory[0x50])
+}
+
+//Tests a dprintf breakpoint prints its values and resumes the VM, and the
+//commands of the breakpoint that stops it are returned once
+func TestDprintfAndCommands(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, sym, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+	x := mocks.NewMockVariable(mockCtrl)
+	y := mocks.NewMockVariable(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x10, rsp: 0x1000},
+		//the dprintf is hit so the VM is resumed
+		state{rip: 0x21, rsp: 0x1000},
+		state{rip: 0x25, rsp: 0x1000},
+		state{rip: 0x41, rsp: 0x1000},
+	}
+	m := newMachine(t, trace, map[uint64]int{0x20: 7, 0x40: 9})
+	m.memory[0x20] = 0x90
+	m.memory[0x40] = 0x90
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachFrames(sym)
+	m.attachLines(lineInfo)
+	lineInfo.EXPECT().LineAddresses("test.c", 7).Return([]uint64{0x20}, 7)
+	lineInfo.EXPECT().LineAddresses("test.c", 9).Return([]uint64{0x40}, 9)
+
+	location := []byte{byte(op.DW_OP_addr), 0, 0x50, 0, 0, 0, 0, 0, 0}
+	sym.EXPECT().GetSymbol("x", uint64(0x20)).Return(x, nil)
+	sym.EXPECT().GetSymbol("y", uint64(0x20)).Return(y, nil)
+	x.EXPECT().Location().Return(location)
+	x.EXPECT().Size().Return(4)
+	sym.EXPECT().VariableValue(x, []byte{0, 0, 0, 0}, mem).Return(intValue([]byte{0xfb, 0xff, 0xff, 0xff}), nil)
+	y.EXPECT().Location().Return(location)
+	y.EXPECT().Size().Return(4)
+	sym.EXPECT().VariableValue(y, []byte{0, 0, 0, 0}, mem).Return(intValue([]byte{0xff, 0, 0, 0}), nil)
+
+	var output bytes.Buffer
+	dbg.SetOutput(&output)
+
+	_, _, err := dbg.DprintfAt("test.c:7", "x = %d, y = %04x\n", []string{"x"}, 0)
+	assert.Equal(t, "Error: the format of dprintf uses 2 values but 1 were given", err.Error())
+	_, place, err := dbg.DprintfAt("test.c:7", "x = %d, y = %04x\n", []string{"x", "y"}, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "test.c:7", place)
+	id, _, err := dbg.BreakAt("test.c:9", "", 0)
+	assert.Nil(t, err)
+	assert.Nil(t, dbg.SetCommands(id, []string{"read x", "continue"}))
+	assert.Equal(t, "Num  Enabled  Address  What\n1    y        0x20     test.c:7\n\tprintf \"x = %d, y = %04x\\n\", x, y\n2    y        0x40     test.c:9\n\t\tread x\n\t\tcontinue", dbg.ListBreakpoints())
+
+	_, err = dbg.Continue(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0x41), m.registers["rip"])
+	assert.Regexp(t, `^\[\d\d:\d\d:\d\d\.\d{6}\] x = -5, y = 00ff\n$`, output.String())
+	assert.Equal(t, []string{"read x", "continue"}, dbg.HitCommands())
+	assert.Nil(t, dbg.HitCommands())
+}
+
+//Tests read and dprintf (for %s) print integers in the output radix
+func TestOutputRadixReadAndDprintf(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, sym, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+	x := mocks.NewMockVariable(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x10, rsp: 0x1000},
+		//the dprintf is hit so the VM is resumed
+		state{rip: 0x21, rsp: 0x1000},
+		state{rip: 0x25, rsp: 0x1000},
+		state{rip: 0x41, rsp: 0x1000},
+	}
+	m := newMachine(t, trace, map[uint64]int{0x20: 7, 0x40: 9})
+	m.memory[0x20] = 0x90
+	m.memory[0x40] = 0x90
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachFrames(sym)
+	m.attachLines(lineInfo)
+	lineInfo.EXPECT().LineAddresses("test.c", 7).Return([]uint64{0x20}, 7)
+	lineInfo.EXPECT().LineAddresses("test.c", 9).Return([]uint64{0x40}, 9)
+
+	location := []byte{byte(op.DW_OP_addr), 0, 0x50, 0, 0, 0, 0, 0, 0}
+	sym.EXPECT().GetSymbol("x", gomock.Any()).Return(x, nil).AnyTimes()
+	x.EXPECT().Location().Return(location).AnyTimes()
+	x.EXPECT().Size().Return(4).AnyTimes()
+	sym.EXPECT().VariableValue(x, []byte{0, 0, 0, 0}, mem).Return(intValue([]byte{0xff, 0, 0, 0}), nil).AnyTimes()
+
+	var output bytes.Buffer
+	dbg.SetOutput(&output)
+	assert.Nil(t, dbg.SetOutputRadix(16))
+
+	_, _, err := dbg.DprintfAt("test.c:7", "x = %s, x = %d\n", []string{"x", "x"}, 0)
+	assert.Nil(t, err)
+	_, _, err = dbg.BreakAt("test.c:9", "", 0)
+	assert.Nil(t, err)
+
+	_, err = dbg.Continue(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.Regexp(t, `^\[[0-9:.]+\] x = 0xff, x = 255\n$`, output.String())
+
+	val, err := dbg.GetVariable("x")
+	assert.Nil(t, err)
+	assert.Equal(t, "x = 0xff", val)
+}
+
+//Tests the VM stopping without one of our breakpoints is reported as
+//an external pause, or a break instruction belonging to the guest
+func TestContinueUnexpectedStops(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, sym, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x10, rsp: 0x1000},
+		//xl pause
+		state{rip: 0x51, rsp: 0x1000},
+		//an int3 compiled into the guest
+		state{rip: 0x61, rsp: 0x1000},
+	}
+	m := newMachine(t, trace, map[uint64]int{0x51: 5, 0x60: 6})
+	m.memory[0x50] = 0x90
+	m.memory[0x60] = 0xcc
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachLines(lineInfo)
+	functionAt(mockCtrl, sym)
+
+	event, err := dbg.Continue(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, debugger.ExternalPause, event.Reason)
+	assert.Equal(t, "Paused from outside of the debugger at test.c:5", event.String())
+
+	event, err = dbg.Continue(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, debugger.ForeignTrap, event.Reason)
+	assert.Equal(t, "Hit a break instruction not set by the debugger at test.c:6", event.String())
+	assert.Equal(t, uint64(0x61), m.registers["rip"])
+}
+
+//Tests the instructions of the function are decoded to tell an int3 of the
+//guest apart from an instruction which happens to end in 0xcc
+func TestContinueUnexpectedStopsInFunction(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, sym, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x8, rsp: 0x1000},
+		//xl pause just after mov $0xcc,%al
+		state{rip: 0x12, rsp: 0x1000},
+		//the int3 after it
+		state{rip: 0x13, rsp: 0x1000},
+	}
+	m := newMachine(t, trace, map[uint64]int{0x10: 5, 0x12: 6})
+	//mov $0xcc,%al; int3; nop
+	for i, b := range []byte{0xb0, 0xcc, 0xcc, 0x90} {
+		m.memory[0x10+uint64(i)] = b
+	}
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachLines(lineInfo)
+	functionAt(mockCtrl, sym)
+
+	event, err := dbg.Continue(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, debugger.ExternalPause, event.Reason)
+	assert.Equal(t, uint64(0x12), event.Address)
+
+	event, err = dbg.Continue(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, debugger.ForeignTrap, event.Reason)
+	assert.Equal(t, "Hit a break instruction not set by the debugger at test.c:6", event.String())
+}
+
+//Tests the domain shutting down or crashing while running is reported
+//rather than waiting forever for it to pause
+func TestContinueDomainExits(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, _, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x10, rsp: 0x1000},
+		state{exit: &debugger.DomainState{Shutdown: true, Reason: 0}},
+	}
+	m := newMachine(t, trace, map[uint64]int{})
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+
+	event, err := dbg.Continue(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.True(t, event.Exited())
+	assert.Equal(t, "The domain has shut down (reason 0: poweroff)", event.String())
+
+	crashed := debugger.StopEvent{Reason: debugger.DomainCrash, ShutdownCode: 3}
+	assert.Equal(t, "The domain has crashed", crashed.String())
+}
+
+//fakeControl is a controller which runs the machine in the background like a
+//real VM would, so stops are delivered asynchronously after a delay
+type fakeControl struct {
+	m     *machine
+	delay time.Duration
+	//stops receives the state of the VM each time it stops by itself
+	stops chan debugger.DomainState
+	//interrupt is closed when the debugger pauses the VM
+	interrupt chan struct{}
+	paused    bool
+	pauses    int
+}
+
+func newFakeControl(m *machine, delay time.Duration) *fakeControl {
+	return &fakeControl{m: m, delay: delay, stops: make(chan debugger.DomainState, 1), paused: true}
+}
+
+func (f *fakeControl) IsPaused() bool {
+	return f.paused
+}
+
+func (f *fakeControl) Pause() error {
+	f.pauses += 1
+	f.paused = true
+	if f.interrupt != nil {
+		close(f.interrupt)
+		f.interrupt = nil
+	}
+	return nil
+}
+
+func (f *fakeControl) Unpause() error {
+	f.paused = false
+	f.interrupt = make(chan struct{})
+	interrupt := f.interrupt
+	go func() {
+		select {
+		case <-time.After(f.delay):
+			f.m.unpause()
+			state, _ := f.m.state()
+			f.stops <- state
+		case <-interrupt:
+		}
+	}()
+	return nil
+}
+
+func (f *fakeControl) State() (debugger.DomainState, error) {
+	if f.paused {
+		return debugger.DomainState{Paused: true}, nil
+	}
+	return debugger.DomainState{}, nil
+}
+
+func (f *fakeControl) VCPUs() (uint32, error) {
+	return 1, nil
+}
+
+func (f *fakeControl) WaitForStop(ctx context.Context) (debugger.DomainState, error) {
+	select {
+	case state := <-f.stops:
+		f.paused = state.Paused
+		return state, nil
+	case <-ctx.Done():
+		return debugger.DomainState{}, ctx.Err()
+	}
+}
+
+//Tests continue waits for a stop delivered asynchronously by the controller
+func TestContinueAsynchronousStop(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, sym, _ := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x10, rsp: 0x1000},
+		state{rip: 0x21, rsp: 0x1000},
+	}
+	m := newMachine(t, trace, map[uint64]int{0x20: 7})
+	m.memory[0x20] = 0x90
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachLines(lineInfo)
+	control := newFakeControl(m, 10*time.Millisecond)
+	dbg := debugger.NewDebugger(mem, control, lineInfo, regs, sym)
+	lineInfo.EXPECT().LineAddresses("test.c", 7).Return([]uint64{0x20}, 7)
+
+	id, _, err := dbg.BreakAt("test.c:7", "", 0)
+	assert.Nil(t, err)
+
+	event, err := dbg.Continue(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, fmt.Sprintf("Breakpoint %d hit at test.c:7", id), event.String())
+	assert.Equal(t, 0, control.pauses)
+}
+
+//Tests a wait which times out pauses the VM, removes the temporary
+//breakpoints and debug registers set for it and says where it stopped
+func TestContinueTimeout(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, sym, _ := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x10, rsp: 0x1000},
+		state{rip: 0x21, rsp: 0x1000},
+	}
+	m := newMachine(t, trace, map[uint64]int{0x10: 3, 0x20: 7})
+	m.memory[0x20] = 0x90
+	m.memory[0x30] = 0x90
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachLines(lineInfo)
+	control := newFakeControl(m, time.Hour)
+	dbg := debugger.NewDebugger(mem, control, lineInfo, regs, sym)
+	sym.EXPECT().Unwind(gomock.Any(), mem).Return(callerRegisters(0x40, 0x1008), nil)
+	lineInfo.EXPECT().LineAddresses("test.c", 7).Return([]uint64{0x20}, 7)
+	lineInfo.EXPECT().LineAddresses("test.c", 8).Return([]uint64{0x30}, 8)
+
+	_, _, err := dbg.HardwareBreakAt("test.c:7", "", 0)
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	event, err := dbg.Until(ctx, "test.c:8", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, debugger.TimedOut, event.Reason)
+	assert.Equal(t, "Timed out at test.c:3", event.String())
+	assert.Equal(t, 1, control.pauses)
+	assert.True(t, control.IsPaused())
+	assert.Equal(t, byte(0x90), m.memory[0x30])
+	assert.Equal(t, uint64(0), m.registers["dr7"])
+	assert.Equal(t, uint64(0x10), m.registers["rip"])
+}
+
+//Tests cancelling continue (as Ctrl-C does) pauses the VM where it is and
+//that interrupt only pauses a VM which is running
+func TestContinueInterrupted(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, sym, _ := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x10, rsp: 0x1000},
+	}
+	m := newMachine(t, trace, map[uint64]int{0x10: 3})
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachLines(lineInfo)
+	control := newFakeControl(m, time.Hour)
+	dbg := debugger.NewDebugger(mem, control, lineInfo, regs, sym)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	event, err := dbg.Continue(ctx, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "Interrupted at test.c:3", event.String())
+	assert.Equal(t, 1, control.pauses)
+
+	_, err = dbg.Interrupt(0)
+	assert.NotNil(t, err)
+
+	control.paused = false
+	event, err = dbg.Interrupt(0)
+	assert.Nil(t, err)
+	assert.Equal(t, debugger.Interrupted, event.Reason)
+	assert.Equal(t, "Interrupted at test.c:3", event.String())
+	assert.Equal(t, 2, control.pauses)
+}
+
+//Tests detaching removes the break instructions (moving the PC back over
+//the one just hit) and turns off single stepping on every vcpu
+func TestDetach(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, _, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x10, rsp: 0x1000},
+		state{rip: 0x21, rsp: 0x1000},
+	}
+	m := newMachine(t, trace, map[uint64]int{0x20: 7, 0x30: 8})
+	m.memory[0x20] = 0x90
+	m.memory[0x30] = 0x55
+	//Only detaching uses the second vcpu
+	regs.EXPECT().GetRegisters(uint32(1)).Return(dummyRegisters, nil).Times(2)
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachLines(lineInfo)
+	lineInfo.EXPECT().LineAddresses("test.c", 7).Return([]uint64{0x20}, 7)
+	lineInfo.EXPECT().LineAddresses("test.c", 8).Return([]uint64{0x30}, 8)
+	cntrl.EXPECT().VCPUs().Return(uint32(2), nil)
+
+	_, _, err := dbg.BreakAt("test.c:7", "", 0)
+	assert.Nil(t, err)
+	_, _, err = dbg.BreakAt("test.c:8", "", 0)
+	assert.Nil(t, err)
+	_, err = dbg.Continue(context.Background(), 0)
+	assert.Nil(t, err)
+	m.registers["rflags"] = 0x346
+	//A watchpoint left armed when running was cut short
+	m.registers["dr7"] = 0x1
+	m.registers["dr6"] = 0x1
+
+	err = dbg.Detach(0)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(0x90), m.memory[0x20])
+	assert.Equal(t, byte(0x55), m.memory[0x30])
+	assert.Equal(t, uint64(0x20), m.registers["rip"])
+	assert.Equal(t, uint64(0x246), m.registers["rflags"])
+	assert.Equal(t, uint64(0), m.registers["dr7"])
+	assert.Equal(t, uint64(0), m.registers["dr6"])
+}
+
+//Tests Breakpoints returns copies of the breakpoints in the order they were set
+func TestBreakpointsCopy(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, sym, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+
+	m := newMachine(t, []state{state{rip: 0x10, rsp: 0x1000}}, map[uint64]int{})
+	m.memory[0x20] = 0x90
+	m.memory[0x30] = 0x90
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	lineInfo.EXPECT().LineAddresses("test.c", 7).Return([]uint64{0x20}, 7)
+	lineInfo.EXPECT().LineAddresses("test.c", 9).Return([]uint64{0x30}, 9)
+	sym.EXPECT().CheckExpression("i == 3").Return(nil)
+
+	first, _, err := dbg.BreakAt("test.c:7", "i == 3", 0)
+	assert.Nil(t, err)
+	second, _, err := dbg.TemporaryBreakAt("test.c:9", "", 0)
+	assert.Nil(t, err)
+	assert.Nil(t, dbg.IgnoreBreakpoint(first, 2))
+
+	breakpoints := dbg.Breakpoints()
+	assert.Equal(t, 2, len(breakpoints))
+	assert.Equal(t, first, breakpoints[0].ID)
+	assert.Equal(t, "i == 3", breakpoints[0].Condition)
+	assert.Equal(t, 2, breakpoints[0].Ignore)
+	assert.Equal(t, second, breakpoints[1].ID)
+	assert.True(t, breakpoints[1].Temporary)
+
+	breakpoints[0].Condition = ""
+	assert.Equal(t, "i == 3", dbg.Breakpoints()[0].Condition)
+}
+
+//functionAt - sets up GetFunction to find main (0x10-0x30) and helper (0x100-0x120)
+func functionAt(mockCtrl *gomock.Controller, sym *mocks.MockSymbol) {
+	var functions []*mocks.MockFunction
+	for name, bounds := range map[string][2]uint64{"main": {0x10, 0x30}, "helper": {0x100, 0x120}} {
+		function := mocks.NewMockFunction(mockCtrl)
+		function.EXPECT().Name().Return(name).AnyTimes()
+		function.EXPECT().Range().Return(bounds[0], bounds[1]).AnyTimes()
+		functions = append(functions, function)
+	}
+	sym.EXPECT().GetFunction(gomock.Any()).DoAndReturn(func(pc uint64) (debugger.Function, error) {
+		for _, function := range functions {
+			if low, high := function.Range(); pc >= low && pc < high {
+				return function, nil
+			}
+		}
+		return nil, errors.New("no function")
+	}).AnyTimes()
+}
+
+//Tests stepi runs exactly the number of instructions given and nexti runs
+//a call until it returns. The instructions are decoded from memory with the
+//break instructions of breakpoints taken out.
+func TestStepInstructions(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, sym, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+	variable := mocks.NewMockVariable(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x10, rsp: 0x1000},
+		state{rip: 0x11, rsp: 0xff8},
+		state{rip: 0x14, rsp: 0xff8},
+		//call instruction at 0x14 pushes the return address 0x19
+		state{rip: 0x100, rsp: 0xff0},
+		state{rip: 0x101, rsp: 0xfe8},
+		//the temporary breakpoint at the return address is hit
+		state{rip: 0x1a, rsp: 0xff8},
+		//the nop at 0x19 is stepped and a watchpoint is hit
+		state{rip: 0x1a, rsp: 0xff8, dr6: 0x1, store: map[uint64]byte{0x5000: 5}},
+	}
+	lines := map[uint64]int{0x10: 5, 0x11: 5, 0x14: 6, 0x100: 20, 0x101: 20, 0x19: 6}
+	m := newMachine(t, trace, lines)
+	//push %rbp; mov %rsp,%rbp; call helper; nop
+	for i, b := range []byte{0x55, 0x48, 0x89, 0xe5, 0xe8, 0xe7, 0x00, 0x00, 0x00, 0x90} {
+		m.memory[0x10+uint64(i)] = b
+	}
+	m.writeWord(0xff0, 0x19)
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachFrames(sym)
+	m.attachLines(lineInfo)
+	functionAt(mockCtrl, sym)
+	lineInfo.EXPECT().LineAddresses("test.c", 6).Return([]uint64{0x14}, 6)
+
+	_, _, err := dbg.BreakAt("test.c:6", "", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(0xcc), m.memory[0x14])
+
+	instruction, err := dbg.CurrentInstruction(0)
+	assert.Nil(t, err)
+	assert.Equal(t, "=> 0x10 <main>:\tpush %rbp", instruction)
+
+	//Stepping onto a breakpoint stops there
+	event, err := dbg.StepInstructions(context.Background(), 0, 3, false)
+	assert.Nil(t, err)
+	assert.Equal(t, debugger.BreakpointHit, event.Reason)
+	assert.Equal(t, "Breakpoint 1 hit at test.c:6", event.String())
+	assert.Equal(t, uint64(0x14), m.registers["rip"])
+	instruction, err = dbg.CurrentInstruction(0)
+	assert.Nil(t, err)
+	assert.Equal(t, "=> 0x14 <main+4>:\tcallq 0x100 <helper>", instruction)
+
+	event, err = dbg.StepInstructions(context.Background(), 0, 1, true)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0x19), event.Address)
+	assert.Equal(t, uint64(0x19), m.registers["rip"])
+	assert.Equal(t, byte(0xcc), m.memory[0x14])
+	assert.Equal(t, byte(0x90), m.memory[0x19])
+
+	sym.EXPECT().Watch("counter", uint64(0x19), gomock.Any(), mem).Return(variable, uint64(0x5000), false, nil)
+	variable.EXPECT().Size().Return(4).AnyTimes()
+	sym.EXPECT().VariableValue(variable, []byte{0, 0, 0, 0}, mem).Return(intValue([]byte{0, 0, 0, 0}), nil)
+	sym.EXPECT().VariableValue(variable, []byte{5, 0, 0, 0}, mem).Return(intValue([]byte{5, 0, 0, 0}), nil)
+	_, err = dbg.Watch("counter", 0)
+	assert.Nil(t, err)
+
+	event, err = dbg.StepInstructions(context.Background(), 0, 2, false)
+	assert.Nil(t, err)
+	assert.Equal(t, debugger.WatchpointHit, event.Reason)
+	assert.Equal(t, "Hardware watchpoint 2: counter\n\nOld value = 0\nNew value = 5", event.String())
+	assert.Equal(t, uint64(0x1a), m.registers["rip"])
+
+	_, err = dbg.StepInstructions(context.Background(), 0, 0, false)
+	assert.NotNil(t, err)
+}
+
+//Tests stepping a 1 byte instruction under a breakpoint leaves the PC just past
+//the breakpoint without it counting as hit, so continuing doesn't run it again
+func TestStepInstructionUnderBreakpoint(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, sym, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+
+	trace := []state{
+		state{rip: 0x0, rsp: 0x1000},
+		//the breakpoint on push %rbp is hit
+		state{rip: 0x11, rsp: 0x1000},
+		//push %rbp is single stepped
+		state{rip: 0x11, rsp: 0xff8},
+		//the breakpoint on the call is hit
+		state{rip: 0x15, rsp: 0xff8},
+	}
+	m := newMachine(t, trace, map[uint64]int{0x10: 5, 0x11: 5, 0x14: 6})
+	//push %rbp; mov %rsp,%rbp; call helper; nop
+	for i, b := range []byte{0x55, 0x48, 0x89, 0xe5, 0xe8, 0xe7, 0x00, 0x00, 0x00, 0x90} {
+		m.memory[0x10+uint64(i)] = b
+	}
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachLines(lineInfo)
+	functionAt(mockCtrl, sym)
+	lineInfo.EXPECT().LineAddresses("test.c", 5).Return([]uint64{0x10}, 5)
+	lineInfo.EXPECT().LineAddresses("test.c", 6).Return([]uint64{0x14}, 6)
+
+	first, _, err := dbg.BreakAt("test.c:5", "", 0)
+	assert.Nil(t, err)
+	second, _, err := dbg.BreakAt("test.c:6", "", 0)
+	assert.Nil(t, err)
+
+	event, err := dbg.Continue(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, fmt.Sprintf("Breakpoint %d hit at test.c:5", first), event.String())
+	instruction, err := dbg.CurrentInstruction(0)
+	assert.Nil(t, err)
+	assert.Equal(t, "=> 0x10 <main>:\tpush %rbp", instruction)
+
+	event, err = dbg.StepInstructions(context.Background(), 0, 1, false)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0x11), event.Address)
+	assert.Equal(t, byte(0xcc), m.memory[0x10])
+	instruction, err = dbg.CurrentInstruction(0)
+	assert.Nil(t, err)
+	assert.Equal(t, "=> 0x11 <main+1>:\tmov %rsp,%rbp", instruction)
+
+	event, err = dbg.Continue(context.Background(), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, fmt.Sprintf("Breakpoint %d hit at test.c:6", second), event.String())
+	assert.Equal(t, uint64(0x14), event.Address)
+}
+
+//Tests disassemble decodes the code in memory (without the break instructions
+//of breakpoints) marking the current instruction and the breakpoints
+func TestDisassemble(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mem, cntrl, lineInfo, regs, sym, dbg := setup(mockCtrl)
+	dummyRegisters := mocks.NewMockRegisters(mockCtrl)
+
+	m := newMachine(t, []state{state{rip: 0x11, rsp: 0x1000}}, map[uint64]int{0x10: 5, 0x14: 6, 0x19: 7})
+	//push %rbp; mov %rsp,%rbp; call helper; nop
+	for i, b := range []byte{0x55, 0x48, 0x89, 0xe5, 0xe8, 0xe7, 0x00, 0x00, 0x00, 0x90} {
+		m.memory[0x10+uint64(i)] = b
+	}
+	m.attach(mem, cntrl, lineInfo, regs, dummyRegisters)
+	m.attachLines(lineInfo)
+	functionAt(mockCtrl, sym)
+	lineInfo.EXPECT().LineAddresses("test.c", 6).Return([]uint64{0x14}, 6)
+
+	id, _, err := dbg.BreakAt("test.c:6", "", 0)
+	assert.Nil(t, err)
+
+	listing, err := dbg.Disassemble(0, "0x10, +0xa", false)
+	assert.Nil(t, err)
+	expected := []string{
+		"   0x10 <main>:\tpush %rbp\t# test.c:5",
+		"=> 0x11 <main+1>:\tmov %rsp,%rbp",
+		fmt.Sprintf("   0x14 <main+4>:\tcallq 0x100 <helper>\t# test.c:6\t[breakpoint %d]", id),
+		"   0x19 <main+9>:\tnop\t# test.c:7",
+	}
+	assert.Equal(t, strings.Join(expected, "\n"), listing)
+
+	listing, err = dbg.Disassemble(0, "0x10,0x14", true)
+	assert.Nil(t, err)
+	assert.Equal(t, "test.c:5\t\n   0x10 <main>:\tpush %rbp\n=> 0x11 <main+1>:\tmov %rsp,%rbp", listing)
+
+	listing, err = dbg.Disassemble(0, "", false)
+	assert.Nil(t, err)
+	//The rest of main is zeros which decode as 2 byte adds
+	assert.Equal(t, 4+(0x30-0x1a)/2, len(strings.Split(listing, "\n")))
+
+	_, err = dbg.Disassemble(0, "0x20,0x10", false)
+	assert.NotNil(t, err)
+	_, err = dbg.Disassemble(0, "0x10,0x10000000", false)
+	assert.NotNil(t, err)
+	_, err = dbg.Disassemble(0, "0x10,+0x10001", false)
+	assert.NotNil(t, err)
+	_, err = dbg.Disassemble(0, "0x10,+0xfffffffffffffff8", false)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,53 @@
+package debugger
+
+import "fmt"
+
+//Detach puts the domain back the way it was before it was debugged so it
+//can carry on running without the debugger. Every break instruction written
+//into memory is removed (the PC of the vcpu is moved back if it has just run
+//one) and single stepping and the debug registers are turned off on all of
+//the vcpus of the domain (they may still be armed if running was cut short).
+//The domain is paused first if it is running and is left paused.
+func (debugger *Debugger) Detach(vcpu uint32) error {
+	if !debugger.controller.IsPaused() {
+		err := debugger.controller.Pause()
+		if err != nil {
+			return err
+		}
+		err = debugger.recordTrap(vcpu)
+		if err != nil {
+			return err
+		}
+	}
+	debugger.resetStop()
+
+	err := debugger.rewindBreakpoint(vcpu)
+	if err != nil {
+		return err
+	}
+
+	//Breakpoints lifted to run the instruction under them are already gone
+	for _, address := range debugger.breakpointManager.Addresses() {
+		err = debugger.breakpointManager.Remove(address)
+		if err != nil {
+			return fmt.Errorf("Error: could not remove the breakpoint at 0x%x (%s)", address, err)
+		}
+	}
+
+	vcpus, err := debugger.controller.VCPUs()
+	if err != nil {
+		return err
+	}
+	debugger.armed = nil
+	for current := uint32(0); current < vcpus; current += 1 {
+		err = debugger.singleStep(current, false)
+		if err != nil {
+			return fmt.Errorf("Error: could not turn off single stepping on vcpu %d (%s)", current, err)
+		}
+		err = debugger.clearDebugRegisters(current)
+		if err != nil {
+			return fmt.Errorf("Error: could not clear the debug registers of vcpu %d (%s)", current, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package debugger
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"golang.org/x/arch/x86/x86asm"
+)
+
+//maxDisassembly is the most bytes an address range given to disassemble may cover
+const maxDisassembly = 64 * 1024
+
+//Disassemble decodes the instructions of a function (by name), an address range
+//("start,end" or "start,+length") or, if spec is empty, the function the VM is
+//stopped in. Each instruction is shown with its place in the source, the one
+//about to be run is marked with => and the breakpoints set on them are named.
+//If source is set the source lines are printed above their instructions instead.
+func (debugger *Debugger) Disassemble(vcpu uint32, spec string, source bool) (string, error) {
+	if !debugger.controller.IsPaused() {
+		return "", NotPaused
+	}
+
+	_, rip, _, err := debugger.stackPosition(vcpu)
+	if err != nil {
+		return "", err
+	}
+	//We may be sat just after one of our break instructions
+	rip = debugger.stopAddress(rip)
+
+	start, end, err := debugger.disassemblyRange(spec, rip)
+	if err != nil {
+		return "", err
+	}
+	code, err := debugger.readCode(start, uint(end-start))
+	if err != nil {
+		return "", err
+	}
+
+	var lines []string
+	files := make(map[string][]string)
+	previousFile, previousLine := "", 0
+	for offset := 0; offset < len(code); {
+		address := start + uint64(offset)
+		inst, err := x86asm.Decode(code[offset:], 64)
+		text := ""
+		if err != nil {
+			//Carry on from the next byte (this may be data)
+			inst.Len = 1
+			text = fmt.Sprintf("0x%x:\t(bad)", address)
+		} else {
+			text = debugger.formatInstruction(address, inst)
+		}
+
+		filename, line, lineErr := debugger.lineInfo.AddressToLine(address)
+		if lineErr == nil && source && (filename != previousFile || line != previousLine) {
+			lines = append(lines, fmt.Sprintf("%s:%d\t%s", filename, line, sourceLine(files, filename, line)))
+			previousFile, previousLine = filename, line
+		} else if lineErr == nil && !source {
+			text = fmt.Sprintf("%s\t# %s:%d", text, filename, line)
+		}
+
+		if breakpoint := debugger.breakpointManager.At(address); breakpoint != nil {
+			text = fmt.Sprintf("%s\t[breakpoint %d]", text, breakpoint.ID)
+		}
+		marker := "   "
+		if address == rip {
+			marker = "=> "
+		}
+		lines = append(lines, marker+text)
+		offset += inst.Len
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+//disassemblyRange - works out the addresses to disassemble (the last one is
+//not included) from a function name, "start,end", "start,+length" or an empty
+//string for the function containing rip
+func (debugger *Debugger) disassemblyRange(spec string, rip uint64) (uint64, uint64, error) {
+	spec = strings.Replace(spec, " ", "", -1)
+	if spec == "" {
+		function, err := debugger.symbols.GetFunction(rip)
+		if err != nil {
+			return 0, 0, fmt.Errorf("Error: no function contains 0x%x, give a range to disassemble instead (start,end)", rip)
+		}
+		start, end := function.Range()
+		return start, end, nil
+	}
+
+	bounds := strings.Split(spec, ",")
+	if len(bounds) == 1 {
+		function, err := debugger.symbols.LookupFunction(spec)
+		if err != nil {
+			return 0, 0, fmt.Errorf("Error: no function named %s", spec)
+		}
+		start, end := function.Range()
+		return start, end, nil
+	} else if len(bounds) != 2 {
+		return 0, 0, fmt.Errorf("Error: %s is not a range of addresses (expected start,end or start,+length)", spec)
+	}
+
+	start, err := strconv.ParseUint(bounds[0], 0, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Error: %s is not a valid address", bounds[0])
+	}
+	var end uint64
+	if strings.HasPrefix(bounds[1], "+") {
+		length, err := strconv.ParseUint(bounds[1][1:], 0, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("Error: %s is not a valid length", bounds[1][1:])
+		}
+		end = start + length
+		if end < start {
+			return 0, 0, fmt.Errorf("Error: 0x%x bytes from 0x%x goes past the end of memory", length, start)
+		}
+	} else {
+		end, err = strconv.ParseUint(bounds[1], 0, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("Error: %s is not a valid address", bounds[1])
+		}
+	}
+	if end <= start {
+		return 0, 0, fmt.Errorf("Error: the end of the range (0x%x) must be after its start (0x%x)", end, start)
+	}
+	if end-start > maxDisassembly {
+		return 0, 0, fmt.Errorf("Error: the range 0x%x,0x%x is too big to disassemble (at most 0x%x bytes can be)", start, end, maxDisassembly)
+	}
+	return start, end, nil
+}
+
+//sourceLine - returns a line of a source file (empty if it can't be read).
+//Files are read once and kept in files.
+func sourceLine(files map[string][]string, filename string, line int) string {
+	lines, ok := files[filename]
+	if !ok {
+		content, err := ioutil.ReadFile(filename)
+		if err == nil {
+			lines = strings.Split(string(content), "\n")
+		}
+		files[filename] = lines
+	}
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	return strings.TrimRight(lines[line-1], "\r")
+}
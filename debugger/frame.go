@@ -0,0 +1,203 @@
+package debugger
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-delve/delve/pkg/dwarf/op"
+)
+
+//maxFrames stops us unwinding forever when the stack has been corrupted
+const maxFrames = 256
+
+//Frame represents a single frame of the call stack
+type Frame struct {
+	//Level is the position of the frame in the stack (0 is the innermost frame)
+	Level int
+
+	//PC is the program counter of the frame (for callers this is the return address)
+	PC uint64
+
+	//Registers holds the registers of the frame. Please note in the callers only
+	//the PC, stack pointer and callee saved registers can be trusted.
+	Registers *op.DwarfRegisters
+
+	//Function the frame is executing (nil if there is no debugging information)
+	Function Function
+
+	//live holds the registers of the VM when Registers hasn't been fetched yet
+	//and symbols is used to work out their CFA once they are
+	live    Registers
+	symbols Symbol
+}
+
+//DwarfRegisters returns the registers of the frame in the format used
+//to evaluate DWARF locations
+func (frame *Frame) DwarfRegisters() *op.DwarfRegisters {
+	if frame.Registers == nil && frame.live != nil {
+		frame.Registers = frame.live.DwarfRegisters()
+		//The PC of the frame is moved back when the VM stopped at a breakpoint
+		if frame.Registers.PC() != frame.PC {
+			frame.Registers.AddReg(frame.Registers.PCRegNum, op.DwarfRegisterFromUint64(frame.PC))
+		}
+		//The registers guess the CFA from the frame pointer, which is wrong until
+		//the function has set it up. If the call frame information can't be used
+		//the guess is all we have.
+		frame.symbols.SetCFA(frame.Registers)
+	}
+	return frame.Registers
+}
+
+//ScopePC returns the PC used to look up the symbols of the frame. The PC
+//of a caller is the return address which may belong to the next line
+//(or even the next function), so we use the address inside the call instead.
+func (frame *Frame) ScopePC() uint64 {
+	if frame.Level == 0 {
+		return frame.PC
+	}
+	return frame.PC - 1
+}
+
+//stack - unwinds the call stack of the vcpu, the innermost frame comes first
+func (debugger *Debugger) stack(vcpu uint32) ([]*Frame, error) {
+	frame, err := debugger.innermostFrame(vcpu)
+	if err != nil {
+		return nil, err
+	}
+
+	frames := []*Frame{frame}
+	for {
+		function, err := debugger.symbols.GetFunction(frame.ScopePC())
+		if err != nil {
+			//Without debugging information we can't go any further
+			break
+		}
+		frame.Function = function
+		if len(frames) == maxFrames {
+			break
+		}
+
+		regs := frame.DwarfRegisters()
+		caller, err := debugger.symbols.Unwind(regs, debugger.memory)
+		if err != nil || caller.PC() == 0 || caller.SP() <= regs.SP() {
+			break
+		}
+		frame = &Frame{Level: len(frames), PC: caller.PC(), Registers: caller}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+//innermostFrame - builds the frame being executed from the registers of the VM.
+//If we've stopped at a breakpoint the PC is just past the break instruction so
+//the address of the breakpoint is used instead.
+func (debugger *Debugger) innermostFrame(vcpu uint32) (*Frame, error) {
+	registers, err := debugger.registers.GetRegisters(vcpu)
+	if err != nil {
+		return nil, err
+	}
+
+	rip, err := registers.GetRegister("rip")
+	if err != nil {
+		return nil, err
+	}
+	return &Frame{Level: 0, PC: debugger.stopAddress(rip), live: registers, symbols: debugger.symbols}, nil
+}
+
+//describeFrame - returns a human readable description of the frame
+//in the form: #1  0x118c in outer (a = 3) at backtrace.c:15
+func (debugger *Debugger) describeFrame(frame *Frame) string {
+	if frame.Function == nil {
+		return fmt.Sprintf("#%-2d 0x%x in ?? ()", frame.Level, frame.PC)
+	}
+
+	var arguments []string
+	for _, parameter := range frame.Function.Parameters() {
+		val := "<unavailable>"
+		bytes, err := debugger.readMemory(parameter, frame.Registers)
+		if err == nil && bytes != nil {
+			parsed, err := debugger.display(parameter, bytes)
+			if err == nil {
+				val = parsed
+			}
+		}
+		arguments = append(arguments, fmt.Sprintf("%s = %s", parameter.Name(), val))
+	}
+
+	description := fmt.Sprintf("#%-2d 0x%x in %s (%s)", frame.Level, frame.PC, frame.Function.Name(), strings.Join(arguments, ", "))
+	filename, line, err := debugger.lineInfo.AddressToLine(frame.ScopePC())
+	if err == nil {
+		description = fmt.Sprintf("%s at %s:%d", description, filename, line)
+	}
+	return description
+}
+
+//Backtrace returns a formatted list of the frames on the call stack,
+//starting with the frame currently being executed
+func (debugger *Debugger) Backtrace(vcpu uint32) (string, error) {
+	if !debugger.controller.IsPaused() {
+		return "", NotPaused
+	}
+
+	frames, err := debugger.stack(vcpu)
+	if err != nil {
+		return "", err
+	}
+
+	var descriptions []string
+	for _, frame := range frames {
+		descriptions = append(descriptions, debugger.describeFrame(frame))
+	}
+	return strings.Join(descriptions, "\n"), nil
+}
+
+//selectedFrame - returns the frame that variables should be read from.
+//The innermost frame is built straight from the registers of the VM so
+//we only unwind the stack when a caller has been selected.
+func (debugger *Debugger) selectedFrame(vcpu uint32) (*Frame, error) {
+	if debugger.frame == 0 {
+		return debugger.innermostFrame(vcpu)
+	}
+
+	frames, err := debugger.stack(vcpu)
+	if err != nil {
+		return nil, err
+	}
+	if debugger.frame >= len(frames) {
+		return nil, NoFrame
+	}
+	return frames[debugger.frame], nil
+}
+
+//SelectFrame selects the frame at the given level of the call stack
+//(0 being the innermost) and returns a description of it
+func (debugger *Debugger) SelectFrame(vcpu uint32, level int) (string, error) {
+	if !debugger.controller.IsPaused() {
+		return "", NotPaused
+	}
+
+	frames, err := debugger.stack(vcpu)
+	if err != nil {
+		return "", err
+	}
+	if level < 0 || level >= len(frames) {
+		return "", NoFrame
+	}
+	debugger.frame = level
+	return debugger.describeFrame(frames[level]), nil
+}
+
+//Up selects the frame count levels above the selected frame (towards the caller)
+func (debugger *Debugger) Up(vcpu uint32, count int) (string, error) {
+	return debugger.SelectFrame(vcpu, debugger.frame+count)
+}
+
+//Down selects the frame count levels below the selected frame (towards the callee)
+func (debugger *Debugger) Down(vcpu uint32, count int) (string, error) {
+	return debugger.SelectFrame(vcpu, debugger.frame-count)
+}
+
+//CurrentFrame returns a description of the selected frame
+func (debugger *Debugger) CurrentFrame(vcpu uint32) (string, error) {
+	return debugger.SelectFrame(vcpu, debugger.frame)
+}
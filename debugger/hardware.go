@@ -0,0 +1,248 @@
+package debugger
+
+import "context"
+
+//The x86 debug registers (Intel SDM Vol. 3B, section 17.2). DR0-DR3 hold
+//the addresses to stop at, DR7 enables them and DR6 is set by the CPU to
+//say which of them caused the VM to stop.
+const (
+	//debugSlots is the number of debug address registers (DR0-DR3)
+	debugSlots = 4
+
+	//dr6Slots are the bits of DR6 (B0-B3) set when an address register is hit
+	dr6Slots uint64 = 0xf
+
+	//The R/W bits of DR7 say what kind of access stops the VM (there
+	//is no way to only stop on reads)
+	accessExecute   uint64 = 0
+	accessWrite     uint64 = 1
+	accessReadWrite uint64 = 3
+)
+
+var debugAddressRegisters = [debugSlots]string{"dr0", "dr1", "dr2", "dr3"}
+
+//lengthBits maps the number of bytes watched to the LEN bits of DR7
+var lengthBits = map[uint64]uint64{1: 0, 2: 1, 8: 2, 4: 3}
+
+//debugRegion is what gets loaded into one of the debug registers
+type debugRegion struct {
+	address uint64
+	access  uint64
+	length  uint64
+
+	//id is the number of the breakpoint the region belongs to
+	id int
+}
+
+//armMode says what is loaded into the debug registers when the VM is run
+type armMode int
+
+const (
+	armNone armMode = iota
+	//armBreakpoints is used by next and finish
+	armBreakpoints
+	//armWatchpoints is used when single stepping (breakpoints are checked
+	//after each instruction instead)
+	armWatchpoints
+	//armAll is used by continue
+	armAll
+)
+
+//includes - checks whether a region is loaded into the debug registers in the mode
+func (mode armMode) includes(region debugRegion) bool {
+	if region.access == accessExecute {
+		return mode == armBreakpoints || mode == armAll
+	}
+	return mode == armWatchpoints || mode == armAll
+}
+
+//dr7Enable - returns the bits of DR7 which (locally) enable an address register
+//along with the kind and length of access it stops on
+func dr7Enable(slot int, region debugRegion) uint64 {
+	shift := 16 + uint(slot)*4
+	return 1<<(uint(slot)*2) | region.access<<shift | lengthBits[region.length]<<(shift+2)
+}
+
+//watchRegions - splits memory into the regions watched by the debug registers.
+//A register can only watch 1, 2, 4 or 8 bytes aligned to their length so a
+//variable may need several of them.
+func watchRegions(address uint64, size int, access uint64, id int) []debugRegion {
+	var regions []debugRegion
+	end := address + uint64(size)
+	for address < end {
+		length := uint64(8)
+		for address%length != 0 || address+length > end {
+			length /= 2
+		}
+		regions = append(regions, debugRegion{address: address, access: access, length: length, id: id})
+		address += length
+	}
+	return regions
+}
+
+//slotsHit - decodes DR6 and returns the address registers which stopped the VM
+func slotsHit(dr6 uint64) []int {
+	var slots []int
+	for slot := 0; slot < debugSlots; slot++ {
+		if dr6&dr6Slots&(1<<uint(slot)) != 0 {
+			slots = append(slots, slot)
+		}
+	}
+	return slots
+}
+
+//armHardware - loads the enabled hardware breakpoints and watchpoints included
+//in the mode into the debug registers of the vcpu. Nothing is written if there
+//is nothing to load.
+func (debugger *Debugger) armHardware(vcpu uint32, mode armMode) error {
+	var regions []debugRegion
+	for _, region := range debugger.breakpointManager.debugRegions() {
+		if mode.includes(region) {
+			regions = append(regions, region)
+		}
+	}
+	if len(regions) == 0 {
+		return nil
+	}
+
+	registers, err := debugger.registers.GetRegisters(vcpu)
+	if err != nil {
+		return err
+	}
+
+	dr7 := uint64(0)
+	for slot, region := range regions {
+		err = registers.SetRegister(debugAddressRegisters[slot], region.address)
+		if err != nil {
+			return err
+		}
+		dr7 |= dr7Enable(slot, region)
+	}
+
+	//DR6 is never cleared by the CPU so we do it before each run
+	err = registers.SetRegister("dr6", 0)
+	if err != nil {
+		return err
+	}
+	err = registers.SetRegister("dr7", dr7)
+	if err != nil {
+		return err
+	}
+
+	err = debugger.registers.SetRegisters(vcpu, registers)
+	if err != nil {
+		return err
+	}
+	debugger.armed = regions
+	return nil
+}
+
+//disarmHardware - turns the debug registers off again once the VM has stopped
+//(so stepping over an instruction doesn't hit the same hardware breakpoint) and
+//returns the hardware breakpoint or watchpoint that stopped the VM (nil if none did)
+func (debugger *Debugger) disarmHardware(vcpu uint32) (*Breakpoint, error) {
+	if debugger.armed == nil {
+		return nil, nil
+	}
+	armed := debugger.armed
+	debugger.armed = nil
+
+	registers, err := debugger.registers.GetRegisters(vcpu)
+	if err != nil {
+		return nil, err
+	}
+
+	dr6, err := registers.GetRegister("dr6")
+	if err != nil {
+		return nil, err
+	}
+
+	err = registers.SetRegister("dr6", 0)
+	if err != nil {
+		return nil, err
+	}
+	err = registers.SetRegister("dr7", 0)
+	if err != nil {
+		return nil, err
+	}
+	err = debugger.registers.SetRegisters(vcpu, registers)
+	if err != nil {
+		return nil, err
+	}
+
+	slots := slotsHit(dr6)
+	if len(slots) == 0 || slots[0] >= len(armed) {
+		return nil, nil
+	}
+	breakpoint, err := debugger.breakpointManager.Lookup(armed[slots[0]].id)
+	if err != nil {
+		return nil, err
+	}
+	return breakpoint, nil
+}
+
+//clearDebugRegisters - turns off every hardware breakpoint and watchpoint
+//on the vcpu (and forgets which of them stopped it)
+func (debugger *Debugger) clearDebugRegisters(vcpu uint32) error {
+	registers, err := debugger.registers.GetRegisters(vcpu)
+	if err != nil {
+		return err
+	}
+	err = registers.SetRegister("dr6", 0)
+	if err != nil {
+		return err
+	}
+	err = registers.SetRegister("dr7", 0)
+	if err != nil {
+		return err
+	}
+	return debugger.registers.SetRegisters(vcpu, registers)
+}
+
+//run - unpauses the VM with the hardware breakpoints and watchpoints included
+//in the mode armed and waits until it stops. Returns the hardware breakpoint or
+//watchpoint that stopped it (if one did). Unlike a break instruction the CPU stops
+//before the instruction at a hardware breakpoint is run so the PC doesn't need to
+//be moved back. Watchpoints stop after the instruction accessing the memory.
+func (debugger *Debugger) run(ctx context.Context, vcpu uint32, mode armMode) (*Breakpoint, error) {
+	err := debugger.armHardware(vcpu, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	err = debugger.controller.Unpause()
+	if err != nil {
+		return nil, err
+	}
+
+	//Wait until we hit the next breakpoint
+	err = debugger.waitForStop(ctx)
+	if err != nil && err == ctx.Err() {
+		//The VM has been paused so the debug registers are cleared
+		//the same as if it had stopped by itself
+		_, disarmErr := debugger.disarmHardware(vcpu)
+		if disarmErr == nil {
+			disarmErr = debugger.recordTrap(vcpu)
+		}
+		if disarmErr != nil {
+			return nil, disarmErr
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = debugger.recordTrap(vcpu)
+	if err != nil {
+		return nil, err
+	}
+	return debugger.disarmHardware(vcpu)
+}
+
+//onHardwareBreakpoint - checks whether the VM is sat on the address of an
+//enabled hardware breakpoint
+func (debugger *Debugger) onHardwareBreakpoint(rip uint64) bool {
+	breakpoint := debugger.breakpointManager.At(rip)
+	return breakpoint != nil && breakpoint.Hardware && breakpoint.Enabled
+}
@@ -0,0 +1,189 @@
+package debugger
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/arch/x86/x86asm"
+)
+
+//maxInstructionLength is the most bytes an x86 instruction can take
+const maxInstructionLength = 15
+
+//readCode - reads the code in memory at the address with the break
+//instructions of breakpoints replaced by the bytes they overwrote (the ELF
+//file isn't used as the guest may have changed or relocated its code)
+func (debugger *Debugger) readCode(address uint64, size uint) ([]byte, error) {
+	code, err := debugger.memory.Read(address, size)
+	if err != nil {
+		return nil, err
+	}
+	//Memory may hand back its own buffer so we change a copy
+	code = append([]byte(nil), code...)
+	debugger.breakpointManager.OriginalBytes(address, code)
+	return code, nil
+}
+
+//decode - decodes the x86-64 instruction in memory at the address
+func (debugger *Debugger) decode(address uint64) (x86asm.Inst, error) {
+	code, err := debugger.readCode(address, maxInstructionLength)
+	if err != nil {
+		return x86asm.Inst{}, err
+	}
+	inst, err := x86asm.Decode(code, 64)
+	if err != nil {
+		return x86asm.Inst{}, fmt.Errorf("Error: could not decode the instruction at 0x%x (%s)", address, err)
+	}
+	return inst, nil
+}
+
+//symbolName - returns the function an address is in and the address the
+//function starts at (used to show addresses as function+offset)
+func (debugger *Debugger) symbolName(address uint64) (string, uint64) {
+	function, err := debugger.symbols.GetFunction(address)
+	if err != nil {
+		return "", 0
+	}
+	low, _ := function.Range()
+	return function.Name(), low
+}
+
+//symbolOffset - describes an address as <function+offset> (empty if the
+//address isn't in a function)
+func (debugger *Debugger) symbolOffset(address uint64) string {
+	name, base := debugger.symbolName(address)
+	if name == "" {
+		return ""
+	}
+	if address == base {
+		return fmt.Sprintf("<%s>", name)
+	}
+	return fmt.Sprintf("<%s+%d>", name, address-base)
+}
+
+//formatInstruction - formats a decoded instruction in AT&T syntax (the same
+//as gdb and objdump) after its address, e.g. "0x401004 <main+4>:\tmov %rsp,%rbp"
+func (debugger *Debugger) formatInstruction(address uint64, inst x86asm.Inst) string {
+	text := x86asm.GNUSyntax(inst, address, nil)
+	//Calls and jumps are followed by where they go to
+	for _, arg := range inst.Args {
+		if relative, ok := arg.(x86asm.Rel); ok {
+			target := address + uint64(inst.Len) + uint64(int64(relative))
+			if symbol := debugger.symbolOffset(target); symbol != "" {
+				text = fmt.Sprintf("%s %s", text, symbol)
+			}
+		}
+	}
+	if symbol := debugger.symbolOffset(address); symbol != "" {
+		return fmt.Sprintf("0x%x %s:\t%s", address, symbol, text)
+	}
+	return fmt.Sprintf("0x%x:\t%s", address, text)
+}
+
+//CurrentInstruction returns the instruction the vcpu is about to run decoded
+//as x86-64 assembly, e.g. "=> 0x401004 <main+4>:\tmov %rsp,%rbp"
+func (debugger *Debugger) CurrentInstruction(vcpu uint32) (string, error) {
+	if !debugger.controller.IsPaused() {
+		return "", NotPaused
+	}
+
+	_, rip, _, err := debugger.stackPosition(vcpu)
+	if err != nil {
+		return "", err
+	}
+	//We may be sat just after one of our break instructions
+	rip = debugger.stopAddress(rip)
+
+	inst, err := debugger.decode(rip)
+	if err != nil {
+		return "", err
+	}
+	return "=> " + debugger.formatInstruction(rip, inst), nil
+}
+
+//StepInstructions runs exactly count machine instructions (stepi). If over is
+//set a call is run until it returns as if it were a single instruction (nexti),
+//though a breakpoint hit inside the function called still stops it. Stepping
+//stops early at a breakpoint or when a watchpoint is hit. Returns where the VM
+//stopped.
+func (debugger *Debugger) StepInstructions(ctx context.Context, vcpu uint32, count int, over bool) (StopEvent, error) {
+	if !debugger.controller.IsPaused() {
+		return StopEvent{}, NotPaused
+	}
+	if count < 1 {
+		return StopEvent{}, fmt.Errorf("Error: the number of instructions to step must be at least 1")
+	}
+	debugger.resetStop()
+
+	err := debugger.rewindBreakpoint(vcpu)
+	if err != nil {
+		return StopEvent{}, err
+	}
+
+	registers, rip, rsp, err := debugger.stackPosition(vcpu)
+	if err != nil {
+		return StopEvent{}, err
+	}
+
+	for i := 0; i < count; i += 1 {
+		previousRip, previousRsp := rip, rsp
+		hit, err := debugger.stepInstructionArmed(ctx, vcpu, armWatchpoints)
+		if err != nil {
+			return debugger.stoppedEarly(ctx, vcpu, err)
+		}
+
+		registers, rip, rsp, err = debugger.stackPosition(vcpu)
+		if err != nil {
+			return StopEvent{}, err
+		}
+		event, stop, err := debugger.steppedStops(registers, hit, vcpu, rip, rsp, nil)
+		if err != nil {
+			return StopEvent{}, err
+		}
+		if stop {
+			debugger.lineInfo.IsNewLine(rip)
+			return debugger.locate(event), debugger.deleteTemporaryHit(vcpu)
+		}
+		if !over {
+			continue
+		}
+
+		//We've entered a function, so we let it run until it returns to us
+		address, isCall, err := debugger.returnAddress(previousRip, previousRsp, rsp)
+		if err != nil {
+			return StopEvent{}, err
+		}
+		if !isCall {
+			continue
+		}
+		reached, err := debugger.runUntil(ctx, vcpu, address, previousRsp)
+		if err != nil {
+			return debugger.stoppedEarly(ctx, vcpu, err)
+		}
+
+		_, rip, rsp, err = debugger.stackPosition(vcpu)
+		if err != nil {
+			return StopEvent{}, err
+		}
+		if !reached {
+			//Stopped at a breakpoint inside the function called
+			return debugger.breakpointInCall(vcpu, rip)
+		}
+	}
+
+	debugger.lineInfo.IsNewLine(rip)
+	return debugger.locate(StopEvent{Reason: StepComplete, Address: rip}), nil
+}
+
+//breakpointInCall - describes a breakpoint stopping the VM while it was
+//running a function until it returned
+func (debugger *Debugger) breakpointInCall(vcpu uint32, rip uint64) (StopEvent, error) {
+	address := debugger.stopAddress(rip)
+	if debugger.stoppedBy == nil {
+		debugger.lineInfo.IsNewLine(rip)
+		return debugger.unexpectedStop(rip)
+	}
+	debugger.lineInfo.IsNewLine(address)
+	event := debugger.locate(breakpointEvent(debugger.stoppedBy, address))
+	return event, debugger.deleteTemporaryHit(vcpu)
+}
@@ -0,0 +1,292 @@
+package debugger
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/arch/x86/x86asm"
+)
+
+//DomainState is the state of the domain as reported by the hypervisor
+type DomainState struct {
+	Paused bool
+
+	//Shutdown is set once the domain has shut down and Reason is the
+	//code it gave (e.g. SHUTDOWN_poweroff is 0 and SHUTDOWN_crash is 3)
+	Shutdown bool
+	Reason   int
+
+	//Crashed is set when the domain has crashed
+	Crashed bool
+
+	//Destroyed is set once the domain no longer exists (a domain is
+	//normally destroyed straight after it shuts down)
+	Destroyed bool
+}
+
+//shutdownCrash is the reason code of a domain that has crashed
+const shutdownCrash = 3
+
+//shutdownReasons are the names of the reason codes a domain shuts down with
+var shutdownReasons = []string{"poweroff", "reboot", "suspend", "crash", "watchdog", "soft_reset"}
+
+//StopReason is why the VM stopped running
+type StopReason int
+
+const (
+	//BreakpointHit - one of the user's breakpoints stopped the VM
+	BreakpointHit StopReason = iota
+
+	//WatchpointHit - a watchpoint stopped the VM
+	WatchpointHit
+
+	//WatchpointScope - watchpoints were deleted as the frame of
+	//their variables returned
+	WatchpointScope
+
+	//LocationReached - the location given to until or advance was
+	//reached (or the frame returned first)
+	LocationReached
+
+	//StepComplete - a step finished on a new line
+	StepComplete
+
+	//ExternalPause - the domain was paused from outside of the debugger
+	//(e.g. by running xl pause)
+	ExternalPause
+
+	//ForeignTrap - the VM ran a break instruction that the debugger
+	//didn't set (e.g. one compiled into the guest). Xen doesn't tell us why
+	//a domain paused so this is worked out by decoding the instruction before
+	//the PC. Outside of a known function only the byte before it can be read,
+	//so an external pause just after an instruction ending in 0xcc is
+	//reported as a ForeignTrap.
+	ForeignTrap
+
+	//DomainShutdown - the domain shut down
+	DomainShutdown
+
+	//DomainCrash - the domain crashed
+	DomainCrash
+
+	//Interrupted - the user interrupted the VM while it was running
+	//(e.g. by pressing Ctrl-C or running interrupt)
+	Interrupted
+
+	//TimedOut - the VM was paused as it ran for longer than it was
+	//allowed to (e.g. continue --for 5s)
+	TimedOut
+)
+
+//StopEvent describes why the VM stopped and where
+type StopEvent struct {
+	Reason StopReason
+
+	//Breakpoint is the number of the breakpoint or watchpoint that
+	//stopped the VM (0 if it wasn't one)
+	Breakpoint int
+	Temporary  bool
+
+	//Address is where the VM stopped, Filename and Line are its
+	//place in the source (empty if there is no line information)
+	Address  uint64
+	Filename string
+	Line     int
+
+	//Report holds the values of watchpoints and the ones deleted
+	Report string
+
+	//ShutdownCode is the reason code given when the domain shut down
+	ShutdownCode int
+}
+
+//Exited - checks whether the domain has gone (so there is nowhere to show)
+func (event StopEvent) Exited() bool {
+	return event.Reason == DomainShutdown || event.Reason == DomainCrash
+}
+
+//String - describes the event for the user, e.g. "Breakpoint 2 hit at foo.c:10"
+func (event StopEvent) String() string {
+	place := location{addresses: []uint64{event.Address}, filename: event.Filename, line: event.Line}
+	switch event.Reason {
+	case BreakpointHit:
+		if event.Temporary {
+			return fmt.Sprintf("Temporary breakpoint %d hit at %s", event.Breakpoint, place)
+		}
+		return fmt.Sprintf("Breakpoint %d hit at %s", event.Breakpoint, place)
+	case WatchpointHit, WatchpointScope:
+		return event.Report
+	case LocationReached:
+		return fmt.Sprintf("Reached %s", place)
+	case StepComplete:
+		return fmt.Sprintf("Stepped to %s", place)
+	case ExternalPause:
+		return fmt.Sprintf("Paused from outside of the debugger at %s", place)
+	case ForeignTrap:
+		return fmt.Sprintf("Hit a break instruction not set by the debugger at %s", place)
+	case DomainShutdown:
+		reason := "unknown reason"
+		if event.ShutdownCode >= 0 && event.ShutdownCode < len(shutdownReasons) {
+			reason = shutdownReasons[event.ShutdownCode]
+		}
+		return fmt.Sprintf("The domain has shut down (reason %d: %s)", event.ShutdownCode, reason)
+	case DomainCrash:
+		return "The domain has crashed"
+	case Interrupted:
+		return fmt.Sprintf("Interrupted at %s", place)
+	case TimedOut:
+		return fmt.Sprintf("Timed out at %s", place)
+	}
+	return ""
+}
+
+//domainExited is returned when the domain shuts down or crashes while
+//we are waiting for it to stop
+type domainExited struct {
+	state DomainState
+}
+
+func (err domainExited) Error() string {
+	return fmt.Sprintf("Error: %s", err.event())
+}
+
+//event - converts the state of the domain into a stop event
+func (err domainExited) event() StopEvent {
+	if err.state.Crashed || (err.state.Shutdown && err.state.Reason == shutdownCrash) {
+		return StopEvent{Reason: DomainCrash, ShutdownCode: err.state.Reason}
+	}
+	if err.state.Destroyed {
+		return StopEvent{Reason: DomainShutdown, ShutdownCode: -1}
+	}
+	return StopEvent{Reason: DomainShutdown, ShutdownCode: err.state.Reason}
+}
+
+//exitEvent - checks whether an error is the domain exiting and if so
+//returns the event describing it
+func exitEvent(err error) (StopEvent, bool) {
+	exited, ok := err.(domainExited)
+	if !ok {
+		return StopEvent{}, false
+	}
+	return exited.event(), true
+}
+
+//waitForStop - blocks until the VM is paused again. If the domain shuts down
+//or crashes instead an error describing it is returned. If the context is
+//cancelled first the domain is paused and the error of the context returned.
+func (debugger *Debugger) waitForStop(ctx context.Context) error {
+	state, err := debugger.controller.WaitForStop(ctx)
+	if err != nil && err == ctx.Err() {
+		pauseErr := debugger.controller.Pause()
+		if pauseErr != nil {
+			return pauseErr
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if state.Shutdown || state.Crashed || state.Destroyed {
+		return domainExited{state: state}
+	}
+	return nil
+}
+
+//interruptedEvent - describes the VM being paused where it was because the
+//context of a wait was cancelled (Interrupted) or timed out (TimedOut). Any
+//other error is returned as it is.
+func (debugger *Debugger) interruptedEvent(vcpu uint32, err error) (StopEvent, error) {
+	reason := Interrupted
+	if err == context.DeadlineExceeded {
+		reason = TimedOut
+	} else if err != context.Canceled {
+		return StopEvent{}, err
+	}
+
+	registers, err := debugger.registers.GetRegisters(vcpu)
+	if err != nil {
+		return StopEvent{}, err
+	}
+	rip, err := registers.GetRegister("rip")
+	if err != nil {
+		return StopEvent{}, err
+	}
+
+	//The VM may have been paused just after running one of our break
+	//instructions (resuming steps back over it)
+	address := debugger.stopAddress(rip)
+	debugger.lineInfo.IsNewLine(address)
+	return StopEvent{Reason: reason, Address: address}, nil
+}
+
+//stoppedEarly - converts an error from running the VM into an event if it
+//is the domain exiting or the wait for it being interrupted
+func (debugger *Debugger) stoppedEarly(ctx context.Context, vcpu uint32, err error) (StopEvent, error) {
+	if event, exited := exitEvent(err); exited {
+		return event, nil
+	}
+	if err != ctx.Err() {
+		return StopEvent{}, err
+	}
+	event, err := debugger.interruptedEvent(vcpu, err)
+	if err != nil {
+		return StopEvent{}, err
+	}
+	return debugger.locate(event), nil
+}
+
+//locate - fills in the place in the source of the address of an event
+func (debugger *Debugger) locate(event StopEvent) StopEvent {
+	filename, line, err := debugger.lineInfo.AddressToLine(event.Address)
+	if err == nil {
+		event.Filename, event.Line = filename, line
+	}
+	return event
+}
+
+//unexpectedStop - describes the VM stopping somewhere without one of our
+//breakpoints. If a break instruction was just run it belongs to the guest,
+//otherwise the domain was paused by someone else.
+func (debugger *Debugger) unexpectedStop(rip uint64) (StopEvent, error) {
+	trapped, err := debugger.afterBreakInstruction(rip)
+	if err != nil {
+		return StopEvent{}, err
+	}
+	if trapped {
+		return StopEvent{Reason: ForeignTrap, Address: rip - 1}, nil
+	}
+	return StopEvent{Reason: ExternalPause, Address: rip}, nil
+}
+
+//afterBreakInstruction - checks whether the instruction just before the PC is a
+//break instruction. The function the PC is in is decoded from its start so the
+//last byte of a longer instruction (e.g. mov $0xcc,%al) isn't mistaken for one.
+//Outside of the functions we know about only the byte before the PC is checked.
+func (debugger *Debugger) afterBreakInstruction(rip uint64) (bool, error) {
+	function, err := debugger.symbols.GetFunction(rip - 1)
+	if err != nil {
+		code, err := debugger.readCode(rip-1, 1)
+		if err != nil {
+			return false, err
+		}
+		return code[0] == 0xcc, nil
+	}
+
+	address, _ := function.Range()
+	for address < rip {
+		inst, err := debugger.decode(address)
+		if err != nil {
+			return false, err
+		}
+		if address+uint64(inst.Len) == rip {
+			return inst.Op == x86asm.INT && inst.Len == 1, nil
+		}
+		address += uint64(inst.Len)
+	}
+	return false, nil
+}
+
+//breakpointEvent - describes a breakpoint stopping the VM at the address
+func breakpointEvent(breakpoint *Breakpoint, address uint64) StopEvent {
+	return StopEvent{Reason: BreakpointHit, Breakpoint: breakpoint.ID, Temporary: breakpoint.Temporary, Address: address}
+}
@@ -0,0 +1,113 @@
+package debugger
+
+import (
+	"context"
+	"fmt"
+)
+
+//destination is where until and advance stop. It is reached at any of the
+//addresses, or at the return address once the frame we started in returns.
+type destination struct {
+	addresses []uint64
+
+	//returnPC and returnSP are the PC and stack pointer of the caller
+	//(checking the stack pointer stops a recursive call returning to
+	//the same address from being mistaken for the frame returning)
+	returnPC uint64
+	returnSP uint64
+}
+
+//reached - checks whether the VM stopping at the address has reached the
+//destination (nil destinations are never reached)
+func (dest *destination) reached(address, rsp uint64) bool {
+	if dest == nil {
+		return false
+	}
+	for _, target := range dest.addresses {
+		if address == target {
+			return true
+		}
+	}
+	return address == dest.returnPC && rsp >= dest.returnSP
+}
+
+//addTraps - sets a temporary breakpoint at each address of the destination
+//and adds them to the traps to be removed
+func (dest *destination) addTraps(debugger *Debugger, traps map[uint64]bool) error {
+	if dest == nil {
+		return nil
+	}
+	for _, address := range dest.addresses {
+		err := debugger.addTrap(traps, address)
+		if err != nil {
+			return err
+		}
+	}
+	return debugger.addTrap(traps, dest.returnPC)
+}
+
+//addTrap - sets a temporary breakpoint at the address unless there is already
+//a break instruction there. Addresses that are set are added to the traps.
+func (debugger *Debugger) addTrap(traps map[uint64]bool, address uint64) error {
+	if address == 0 || traps[address] || debugger.breakpointManager.AddressIsBreakpoint(address) {
+		return nil
+	}
+	err := debugger.breakpointManager.Add(address)
+	if err != nil {
+		return err
+	}
+	traps[address] = true
+	return nil
+}
+
+//moveTo - sets the PC of the vcpu to the address
+func (debugger *Debugger) moveTo(vcpu uint32, registers Registers, address uint64) error {
+	err := registers.SetRegister("rip", address)
+	if err != nil {
+		return err
+	}
+	return debugger.registers.SetRegisters(vcpu, registers)
+}
+
+//deleteTemporaryHit - deletes the temporary breakpoint which has just stopped
+//the VM (if there is one)
+func (debugger *Debugger) deleteTemporaryHit(vcpu uint32) error {
+	breakpoint := debugger.stoppedBy
+	if breakpoint == nil || !breakpoint.Temporary {
+		return nil
+	}
+	return debugger.liftBreakpoint(vcpu, breakpoint, debugger.breakpointManager.Delete)
+}
+
+//Until continues the VM until a location (file.c:line, a function or *address)
+//is reached or the current function returns, whichever happens first. Breakpoints
+//and watchpoints hit along the way still stop the VM, and the temporary breakpoints
+//used are removed whatever stops it. Returns why the VM stopped.
+func (debugger *Debugger) Until(ctx context.Context, spec string, vcpu uint32) (StopEvent, error) {
+	if !debugger.controller.IsPaused() {
+		return StopEvent{}, NotPaused
+	}
+
+	place, err := debugger.resolveLocation(spec)
+	if err != nil {
+		return StopEvent{}, err
+	}
+
+	err = debugger.rewindBreakpoint(vcpu)
+	if err != nil {
+		return StopEvent{}, err
+	}
+
+	registers, err := debugger.registers.GetRegisters(vcpu)
+	if err != nil {
+		return StopEvent{}, err
+	}
+
+	caller, err := debugger.symbols.Unwind(registers.DwarfRegisters(), debugger.memory)
+	if err != nil {
+		return StopEvent{}, fmt.Errorf("Error: cannot find where the current function returns to (%s)", err)
+	}
+
+	dest := &destination{addresses: place.addresses, returnPC: caller.PC(), returnSP: caller.SP()}
+	return debugger.continueTo(ctx, vcpu, dest)
+}
@@ -0,0 +1,372 @@
+package debugger
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+//ValueKind is what sort of C value a Value holds
+type ValueKind int
+
+const (
+	SignedValue ValueKind = iota
+	UnsignedValue
+	CharValue
+	BoolValue
+	FloatValue
+	PointerValue
+	StructValue
+	UnionValue
+	ArrayValue
+	EnumValue
+)
+
+func (kind ValueKind) String() string {
+	switch kind {
+	case SignedValue:
+		return "signed"
+	case UnsignedValue:
+		return "unsigned"
+	case CharValue:
+		return "char"
+	case BoolValue:
+		return "bool"
+	case FloatValue:
+		return "float"
+	case PointerValue:
+		return "pointer"
+	case StructValue:
+		return "struct"
+	case UnionValue:
+		return "union"
+	case ArrayValue:
+		return "array"
+	case EnumValue:
+		return "enum"
+	}
+	return "unknown"
+}
+
+//Format is a gdb style letter saying how to print a value (e.g. x for hex)
+type Format byte
+
+const (
+	//NaturalFormat prints each value the way its type suggests
+	NaturalFormat Format = 0
+	HexFormat     Format = 'x'
+	OctalFormat   Format = 'o'
+	BinaryFormat  Format = 't'
+	DecimalFormat Format = 'd'
+	CharFormat    Format = 'c'
+	StringFormat  Format = 's'
+	FloatFormat   Format = 'f'
+)
+
+//ParseFormat returns the format with the letter given (e.g. x for print/x)
+func ParseFormat(letter string) (Format, error) {
+	if len(letter) == 1 && strings.Contains("xotdcsf", letter) {
+		return Format(letter[0]), nil
+	}
+	return NaturalFormat, fmt.Errorf("Error: undefined output format %q (expected one of x, o, t, d, c, s or f)", letter)
+}
+
+//maxString is the most bytes of a string read for a char pointer
+const maxString = 200
+
+//Value is a value in the program being debugged, such as a variable or the
+//result of an expression. Structs, unions and arrays hold their members or
+//elements as children and pointers can load the value they point to, so a
+//frontend can show as much or as little of a value as it likes.
+type Value struct {
+	//Name is the expression, member name or index ([2]) of the value
+	Name string
+	Kind ValueKind
+	//Type is the C name of the type (e.g. unsigned int or struct node *)
+	Type string
+	//Address is where the value is stored (only set if InMemory is)
+	Address  uint64
+	InMemory bool
+	//Bytes are the raw bytes of the value
+	Bytes     []byte
+	Children  []*Value
+	Endianess binary.ByteOrder
+
+	//target loads the value a pointer points to and memory is used to
+	//read the string a char pointer points to
+	target func() (*Value, error)
+	memory MemoryAccess
+
+	//symbol is the name of the enumerator (or flags OR-ed together) an
+	//enum holds and enumSigned is whether its values are signed
+	symbol     string
+	enumSigned bool
+}
+
+//SetTarget sets the function used to load the value a pointer points to
+func (value *Value) SetTarget(target func() (*Value, error)) {
+	value.target = target
+}
+
+//SetMemory sets the memory strings pointed to by the value are read from
+func (value *Value) SetMemory(memory MemoryAccess) {
+	value.memory = memory
+}
+
+//SetEnum sets the name of the value an enum holds (empty if it doesn't have
+//one) and whether the enum's values are signed
+func (value *Value) SetEnum(symbol string, signed bool) {
+	value.symbol = symbol
+	value.enumSigned = signed
+}
+
+//Symbol returns the name of the enumerator an enum holds, or the flags OR-ed
+//together (e.g. READ | WRITE). It is empty if the value isn't named.
+func (value *Value) Symbol() string {
+	return value.symbol
+}
+
+//Target returns the value a pointer points to. It is read from memory
+//each time so a frontend only pays for the pointers it follows.
+func (value *Value) Target() (*Value, error) {
+	if value.Kind != PointerValue || value.target == nil {
+		return nil, NotPointer
+	}
+	return value.target()
+}
+
+//Child returns the member or element with the name given (nil if there isn't one)
+func (value *Value) Child(name string) *Value {
+	for _, child := range value.Children {
+		if child.Name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+//Int returns the value of a signed integer or char (sign extended)
+func (value *Value) Int() int64 {
+	switch len(value.Bytes) {
+	case 1:
+		return int64(int8(value.Bytes[0]))
+	case 2:
+		return int64(int16(value.Endianess.Uint16(value.Bytes)))
+	case 4:
+		return int64(int32(value.Endianess.Uint32(value.Bytes)))
+	case 8:
+		return int64(value.Endianess.Uint64(value.Bytes))
+	}
+	return 0
+}
+
+//Uint returns the value of an unsigned integer, bool or pointer
+func (value *Value) Uint() uint64 {
+	switch len(value.Bytes) {
+	case 1:
+		return uint64(value.Bytes[0])
+	case 2:
+		return uint64(value.Endianess.Uint16(value.Bytes))
+	case 4:
+		return uint64(value.Endianess.Uint32(value.Bytes))
+	case 8:
+		return value.Endianess.Uint64(value.Bytes)
+	}
+	return 0
+}
+
+//Float returns the value of a float or double
+func (value *Value) Float() float64 {
+	if len(value.Bytes) == 4 {
+		return float64(math.Float32frombits(value.Endianess.Uint32(value.Bytes)))
+	} else if len(value.Bytes) == 8 {
+		return math.Float64frombits(value.Endianess.Uint64(value.Bytes))
+	}
+	return 0
+}
+
+//signed - returns whether an integer is signed (a char's type says if it's not)
+func (value *Value) signed() bool {
+	switch value.Kind {
+	case SignedValue:
+		return true
+	case CharValue:
+		return !strings.Contains(value.Type, "unsigned")
+	case EnumValue:
+		return value.enumSigned
+	}
+	return false
+}
+
+//inRadix - returns an integer as text in the radix given (8, 10 or 16). Hex
+//and octal show the bits of the value so negative numbers aren't signed.
+func (value *Value) inRadix(base int) string {
+	switch {
+	case base == 16:
+		return fmt.Sprintf("0x%x", value.Uint())
+	case base == 8 && value.Uint() == 0:
+		return "0"
+	case base == 8:
+		return fmt.Sprintf("0%o", value.Uint())
+	case value.signed():
+		return strconv.FormatInt(value.Int(), 10)
+	}
+	return strconv.FormatUint(value.Uint(), 10)
+}
+
+//converted - returns the value of an integer converted to a float
+func (value *Value) converted() float64 {
+	if value.signed() {
+		return float64(value.Int())
+	}
+	return float64(value.Uint())
+}
+
+//scalar - returns the text of a value which has no children. Integers
+//are printed in the radix given unless the format says otherwise.
+func (value *Value) scalar(format Format, base int) string {
+	//x, o, t and d print the bits of any value (floats included)
+	switch format {
+	case HexFormat:
+		return value.inRadix(16)
+	case OctalFormat:
+		return value.inRadix(8)
+	case BinaryFormat:
+		return strconv.FormatUint(value.Uint(), 2)
+	case DecimalFormat:
+		return strconv.FormatInt(value.Int(), 10)
+	}
+
+	switch {
+	case value.Kind == FloatValue:
+		return fmt.Sprintf("%f", value.Float())
+	case value.Kind == BoolValue:
+		return fmt.Sprintf("%t", value.Uint() != 0)
+	case value.Kind == PointerValue && format == StringFormat:
+		text := fmt.Sprintf("(%s) 0x%x", value.Type, value.Uint())
+		if str, err := value.pointedString(); err == nil {
+			text = fmt.Sprintf("%s %s", text, str)
+		}
+		return text
+	case value.Kind == PointerValue:
+		return fmt.Sprintf("(%s) 0x%x", value.Type, value.Uint())
+	case value.Kind == EnumValue && format == NaturalFormat && strings.Contains(value.symbol, " | "):
+		return value.symbol
+	case value.Kind == EnumValue && format == NaturalFormat && value.symbol != "":
+		return fmt.Sprintf("%s (%s)", value.symbol, value.inRadix(base))
+	case format == CharFormat:
+		return fmt.Sprintf("%s %s", value.inRadix(10), strconv.QuoteRuneToASCII(rune(byte(value.Uint()))))
+	case format == FloatFormat:
+		return fmt.Sprintf("%f", value.converted())
+	}
+	return value.inRadix(base)
+}
+
+//pointedString - returns the string (in double quotes) a char pointer points to
+func (value *Value) pointedString() (string, error) {
+	target, err := value.Target()
+	if err != nil {
+		return "", err
+	}
+	if target.Kind != CharValue || value.memory == nil {
+		return "", fmt.Errorf("Error: %s does not point to a string", value.Name)
+	}
+
+	//The string is read a few bytes at a time as it may end just before
+	//memory which can't be read
+	var str []byte
+	address := value.Uint()
+	for len(str) < maxString {
+		chunk, err := value.memory.Read(address+uint64(len(str)), 16)
+		if err != nil {
+			break
+		}
+		if end := strings.IndexByte(string(chunk), 0); end >= 0 {
+			return strconv.Quote(string(append(str, chunk[:end]...))), nil
+		}
+		str = append(str, chunk...)
+	}
+	return strconv.Quote(string(str)) + "...", nil
+}
+
+//isString - returns whether an array holds chars (so /s prints it as a string)
+func (value *Value) isString() bool {
+	return value.Kind == ArrayValue && len(value.Children) > 0 && value.Children[0].Kind == CharValue
+}
+
+//String renders the value as text, the way the CLI prints it (e.g. 10,
+//(struct node *) 0x7010 or { value: 10 next: (struct node *) 0x0 })
+func (value *Value) String() string {
+	return value.Format(NaturalFormat, 10)
+}
+
+//Format renders the value as text with a format (applied to every member and
+//element) and the radix integers are printed in when there isn't one
+func (value *Value) Format(format Format, base int) string {
+	switch value.Kind {
+	case StructValue, UnionValue:
+		text := "{"
+		for _, child := range value.Children {
+			text = fmt.Sprintf("%s %s: %s", text, child.Name, child.Format(format, base))
+		}
+		return text + " }"
+	case ArrayValue:
+		if format == StringFormat && value.isString() {
+			var str []byte
+			for _, child := range value.Children {
+				if child.Uint() == 0 {
+					break
+				}
+				str = append(str, byte(child.Uint()))
+			}
+			return strconv.Quote(string(str))
+		}
+		var elements []string
+		for _, child := range value.Children {
+			elements = append(elements, child.Format(format, base))
+		}
+		return strings.Join(elements, " ")
+	}
+	return value.scalar(format, base)
+}
+
+//jsonValue is the layout of a value in JSON
+type jsonValue struct {
+	Name     string       `json:"name"`
+	Kind     string       `json:"kind"`
+	Type     string       `json:"type"`
+	Address  string       `json:"address,omitempty"`
+	Bytes    string       `json:"bytes"`
+	Value    string       `json:"value,omitempty"`
+	Children []*jsonValue `json:"children,omitempty"`
+}
+
+//toJSON - converts a value (and its children) to its JSON layout
+func (value *Value) toJSON() *jsonValue {
+	layout := &jsonValue{Name: value.Name, Kind: value.Kind.String(), Type: value.Type, Bytes: hex.EncodeToString(value.Bytes)}
+	if value.InMemory {
+		layout.Address = fmt.Sprintf("0x%x", value.Address)
+	}
+	if len(value.Children) == 0 {
+		layout.Value = value.String()
+	}
+	for _, child := range value.Children {
+		layout.Children = append(layout.Children, child.toJSON())
+	}
+	return layout
+}
+
+//JSON renders the value as JSON for tools. Each value has its name, kind, type,
+//address (if it's in memory), raw bytes in hex and either its text (for numbers
+//and pointers) or its children. Pointers aren't followed.
+func (value *Value) JSON() (string, error) {
+	bytes, err := json.Marshal(value.toJSON())
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
@@ -0,0 +1,157 @@
+package debugger_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/StardustOS/duster/debugger"
+	"github.com/stretchr/testify/assert"
+)
+
+//node is the value of a struct node { int value; struct node *next; }
+func node() *debugger.Value {
+	value := &debugger.Value{Name: "value", Kind: debugger.SignedValue, Type: "int", Address: 0x7000, InMemory: true, Bytes: []byte{0xf6, 0xff, 0xff, 0xff}, Endianess: binary.LittleEndian}
+	next := &debugger.Value{Name: "next", Kind: debugger.PointerValue, Type: "struct node *", Address: 0x7008, InMemory: true, Bytes: []byte{0x10, 0x70, 0, 0, 0, 0, 0, 0}, Endianess: binary.LittleEndian}
+	bytes := append(append([]byte{}, value.Bytes...), 0, 0, 0, 0)
+	bytes = append(bytes, next.Bytes...)
+	return &debugger.Value{Name: "first", Kind: debugger.StructValue, Type: "struct node", Address: 0x7000, InMemory: true, Bytes: bytes, Children: []*debugger.Value{value, next}, Endianess: binary.LittleEndian}
+}
+
+func TestValueString(t *testing.T) {
+	first := node()
+	assert.Equal(t, "{ value: -10 next: (struct node *) 0x7010 }", first.String())
+	assert.Equal(t, int64(-10), first.Child("value").Int())
+	assert.Equal(t, uint64(0x7010), first.Child("next").Uint())
+	assert.Nil(t, first.Child("missing"))
+
+	scale := &debugger.Value{Kind: debugger.FloatValue, Type: "float", Bytes: []byte{0, 0, 0x20, 0x40}, Endianess: binary.LittleEndian}
+	assert.Equal(t, "2.500000", scale.String())
+	letters := &debugger.Value{Kind: debugger.ArrayValue, Type: "unsigned char [2]", Children: []*debugger.Value{
+		&debugger.Value{Kind: debugger.CharValue, Type: "unsigned char", Bytes: []byte{0xff}},
+		&debugger.Value{Kind: debugger.CharValue, Type: "unsigned char", Bytes: []byte{0x41}},
+	}}
+	assert.Equal(t, "255 65", letters.String())
+}
+
+func TestValueTarget(t *testing.T) {
+	first := node()
+	_, err := first.Target()
+	assert.Equal(t, debugger.NotPointer, err)
+
+	next := first.Child("next")
+	_, err = next.Target()
+	assert.Equal(t, debugger.NotPointer, err)
+
+	loads := 0
+	next.SetTarget(func() (*debugger.Value, error) {
+		loads++
+		return nil, errors.New("Error: cannot read memory")
+	})
+	_, err = next.Target()
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, loads)
+}
+
+func TestValueJSON(t *testing.T) {
+	json, err := node().JSON()
+	assert.Nil(t, err)
+	assert.Equal(t, `{"name":"first","kind":"struct","type":"struct node","address":"0x7000","bytes":"f6ffffff000000001070000000000000","children":[`+
+		`{"name":"value","kind":"signed","type":"int","address":"0x7000","bytes":"f6ffffff","value":"-10"},`+
+		`{"name":"next","kind":"pointer","type":"struct node *","address":"0x7008","bytes":"1070000000000000","value":"(struct node *) 0x7010"}]}`, json)
+}
+
+//stringMemory is memory holding a string at 0x9000
+type stringMemory struct{}
+
+func (stringMemory) Read(address uint64, size uint) ([]byte, error) {
+	text := append([]byte("a string that is longer than a single read"), 0)
+	start := address - 0x9000
+	end := start + uint64(size)
+	if end > uint64(len(text)) {
+		end = uint64(len(text))
+	}
+	return append(text[start:end:end], make([]byte, int(size)-int(end-start))...), nil
+}
+
+func (stringMemory) Write(address uint64, bytes []byte, size uint) error {
+	return nil
+}
+
+func TestValueFormat(t *testing.T) {
+	first := node()
+	var tests = []struct {
+		format   debugger.Format
+		radix    int
+		expected string
+	}{
+		{debugger.NaturalFormat, 10, "{ value: -10 next: (struct node *) 0x7010 }"},
+		{debugger.NaturalFormat, 16, "{ value: 0xfffffff6 next: (struct node *) 0x7010 }"},
+		{debugger.NaturalFormat, 8, "{ value: 037777777766 next: (struct node *) 0x7010 }"},
+		{debugger.HexFormat, 10, "{ value: 0xfffffff6 next: 0x7010 }"},
+		{debugger.OctalFormat, 10, "{ value: 037777777766 next: 070020 }"},
+		{debugger.BinaryFormat, 10, "{ value: 11111111111111111111111111110110 next: 111000000010000 }"},
+		{debugger.DecimalFormat, 16, "{ value: -10 next: 28688 }"},
+		{debugger.FloatFormat, 10, "{ value: -10.000000 next: (struct node *) 0x7010 }"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, first.Format(test.format, test.radix))
+	}
+
+	letter := &debugger.Value{Kind: debugger.CharValue, Type: "char", Bytes: []byte{0x41}}
+	assert.Equal(t, "65 'A'", letter.Format(debugger.CharFormat, 16))
+	assert.Equal(t, "0x41", letter.Format(debugger.NaturalFormat, 16))
+	scale := &debugger.Value{Kind: debugger.FloatValue, Type: "float", Bytes: []byte{0, 0, 0x20, 0x40}, Endianess: binary.LittleEndian}
+	assert.Equal(t, "0x40200000", scale.Format(debugger.HexFormat, 10))
+	assert.Equal(t, "2.500000", scale.Format(debugger.NaturalFormat, 16))
+
+	name := &debugger.Value{Kind: debugger.ArrayValue, Type: "char [4]", Children: []*debugger.Value{
+		&debugger.Value{Kind: debugger.CharValue, Type: "char", Bytes: []byte{'o'}},
+		&debugger.Value{Kind: debugger.CharValue, Type: "char", Bytes: []byte{'k'}},
+		&debugger.Value{Kind: debugger.CharValue, Type: "char", Bytes: []byte{0}},
+		&debugger.Value{Kind: debugger.CharValue, Type: "char", Bytes: []byte{'x'}},
+	}}
+	assert.Equal(t, `"ok"`, name.Format(debugger.StringFormat, 10))
+	assert.Equal(t, "0x6f 0x6b 0x0 0x78", name.Format(debugger.HexFormat, 10))
+
+	text := &debugger.Value{Name: "text", Kind: debugger.PointerValue, Type: "char *", Bytes: []byte{0, 0x90, 0, 0, 0, 0, 0, 0}, Endianess: binary.LittleEndian}
+	text.SetMemory(stringMemory{})
+	text.SetTarget(func() (*debugger.Value, error) {
+		return &debugger.Value{Kind: debugger.CharValue, Type: "char", Bytes: []byte{'a'}}, nil
+	})
+	assert.Equal(t, `(char *) 0x9000 "a string that is longer than a single read"`, text.Format(debugger.StringFormat, 10))
+	assert.Equal(t, "(char *) 0x9000", text.Format(debugger.NaturalFormat, 10))
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, letter := range []string{"x", "o", "t", "d", "c", "s", "f"} {
+		format, err := debugger.ParseFormat(letter)
+		assert.Nil(t, err)
+		assert.Equal(t, debugger.Format(letter[0]), format)
+	}
+	for _, letter := range []string{"", "q", "xx"} {
+		_, err := debugger.ParseFormat(letter)
+		assert.NotNil(t, err)
+	}
+}
+
+func TestValueEnum(t *testing.T) {
+	state := &debugger.Value{Name: "state", Kind: debugger.EnumValue, Type: "enum state", Bytes: []byte{2, 0, 0, 0}, Endianess: binary.LittleEndian}
+	state.SetEnum("STATE_RUNNING", false)
+	assert.Equal(t, "STATE_RUNNING (2)", state.String())
+	assert.Equal(t, "STATE_RUNNING (0x2)", state.Format(debugger.NaturalFormat, 16))
+	assert.Equal(t, "10", state.Format(debugger.BinaryFormat, 10))
+
+	flags := &debugger.Value{Name: "flags", Kind: debugger.EnumValue, Type: "enum flags", Bytes: []byte{3, 0, 0, 0}, Endianess: binary.LittleEndian}
+	flags.SetEnum("FLAG_READ | FLAG_WRITE", false)
+	assert.Equal(t, "FLAG_READ | FLAG_WRITE", flags.String())
+	assert.Equal(t, "0x3", flags.Format(debugger.HexFormat, 10))
+
+	direction := &debugger.Value{Name: "direction", Kind: debugger.EnumValue, Type: "enum direction", Bytes: []byte{0xfe, 0xff, 0xff, 0xff}, Endianess: binary.LittleEndian}
+	direction.SetEnum("", true)
+	assert.Equal(t, "-2", direction.String())
+	assert.Equal(t, "", direction.Symbol())
+	json, err := direction.JSON()
+	assert.Nil(t, err)
+	assert.Equal(t, `{"name":"direction","kind":"enum","type":"enum direction","bytes":"feffffff","value":"-2"}`, json)
+}
@@ -0,0 +1,322 @@
+package debugger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/go-delve/delve/pkg/dwarf/op"
+)
+
+//Watch sets a watchpoint which stops the VM when the value of a C expression
+//referring to memory (such as a variable or p->next) is changed and returns its
+//number. The expression is evaluated in the selected frame and watchpoints on
+//local variables are deleted once their frame returns.
+func (debugger *Debugger) Watch(expression string, vcpu uint32) (int, error) {
+	return debugger.watch(expression, WatchWrite, vcpu)
+}
+
+//ReadWatch is the same as Watch but stops when the value is read
+func (debugger *Debugger) ReadWatch(expression string, vcpu uint32) (int, error) {
+	return debugger.watch(expression, WatchRead, vcpu)
+}
+
+//AccessWatch is the same as Watch but stops when the value is read or written
+func (debugger *Debugger) AccessWatch(expression string, vcpu uint32) (int, error) {
+	return debugger.watch(expression, WatchAccess, vcpu)
+}
+
+//SoftwareWatch is the same as Watch but instead of using the debug registers
+//the VM is single stepped and the expression evaluated after each line. This is
+//far slower but the expression can be of any size (e.g. a large struct) or
+//computed (e.g. a + b). The line which changed the value is reported.
+func (debugger *Debugger) SoftwareWatch(expression string, vcpu uint32) (int, error) {
+	if !debugger.controller.IsPaused() {
+		return 0, NotPaused
+	}
+
+	frame, err := debugger.selectedFrame(vcpu)
+	if err != nil {
+		return 0, err
+	}
+
+	regs := frame.DwarfRegisters()
+	variable, value, local, err := debugger.symbols.Evaluate(expression, frame.ScopePC(), regs, debugger.memory)
+	if err != nil {
+		return 0, err
+	}
+
+	scopePC, scopeSP, err := debugger.watchScope(expression, regs, local)
+	if err != nil {
+		return 0, err
+	}
+
+	watchpoint := debugger.breakpointManager.CreateSoftwareWatchpoint(expression, variable)
+	watchpoint.value = value
+	watchpoint.scopePC = scopePC
+	watchpoint.scopeSP = scopeSP
+	watchpoint.framePC = frame.ScopePC()
+	watchpoint.frameRegisters = regs
+	return watchpoint.ID, nil
+}
+
+//watchScope - returns where the frame of a watchpoint on local variables returns
+//to (both are 0 if the expression doesn't use local variables)
+func (debugger *Debugger) watchScope(expression string, regs *op.DwarfRegisters, local bool) (uint64, uint64, error) {
+	if !local {
+		return 0, 0, nil
+	}
+	caller, err := debugger.symbols.Unwind(regs, debugger.memory)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Error: cannot find the caller of the frame %s belongs to (%s)", expression, err)
+	}
+	return caller.PC(), caller.SP(), nil
+}
+
+//watchedValue - returns the current value of the expression watched
+func (debugger *Debugger) watchedValue(watchpoint *Breakpoint) ([]byte, error) {
+	if watchpoint.Hardware {
+		return debugger.memory.Read(watchpoint.Addresses[0], uint(watchpoint.variable.Size()))
+	}
+
+	_, value, _, err := debugger.symbols.Evaluate(watchpoint.Expression, watchpoint.framePC, watchpoint.frameRegisters, debugger.memory)
+	if err != nil {
+		return nil, fmt.Errorf("Error: could not evaluate %s for watchpoint %d (%s)", watchpoint.Expression, watchpoint.ID, err)
+	}
+	return value, nil
+}
+
+//softwareWatching - checks whether any software watchpoints are enabled
+func (debugger *Debugger) softwareWatching() bool {
+	for _, watchpoint := range debugger.breakpointManager.Watchpoints() {
+		if watchpoint.Enabled && !watchpoint.Hardware {
+			return true
+		}
+	}
+	return false
+}
+
+func (debugger *Debugger) watch(expression string, kind WatchKind, vcpu uint32) (int, error) {
+	if !debugger.controller.IsPaused() {
+		return 0, NotPaused
+	}
+
+	frame, err := debugger.selectedFrame(vcpu)
+	if err != nil {
+		return 0, err
+	}
+
+	regs := frame.DwarfRegisters()
+	variable, address, local, err := debugger.symbols.Watch(expression, frame.ScopePC(), regs, debugger.memory)
+	if err != nil {
+		return 0, err
+	}
+
+	scopePC, scopeSP, err := debugger.watchScope(expression, regs, local)
+	if err != nil {
+		return 0, err
+	}
+
+	value, err := debugger.memory.Read(address, uint(variable.Size()))
+	if err != nil {
+		return 0, err
+	}
+
+	watchpoint, err := debugger.breakpointManager.CreateWatchpoint(expression, address, variable, kind)
+	if err != nil {
+		return 0, err
+	}
+	watchpoint.value = value
+	watchpoint.scopePC = scopePC
+	watchpoint.scopeSP = scopeSP
+	return watchpoint.ID, nil
+}
+
+//refreshWatchpoints - reads the values watched again (they may have been
+//changed while stepping, when the watchpoints aren't armed)
+func (debugger *Debugger) refreshWatchpoints() error {
+	for _, watchpoint := range debugger.breakpointManager.Watchpoints() {
+		value, err := debugger.watchedValue(watchpoint)
+		if err != nil {
+			return err
+		}
+		watchpoint.value = value
+	}
+	return nil
+}
+
+//addScopeTraps - sets a temporary breakpoint where each frame with a
+//watchpoint on its local variables returns to. Returns the addresses
+//of the ones set (so they can be removed again).
+func (debugger *Debugger) addScopeTraps() (map[uint64]bool, error) {
+	traps := make(map[uint64]bool)
+	for _, watchpoint := range debugger.breakpointManager.Watchpoints() {
+		err := debugger.addTrap(traps, watchpoint.scopePC)
+		if err != nil {
+			return traps, err
+		}
+	}
+	return traps, nil
+}
+
+//leaveScope - deletes the watchpoints on local variables whose frame has
+//returned to the address. The stack pointer is checked so a recursive call
+//returning to the same address doesn't delete them. Returns a report of the
+//watchpoints deleted (empty if none were).
+func (debugger *Debugger) leaveScope(vcpu uint32, registers Registers, address, rsp uint64) (string, error) {
+	var reports []string
+	for _, watchpoint := range debugger.breakpointManager.Watchpoints() {
+		if watchpoint.scopePC != address || rsp < watchpoint.scopeSP {
+			continue
+		}
+		err := debugger.breakpointManager.Delete(watchpoint.ID)
+		if err != nil {
+			return "", err
+		}
+		reports = append(reports, fmt.Sprintf("Watchpoint %d deleted because the program has left the block in which its expression is valid.", watchpoint.ID))
+	}
+	if reports == nil {
+		return "", nil
+	}
+
+	//The temporary breakpoint is removed once we stop so the PC is
+	//moved back to run the instruction it overwrote
+	err := debugger.moveTo(vcpu, registers, address)
+	if err != nil {
+		return "", err
+	}
+
+	report := reports[0]
+	for _, line := range reports[1:] {
+		report = fmt.Sprintf("%s\n%s", report, line)
+	}
+	return report, nil
+}
+
+//watchpointStops - checks whether a watchpoint that has been hit should stop the VM
+//(watchpoints on writes only stop when the value has changed) and returns a report
+//of the value watched. If changedBy isn't 0 the line it belongs to is reported as
+//where the value was changed.
+func (debugger *Debugger) watchpointStops(registers Registers, watchpoint *Breakpoint, rip, changedBy uint64) (string, bool, error) {
+	value, err := debugger.watchedValue(watchpoint)
+	if err != nil {
+		return "", true, err
+	}
+	old := watchpoint.value
+	watchpoint.value = value
+
+	changed := !bytes.Equal(old, value)
+	if watchpoint.Watch == WatchWrite && !changed {
+		return "", false, nil
+	}
+
+	stop, err := debugger.hitStops(registers, watchpoint, rip)
+	if err != nil || !stop {
+		return "", stop, err
+	}
+
+	newValue, err := debugger.display(watchpoint.variable, value)
+	if err != nil {
+		return "", true, err
+	}
+
+	title := watchpoint.Watch.Title()
+	if !watchpoint.Hardware {
+		title = "Software watchpoint"
+	}
+	if watchpoint.Watch == WatchRead || !changed {
+		return fmt.Sprintf("%s %d: %s\n\nValue = %s", title, watchpoint.ID, watchpoint.Expression, newValue), true, nil
+	}
+
+	oldValue, err := debugger.display(watchpoint.variable, old)
+	if err != nil {
+		return "", true, err
+	}
+	report := fmt.Sprintf("%s %d: %s\n\nOld value = %s\nNew value = %s", title, watchpoint.ID, watchpoint.Expression, oldValue, newValue)
+	if changedBy != 0 {
+		place := location{addresses: []uint64{changedBy}}
+		filename, line, err := debugger.lineInfo.AddressToLine(changedBy)
+		if err == nil {
+			place = location{addresses: place.addresses, filename: filename, line: line}
+		}
+		report = fmt.Sprintf("%s\nChanged by %s", report, place)
+	}
+	return report, true, nil
+}
+
+//continueStepping - continues by single stepping the VM so the software watchpoints
+//can be checked each time a new line starts. Breakpoints are checked after each
+//instruction (the hardware watchpoints stay in the debug registers).
+func (debugger *Debugger) continueStepping(ctx context.Context, vcpu uint32, dest *destination) (StopEvent, error) {
+	//If we've stopped at a breakpoint the instruction under it is run first
+	err := debugger.rewindBreakpoint(vcpu)
+	if err != nil {
+		return StopEvent{}, err
+	}
+
+	_, lineStart, _, err := debugger.stackPosition(vcpu)
+	if err != nil {
+		return StopEvent{}, err
+	}
+
+	for {
+		hit, err := debugger.stepInstructionArmed(ctx, vcpu, armWatchpoints)
+		if err != nil {
+			return StopEvent{}, err
+		}
+
+		registers, rip, rsp, err := debugger.stackPosition(vcpu)
+		if err != nil {
+			return StopEvent{}, err
+		}
+
+		event, stop, err := debugger.steppedStops(registers, hit, vcpu, rip, rsp, dest)
+		if err != nil || stop {
+			debugger.lineInfo.IsNewLine(rip)
+			return event, err
+		}
+
+		if !debugger.lineInfo.IsNewLine(rip) {
+			continue
+		}
+
+		//The line that has just finished is the one that changed the value
+		for _, watchpoint := range debugger.breakpointManager.Watchpoints() {
+			if !watchpoint.Enabled || watchpoint.Hardware {
+				continue
+			}
+			report, stop, err := debugger.watchpointStops(registers, watchpoint, rip, lineStart)
+			if err != nil || stop {
+				return StopEvent{Reason: WatchpointHit, Breakpoint: watchpoint.ID, Address: rip, Report: report}, err
+			}
+		}
+		lineStart = rip
+	}
+}
+
+//steppedStops - checks whether the instruction that has just been stepped hit a
+//hardware watchpoint, left the frame of a watchpoint or reached a breakpoint or
+//the destination
+func (debugger *Debugger) steppedStops(registers Registers, hit *Breakpoint, vcpu uint32, rip, rsp uint64, dest *destination) (StopEvent, bool, error) {
+	if hit != nil && hit.Watch != NoWatch {
+		report, stop, err := debugger.watchpointStops(registers, hit, rip, 0)
+		if err != nil || stop {
+			return StopEvent{Reason: WatchpointHit, Breakpoint: hit.ID, Address: rip, Report: report}, true, err
+		}
+	}
+
+	report, err := debugger.leaveScope(vcpu, registers, rip, rsp)
+	if err != nil || report != "" {
+		return StopEvent{Reason: WatchpointScope, Address: rip, Report: report}, true, err
+	}
+	if dest.reached(rip, rsp) {
+		return StopEvent{Reason: LocationReached, Address: rip}, true, nil
+	}
+
+	breakpoint := debugger.breakpointManager.At(rip)
+	if breakpoint == nil || !breakpoint.Enabled {
+		return StopEvent{}, false, nil
+	}
+	stop, err := debugger.hitStops(registers, breakpoint, rip)
+	return breakpointEvent(breakpoint, rip), stop, err
+}
@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"os"
 	"os/user"
+	"path/filepath"
 	"strings"
 
 	"github.com/StardustOS/duster/cli"
@@ -39,6 +40,40 @@ func unzipFile(filename string) string {
 	return filename
 }
 
+//release - hands the domain back to Xen once the debugger has removed its
+//breakpoints. Debugging is turned off and the memory unmapped, then the
+//domain is unpaused if resume is set.
+func release(cntrl *xen.Xenctrl, mem *xen.Memory, resume bool) error {
+	err := cntrl.SetDebug(cntrl.DomainID, false)
+	if err != nil {
+		return err
+	}
+
+	err = mem.UnMapAll()
+	if err != nil {
+		return err
+	}
+	mem.Close()
+
+	if resume {
+		err = cntrl.Unpause()
+		if err != nil {
+			return err
+		}
+	}
+	return cntrl.Close()
+}
+
+//sessionFile - returns the file the breakpoints of an image are saved to
+//by default (empty if there is no home directory to put it in)
+func sessionFile(image string) string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".duster", filepath.Base(image)+".session")
+}
+
 func main() {
 	currentUser, err := user.Current()
 	if err != nil {
@@ -56,8 +91,10 @@ func main() {
 
 	var id int
 	var filename string
+	var session string
 	flag.StringVar(&filename, "path", "", "Path to the Operating System's binary")
 	flag.IntVar(&id, "id", 0, "The domain id to connect (can be found by running sudo xl list)")
+	flag.StringVar(&session, "session", "", "File the breakpoints are restored from and saved to (by default ~/.duster/<binary name>.session, none turns it off)")
 	flag.Parse()
 
 	if id == -1 {
@@ -73,6 +110,12 @@ func main() {
 		os.Exit(1)
 	}
 
+	if session == "" {
+		session = sessionFile(filename)
+	} else if session == "none" {
+		session = ""
+	}
+
 	domainid := uint32(id)
 
 	cntrl := &xen.Xenctrl{DomainID: domainid}
@@ -118,8 +161,14 @@ func main() {
 	}
 	dbg := debugger.NewDebugger(mem, cntrl, f, cntrl, p)
 	cmd.Init(dbg)
+	cmd.OnDetach(func(resume bool) error {
+		return release(cntrl, mem, resume)
+	})
 
 	fmt.Println("Welcome to Duster!")
+	if session != "" {
+		cmd.UseSession(session)
+	}
 	for {
 		input := cmd.ReadInput()
 		cmd.ProcessInput(input)
@@ -0,0 +1,703 @@
+package file
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/StardustOS/duster/debugger"
+	"github.com/go-delve/delve/pkg/dwarf/op"
+)
+
+type numberKind int
+
+const (
+	signedNumber numberKind = iota
+	unsignedNumber
+	floatNumber
+)
+
+//number is a scalar produced while evaluating arithmetic. Integers
+//are kept in i (unsigned ones are reinterpreted when used).
+type number struct {
+	kind numberKind
+	i    int64
+	f    float64
+}
+
+//float returns the number as a floating point value
+func (n number) float() float64 {
+	switch n.kind {
+	case floatNumber:
+		return n.f
+	case unsignedNumber:
+		return float64(uint64(n.i))
+	}
+	return float64(n.i)
+}
+
+//truth returns whether C would treat the number as true
+func (n number) truth() bool {
+	if n.kind == floatNumber {
+		return n.f != 0
+	}
+	return n.i != 0
+}
+
+//Types given to the results of arithmetic (C promotes to these on x86-64)
+var (
+	intType          = &BaseType{size: 4, Encoding: Sinteger, Name: "int"}
+	longType         = &BaseType{size: 8, Encoding: Sinteger, Name: "long"}
+	unsignedLongType = &BaseType{size: 8, Encoding: Uinteger, Name: "unsigned long"}
+	doubleType       = &BaseType{size: 8, Encoding: Float, Name: "double"}
+)
+
+//value is the result of evaluating an expression. Values which live in the
+//memory of the VM keep their address and are only read when needed, this way
+//accessing a member of a large struct only reads that member.
+type value struct {
+	t        Type
+	address  uint64
+	inMemory bool
+	bytes    []byte
+}
+
+//evaluator holds the state of the frame an expression is evaluated in
+type evaluator struct {
+	pc        uint64
+	regs      *op.DwarfRegisters
+	memory    debugger.MemoryAccess
+	symbols   *SymbolManager
+	types     *TypeManager
+	endianess binary.ByteOrder
+
+	//local is set once a variable stored in the frame (rather than at
+	//a fixed address) has been used
+	local bool
+}
+
+//resolve - removes any typedefs and qualifiers wrapping a type
+func resolve(t Type) Type {
+	for {
+		switch t.(type) {
+		case *TypeDef:
+			t = t.(*TypeDef).Base
+		case *ConstType:
+			t = t.(*ConstType).t
+		case *VolatileType:
+			t = t.(*VolatileType).t
+		default:
+			return t
+		}
+	}
+}
+
+//load - returns the bytes of a value reading them from memory if required
+func (eval *evaluator) load(v *value) ([]byte, error) {
+	if v.bytes != nil {
+		return v.bytes, nil
+	}
+	if v.t == nil {
+		return nil, fmt.Errorf("Error: cannot read a value of type void")
+	}
+	bytes, err := eval.memory.Read(v.address, uint(v.t.Size()))
+	if err != nil {
+		return nil, err
+	}
+	v.bytes = bytes
+	return bytes, nil
+}
+
+//scalar - converts a value into a number so it can be used in arithmetic
+func (eval *evaluator) scalar(v *value) (number, error) {
+	switch t := resolve(v.t).(type) {
+	case *BaseType:
+		bytes, err := eval.load(v)
+		if err != nil {
+			return number{}, err
+		}
+		switch t.Encoding {
+		case Float:
+			if len(bytes) == 4 {
+				return number{kind: floatNumber, f: float64(math.Float32frombits(eval.endianess.Uint32(bytes)))}, nil
+			}
+			return number{kind: floatNumber, f: math.Float64frombits(eval.endianess.Uint64(bytes))}, nil
+		case Sinteger, Schar:
+			return number{kind: signedNumber, i: parseInteger(bytes, eval.endianess)}, nil
+		default:
+			return number{kind: unsignedNumber, i: int64(parseUinteger(bytes, eval.endianess))}, nil
+		}
+	case *Enum:
+		bytes, err := eval.load(v)
+		if err != nil {
+			return number{}, err
+		}
+		if t.signed {
+			return number{kind: signedNumber, i: t.integer(bytes, eval.endianess)}, nil
+		}
+		return number{kind: unsignedNumber, i: t.integer(bytes, eval.endianess)}, nil
+	case *Pointer:
+		bytes, err := eval.load(v)
+		if err != nil {
+			return number{}, err
+		}
+		return number{kind: unsignedNumber, i: int64(parseUinteger(bytes, eval.endianess))}, nil
+	case *Array:
+		//Arrays are used as a pointer to their first element
+		if v.inMemory {
+			return number{kind: unsignedNumber, i: int64(v.address)}, nil
+		}
+	}
+	return number{}, fmt.Errorf("Error: value is not a number or pointer")
+}
+
+//fromNumber - converts a number back into a value of a base type or pointer
+//(integers are truncated to the size of the type)
+func (eval *evaluator) fromNumber(n number, t Type) *value {
+	bytes := make([]byte, t.Size())
+	integer := n.i
+	if base, ok := resolve(t).(*BaseType); ok {
+		switch {
+		case base.Encoding == Float && len(bytes) == 4:
+			eval.endianess.PutUint32(bytes, math.Float32bits(float32(n.float())))
+			return &value{t: t, bytes: bytes}
+		case base.Encoding == Float:
+			eval.endianess.PutUint64(bytes, math.Float64bits(n.float()))
+			return &value{t: t, bytes: bytes}
+		case base.Encoding == Boolean && n.truth():
+			integer = 1
+		case n.kind == floatNumber:
+			integer = int64(n.f)
+		}
+	} else if n.kind == floatNumber {
+		integer = int64(n.f)
+	}
+
+	switch len(bytes) {
+	case 1:
+		bytes[0] = byte(integer)
+	case 2:
+		eval.endianess.PutUint16(bytes, uint16(integer))
+	case 4:
+		eval.endianess.PutUint32(bytes, uint32(integer))
+	case 8:
+		eval.endianess.PutUint64(bytes, uint64(integer))
+	}
+	return &value{t: t, bytes: bytes}
+}
+
+//fromNumberKind - converts a number into a value of the type C gives its kind
+func (eval *evaluator) fromNumberKind(n number) *value {
+	switch n.kind {
+	case floatNumber:
+		return eval.fromNumber(n, doubleType)
+	case unsignedNumber:
+		return eval.fromNumber(n, unsignedLongType)
+	}
+	return eval.fromNumber(n, longType)
+}
+
+//truth - converts a boolean into the int C uses for the result of comparisons
+func (eval *evaluator) truth(b bool) *value {
+	if b {
+		return eval.fromNumber(number{kind: signedNumber, i: 1}, intType)
+	}
+	return eval.fromNumber(number{kind: signedNumber, i: 0}, intType)
+}
+
+func (node *identifierExpression) evaluate(eval *evaluator) (*value, error) {
+	variable, err := eval.symbols.GetSymbol(eval.pc, node.name)
+	if err != nil {
+		return eval.enumerator(node.name)
+	}
+	address, pieces, err := op.ExecuteStackProgram(*eval.regs, variable.location)
+	if err != nil {
+		return nil, err
+	}
+	if pieces != nil {
+		return nil, fmt.Errorf("Error: %s is not stored in memory", node.name)
+	}
+	if len(variable.location) == 0 || op.Opcode(variable.location[0]) != op.DW_OP_addr {
+		eval.local = true
+	}
+	return &value{t: variable.typeVar, address: uint64(address), inMemory: true}, nil
+}
+
+//enumerator - returns the value of an enumerator (variables hide
+//enumerators with the same name as they do in C)
+func (eval *evaluator) enumerator(name string) (*value, error) {
+	if eval.types != nil {
+		if enum, enumerator := eval.types.Enumerator(name); enum != nil {
+			return eval.fromNumber(number{kind: signedNumber, i: enumerator.Value}, enum), nil
+		}
+	}
+	return nil, fmt.Errorf("Error: no symbol %s in current context", name)
+}
+
+func (node *literalExpression) evaluate(eval *evaluator) (*value, error) {
+	if node.number.kind == signedNumber && node.number.i == int64(int32(node.number.i)) {
+		return eval.fromNumber(node.number, intType), nil
+	}
+	return eval.fromNumberKind(node.number), nil
+}
+
+func (node *unaryExpression) evaluate(eval *evaluator) (*value, error) {
+	operand, err := node.operand.evaluate(eval)
+	if err != nil {
+		return nil, err
+	}
+
+	switch node.operator {
+	case "*":
+		return eval.dereference(operand, 0)
+	case "&":
+		if !operand.inMemory {
+			return nil, fmt.Errorf("Error: cannot take the address of a value that is not stored in memory")
+		}
+		return eval.fromNumber(number{kind: unsignedNumber, i: int64(operand.address)}, &Pointer{size: 8, typeOfPointer: operand.t}), nil
+	}
+
+	n, err := eval.scalar(operand)
+	if err != nil {
+		return nil, err
+	}
+	switch node.operator {
+	case "!":
+		return eval.truth(!n.truth()), nil
+	case "+":
+		return eval.fromNumberKind(n), nil
+	case "-":
+		if n.kind == floatNumber {
+			n.f = -n.f
+		} else {
+			n.i = -n.i
+		}
+		return eval.fromNumberKind(n), nil
+	case "~":
+		if n.kind == floatNumber {
+			return nil, fmt.Errorf("Error: cannot apply ~ to a floating point number")
+		}
+		n.i = ^n.i
+		return eval.fromNumberKind(n), nil
+	}
+	return nil, fmt.Errorf("Error: unknown operator %s", node.operator)
+}
+
+func (node *binaryExpression) evaluate(eval *evaluator) (*value, error) {
+	left, err := node.left.evaluate(eval)
+	if err != nil {
+		return nil, err
+	}
+	l, err := eval.scalar(left)
+	if err != nil {
+		return nil, err
+	}
+
+	//The logical operators only evaluate the right hand side when they need to
+	if node.operator == "&&" && !l.truth() {
+		return eval.truth(false), nil
+	} else if node.operator == "||" && l.truth() {
+		return eval.truth(true), nil
+	}
+
+	right, err := node.right.evaluate(eval)
+	if err != nil {
+		return nil, err
+	}
+	r, err := eval.scalar(right)
+	if err != nil {
+		return nil, err
+	}
+
+	switch node.operator {
+	case "&&", "||":
+		return eval.truth(r.truth()), nil
+	case "+", "-":
+		if result, ok, err := eval.pointerArithmetic(node.operator, left, right, l, r); ok {
+			return result, err
+		}
+	}
+
+	//The usual arithmetic conversions of C
+	kind := signedNumber
+	if l.kind == floatNumber || r.kind == floatNumber {
+		kind = floatNumber
+	} else if l.kind == unsignedNumber || r.kind == unsignedNumber {
+		kind = unsignedNumber
+	}
+
+	if kind == floatNumber {
+		return eval.floatOperation(node.operator, l.float(), r.float())
+	}
+	return eval.integerOperation(node.operator, kind, l.i, r.i)
+}
+
+//pointee - returns the type pointed to by a pointer (or held by an array) and
+//whether the value is a pointer or array at all
+func pointee(t Type) (Type, bool) {
+	switch t := resolve(t).(type) {
+	case *Pointer:
+		return t.typeOfPointer, true
+	case *Array:
+		return t.typeArray, true
+	}
+	return nil, false
+}
+
+//stride - returns the number of bytes between the elements pointed to by
+//a pointer (void pointers move a byte at a time like they do in gcc)
+func stride(t Type) int64 {
+	if t == nil {
+		return 1
+	}
+	return int64(t.Size())
+}
+
+//pointerArithmetic - adds an integer to (or subtracts one from) a pointer, or
+//finds the number of elements between two pointers. Returns false if neither
+//value is a pointer.
+func (eval *evaluator) pointerArithmetic(operator string, left, right *value, l, r number) (*value, bool, error) {
+	lt, lPointer := pointee(left.t)
+	rt, rPointer := pointee(right.t)
+	switch {
+	case lPointer && rPointer && operator == "-":
+		difference := (l.i - r.i) / stride(lt)
+		return eval.fromNumber(number{kind: signedNumber, i: difference}, longType), true, nil
+	case lPointer && rPointer:
+		return nil, true, fmt.Errorf("Error: cannot add two pointers")
+	case rPointer && operator == "-":
+		return nil, true, fmt.Errorf("Error: cannot subtract a pointer from an integer")
+	case rPointer:
+		//n + p is the same as p + n
+		lt, l, r = rt, r, l
+	case !lPointer:
+		return nil, false, nil
+	}
+	if r.kind == floatNumber {
+		return nil, true, fmt.Errorf("Error: cannot add a floating point number to a pointer")
+	}
+
+	offset := r.i * stride(lt)
+	if operator == "-" {
+		offset = -offset
+	}
+	return eval.fromNumber(number{kind: unsignedNumber, i: l.i + offset}, &Pointer{size: 8, typeOfPointer: lt}), true, nil
+}
+
+//dereference - returns the element index places after the one a pointer
+//points to (or the element index of an array)
+func (eval *evaluator) dereference(v *value, index int64) (*value, error) {
+	element, ok := pointee(v.t)
+	if !ok {
+		return nil, debugger.NotPointer
+	}
+	if _, isArray := resolve(v.t).(*Array); isArray && !v.inMemory {
+		start := index * stride(element)
+		if index < 0 || start+stride(element) > int64(len(v.bytes)) {
+			return nil, fmt.Errorf("Error: index %d is outside of the array", index)
+		}
+		return &value{t: element, bytes: v.bytes[start : start+stride(element)]}, nil
+	}
+
+	address, err := eval.scalar(v)
+	if err != nil {
+		return nil, err
+	}
+	return &value{t: element, address: uint64(address.i + index*stride(element)), inMemory: true}, nil
+}
+
+//floatOperation - applies a binary operator to two floating point numbers
+func (eval *evaluator) floatOperation(operator string, l, r float64) (*value, error) {
+	var result float64
+	switch operator {
+	case "==":
+		return eval.truth(l == r), nil
+	case "!=":
+		return eval.truth(l != r), nil
+	case "<":
+		return eval.truth(l < r), nil
+	case "<=":
+		return eval.truth(l <= r), nil
+	case ">":
+		return eval.truth(l > r), nil
+	case ">=":
+		return eval.truth(l >= r), nil
+	case "+":
+		result = l + r
+	case "-":
+		result = l - r
+	case "*":
+		result = l * r
+	case "/":
+		result = l / r
+	default:
+		return nil, fmt.Errorf("Error: cannot apply %s to floating point numbers", operator)
+	}
+	return eval.fromNumber(number{kind: floatNumber, f: result}, doubleType), nil
+}
+
+//integerOperation - applies a binary operator to two integers, unsigned
+//integers are compared and divided as unsigned
+func (eval *evaluator) integerOperation(operator string, kind numberKind, l, r int64) (*value, error) {
+	unsigned := kind == unsignedNumber
+	less := l < r
+	if unsigned {
+		less = uint64(l) < uint64(r)
+	}
+
+	var result int64
+	switch operator {
+	case "==":
+		return eval.truth(l == r), nil
+	case "!=":
+		return eval.truth(l != r), nil
+	case "<":
+		return eval.truth(less), nil
+	case "<=":
+		return eval.truth(less || l == r), nil
+	case ">":
+		return eval.truth(!less && l != r), nil
+	case ">=":
+		return eval.truth(!less), nil
+	case "+":
+		result = l + r
+	case "-":
+		result = l - r
+	case "*":
+		result = l * r
+	case "/", "%":
+		if r == 0 {
+			return nil, fmt.Errorf("Error: division by zero")
+		}
+		switch {
+		case unsigned && operator == "/":
+			result = int64(uint64(l) / uint64(r))
+		case unsigned:
+			result = int64(uint64(l) % uint64(r))
+		case operator == "/":
+			result = l / r
+		default:
+			result = l % r
+		}
+	case "&":
+		result = l & r
+	case "|":
+		result = l | r
+	case "^":
+		result = l ^ r
+	case "<<":
+		result = l << uint64(r)
+	case ">>":
+		if unsigned {
+			result = int64(uint64(l) >> uint64(r))
+		} else {
+			result = l >> uint64(r)
+		}
+	default:
+		return nil, fmt.Errorf("Error: unknown operator %s", operator)
+	}
+	return eval.fromNumberKind(number{kind: kind, i: result}), nil
+}
+
+func (node *memberExpression) evaluate(eval *evaluator) (*value, error) {
+	operand, err := node.operand.evaluate(eval)
+	if err != nil {
+		return nil, err
+	}
+
+	if node.arrow {
+		if _, ok := resolve(operand.t).(*Pointer); !ok {
+			return nil, fmt.Errorf("Error: cannot use -> on a value that is not a pointer")
+		}
+		operand, err = eval.dereference(operand, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var attributes []*Attribute
+	switch t := resolve(operand.t).(type) {
+	case *Struct:
+		attributes = t.attributes
+	case *Union:
+		attributes = t.attributes
+	default:
+		return nil, fmt.Errorf("Error: cannot access member %s of a value that is not a struct or union", node.name)
+	}
+
+	for _, attribute := range attributes {
+		if attribute.FieldName != node.name {
+			continue
+		}
+		if attribute.BitSize > 0 {
+			return eval.bitfield(operand, attribute)
+		}
+		if operand.inMemory {
+			return &value{t: attribute.base, address: operand.address + uint64(attribute.Offset), inMemory: true}, nil
+		}
+		end := attribute.Offset + attribute.base.Size()
+		return &value{t: attribute.base, bytes: operand.bytes[attribute.Offset:end]}, nil
+	}
+	return nil, fmt.Errorf("Error: there is no member named %s", node.name)
+}
+
+//bitfield - returns the value of a bitfield member. Bitfields don't have an
+//address so only the bytes holding its bits are read and the value is kept.
+func (eval *evaluator) bitfield(v *value, attribute *Attribute) (*value, error) {
+	if v.bytes != nil {
+		return &value{t: attribute.base, bytes: attribute.field(v.bytes, eval.endianess)}, nil
+	}
+	stored, err := eval.memory.Read(v.address+uint64(attribute.Offset), uint(attribute.storage()))
+	if err != nil {
+		return nil, err
+	}
+	return &value{t: attribute.base, bytes: attribute.extract(stored, eval.endianess)}, nil
+}
+
+func (node *indexExpression) evaluate(eval *evaluator) (*value, error) {
+	operand, err := node.operand.evaluate(eval)
+	if err != nil {
+		return nil, err
+	}
+	index, err := node.index.evaluate(eval)
+	if err != nil {
+		return nil, err
+	}
+	i, err := eval.scalar(index)
+	if err != nil {
+		return nil, err
+	}
+	if i.kind == floatNumber {
+		return nil, fmt.Errorf("Error: the index of an array must be an integer")
+	}
+
+	if _, ok := pointee(operand.t); !ok {
+		return nil, fmt.Errorf("Error: cannot index a value that is not an array or pointer")
+	}
+	return eval.dereference(operand, i.i)
+}
+
+//baseTypeSizes are the sizes of the C base types on x86-64
+var baseTypeSizes = map[string]int{"char": 1, "short": 2, "int": 4, "long": 8, "float": 4, "double": 8, "_Bool": 1}
+
+//baseType - makes the base type written with keywords (e.g. unsigned long)
+func baseType(name string) (*BaseType, error) {
+	base := &BaseType{size: 4, Encoding: Sinteger, Name: name}
+	for _, word := range strings.Fields(name) {
+		size, ok := baseTypeSizes[word]
+		switch {
+		case word == "unsigned" && base.Encoding == Schar:
+			base.Encoding = Uchar
+		case word == "unsigned":
+			base.Encoding = Uinteger
+		case word == "signed":
+		case !ok:
+			return nil, fmt.Errorf("Error: no type named %s", name)
+		case word == "char" && base.Encoding == Uinteger:
+			base.size, base.Encoding = size, Uchar
+		case word == "char":
+			base.size, base.Encoding = size, Schar
+		case word == "float" || word == "double":
+			base.size, base.Encoding = size, Float
+		case word == "_Bool":
+			base.size, base.Encoding = size, Boolean
+		case word != "int":
+			base.size = size
+		}
+	}
+	return base, nil
+}
+
+//lookupType - returns the type a type name refers to (nil for void)
+func (eval *evaluator) lookupType(name *typeName) (Type, error) {
+	var t Type
+	if name.name != "void" {
+		if eval.types != nil {
+			t = eval.types.Lookup(name.name)
+		}
+		if t == nil {
+			base, err := baseType(name.name)
+			if err != nil {
+				return nil, err
+			}
+			t = base
+		}
+	}
+	for i := 0; i < name.pointers; i++ {
+		t = &Pointer{size: 8, typeOfPointer: t}
+	}
+	return t, nil
+}
+
+func (node *castExpression) evaluate(eval *evaluator) (*value, error) {
+	to, err := eval.lookupType(node.to)
+	if err != nil {
+		return nil, err
+	}
+	operand, err := node.operand.evaluate(eval)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resolve(to).(type) {
+	case *BaseType, *Pointer, *Enum:
+	default:
+		return nil, fmt.Errorf("Error: cannot cast to %s", node.to.name)
+	}
+	n, err := eval.scalar(operand)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := resolve(to).(*Pointer); ok && n.kind == floatNumber {
+		return nil, fmt.Errorf("Error: cannot cast a floating point number to a pointer")
+	}
+	return eval.fromNumber(n, to), nil
+}
+
+func (node *sizeofExpression) evaluate(eval *evaluator) (*value, error) {
+	var t Type
+	if node.of != nil {
+		var err error
+		t, err = eval.lookupType(node.of)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		operand, err := node.operand.evaluate(eval)
+		if err != nil {
+			return nil, err
+		}
+		t = operand.t
+	}
+	if t == nil {
+		return nil, fmt.Errorf("Error: void has no size")
+	}
+	return eval.fromNumber(number{kind: unsignedNumber, i: int64(t.Size())}, unsignedLongType), nil
+}
+
+//isType - returns whether a name is a typedef (used by the parser for casts)
+func (eval *evaluator) isType(name string) bool {
+	if eval.types == nil {
+		return false
+	}
+	_, ok := eval.types.Lookup(name).(*TypeDef)
+	return ok
+}
+
+//evaluateCondition - evaluates a C expression and returns whether it is true
+func (eval *evaluator) evaluateCondition(text string) (bool, error) {
+	tree, err := parseExpression(text, eval.isType)
+	if err != nil {
+		return false, err
+	}
+	result, err := tree.evaluate(eval)
+	if err != nil {
+		return false, err
+	}
+	n, err := eval.scalar(result)
+	if err != nil {
+		return false, err
+	}
+	return n.truth(), nil
+}
@@ -0,0 +1,416 @@
+package file
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	endToken tokenKind = iota
+	identifierToken
+	integerToken
+	floatToken
+	charToken
+	operatorToken
+)
+
+//token is a single lexical element of a C expression
+type token struct {
+	kind tokenKind
+	text string
+}
+
+//operators lists the C operators understood by the lexer. Longer
+//operators come first so that "->" isn't read as "-" followed by ">".
+var operators = []string{
+	"->", "==", "!=", "<=", ">=", "&&", "||", "<<", ">>",
+	"(", ")", "[", "]", ".", "*", "&", "!", "~", "-", "+", "/", "%", "<", ">", "^", "|",
+}
+
+//tokenise - splits a C expression into tokens
+func tokenise(expression string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expression); {
+		c := rune(expression[i])
+		switch {
+		case unicode.IsSpace(c):
+			i += 1
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(expression) && (expression[i] == '_' || unicode.IsLetter(rune(expression[i])) || unicode.IsDigit(rune(expression[i]))) {
+				i += 1
+			}
+			tokens = append(tokens, token{kind: identifierToken, text: expression[start:i]})
+		case unicode.IsDigit(c) || (c == '.' && i+1 < len(expression) && unicode.IsDigit(rune(expression[i+1]))):
+			start := i
+			kind := integerToken
+			hex := strings.HasPrefix(expression[i:], "0x") || strings.HasPrefix(expression[i:], "0X")
+			for i < len(expression) && (unicode.IsLetter(rune(expression[i])) || unicode.IsDigit(rune(expression[i])) || expression[i] == '.') {
+				if expression[i] == '.' {
+					kind = floatToken
+				}
+				i += 1
+				//The exponent of a decimal constant may be signed (e.g. 1e-5)
+				exponent := !hex && (expression[i-1] == 'e' || expression[i-1] == 'E')
+				if exponent && i < len(expression) && (expression[i] == '+' || expression[i] == '-') {
+					i += 1
+				}
+			}
+			text := expression[start:i]
+			if !hex && strings.ContainsAny(text, "eE") {
+				kind = floatToken
+			}
+			tokens = append(tokens, token{kind: kind, text: text})
+		case c == '\'':
+			end := strings.IndexByte(expression[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("Error: unterminated character constant in %s", expression)
+			}
+			tokens = append(tokens, token{kind: charToken, text: expression[i+1 : i+1+end]})
+			i += end + 2
+		default:
+			matched := false
+			for _, operator := range operators {
+				if strings.HasPrefix(expression[i:], operator) {
+					tokens = append(tokens, token{kind: operatorToken, text: operator})
+					i += len(operator)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("Error: unexpected character %q in expression", c)
+			}
+		}
+	}
+	return append(tokens, token{kind: endToken}), nil
+}
+
+//expression is a node of the syntax tree produced by parseExpression
+type expression interface {
+	evaluate(*evaluator) (*value, error)
+}
+
+//identifierExpression is a reference to a variable in scope
+type identifierExpression struct {
+	name string
+}
+
+//literalExpression is a constant written in the expression (e.g. 10, 2.5 or 'a')
+type literalExpression struct {
+	number number
+}
+
+//unaryExpression is an operator applied to a single operand (e.g. -x, !x or *p)
+type unaryExpression struct {
+	operator string
+	operand  expression
+}
+
+//binaryExpression is an operator applied to two operands (e.g. a + b or a && b)
+type binaryExpression struct {
+	operator    string
+	left, right expression
+}
+
+//memberExpression is an access to a member of a struct or union (a.b or p->b)
+type memberExpression struct {
+	operand expression
+	name    string
+	arrow   bool
+}
+
+//indexExpression is an element of an array or pointer (a[i])
+type indexExpression struct {
+	operand, index expression
+}
+
+//typeName is a type written in an expression (e.g. the unsigned long of
+//(unsigned long)x or the struct foo * of (struct foo *)0x1234)
+type typeName struct {
+	name     string
+	pointers int
+}
+
+//castExpression converts its operand to another type ((type)x)
+type castExpression struct {
+	to      *typeName
+	operand expression
+}
+
+//sizeofExpression is the size of a type or of the type of its operand
+type sizeofExpression struct {
+	of      *typeName
+	operand expression
+}
+
+//precedence of the binary operators (higher binds tighter)
+var precedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"|":  3,
+	"^":  4,
+	"&":  5,
+	"==": 6, "!=": 6,
+	"<": 7, "<=": 7, ">": 7, ">=": 7,
+	"<<": 8, ">>": 8,
+	"+": 9, "-": 9,
+	"*": 10, "/": 10, "%": 10,
+}
+
+//typeKeywords are the keywords which can start the name of a type
+var typeKeywords = map[string]bool{
+	"void": true, "char": true, "short": true, "int": true, "long": true, "float": true, "double": true,
+	"signed": true, "unsigned": true, "_Bool": true, "struct": true, "union": true, "enum": true,
+	"const": true, "volatile": true,
+}
+
+//parser is a recursive descent (precedence climbing) parser for C expressions
+type parser struct {
+	tokens   []token
+	position int
+	//isType tells the parser which identifiers are typedefs (so that a cast
+	//such as (size_t)x can be told apart from a bracketed variable)
+	isType func(string) bool
+}
+
+//parseExpression - parses a C expression into a syntax tree. isType returns
+//whether a name is a typedef and may be nil if there are none.
+func parseExpression(text string, isType func(string) bool) (expression, error) {
+	tokens, err := tokenise(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, isType: isType}
+	tree, err := p.binary(1)
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != endToken {
+		return nil, fmt.Errorf("Error: unexpected %s in expression", p.peek().text)
+	}
+	return tree, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.position]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.position]
+	if t.kind != endToken {
+		p.position += 1
+	}
+	return t
+}
+
+//startsType - returns whether the token after the next n tokens starts a type name
+func (p *parser) startsType(n int) bool {
+	if p.position+n >= len(p.tokens) {
+		return false
+	}
+	t := p.tokens[p.position+n]
+	if t.kind != identifierToken {
+		return false
+	}
+	return typeKeywords[t.text] || (p.isType != nil && p.isType(t.text))
+}
+
+//accept - consumes the next token if it is the operator given
+func (p *parser) accept(operator string) bool {
+	t := p.peek()
+	if t.kind == operatorToken && t.text == operator {
+		p.position += 1
+		return true
+	}
+	return false
+}
+
+//binary - parses binary operators whose precedence is at least minimum
+func (p *parser) binary(minimum int) (expression, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		level, ok := precedence[t.text]
+		if t.kind != operatorToken || !ok || level < minimum {
+			return left, nil
+		}
+		p.next()
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpression{operator: t.text, left: left, right: right}
+	}
+}
+
+//unary - parses prefix operators, casts and sizeof
+func (p *parser) unary() (expression, error) {
+	t := p.peek()
+	if t.kind == identifierToken && t.text == "sizeof" {
+		p.next()
+		if p.peek().text == "(" && p.startsType(1) {
+			p.next()
+			of, err := p.typeName()
+			if err != nil {
+				return nil, err
+			}
+			return &sizeofExpression{of: of}, nil
+		}
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &sizeofExpression{operand: operand}, nil
+	}
+	if t.kind == operatorToken {
+		switch t.text {
+		case "(":
+			if !p.startsType(1) {
+				break
+			}
+			p.next()
+			to, err := p.typeName()
+			if err != nil {
+				return nil, err
+			}
+			operand, err := p.unary()
+			if err != nil {
+				return nil, err
+			}
+			return &castExpression{to: to, operand: operand}, nil
+		case "-", "+", "!", "~", "*", "&":
+			p.next()
+			operand, err := p.unary()
+			if err != nil {
+				return nil, err
+			}
+			return &unaryExpression{operator: t.text, operand: operand}, nil
+		}
+	}
+	return p.postfix()
+}
+
+//typeName - parses the name of a type up to the closing bracket (the
+//opening bracket has already been read)
+func (p *parser) typeName() (*typeName, error) {
+	var words []string
+	for p.peek().kind == identifierToken {
+		word := p.next().text
+		switch word {
+		case "const", "volatile":
+			continue
+		case "struct", "union", "enum":
+			tag := p.next()
+			if tag.kind != identifierToken {
+				return nil, fmt.Errorf("Error: expected the name of the %s but got %s", word, tag.text)
+			}
+			word += " " + tag.text
+		}
+		words = append(words, word)
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("Error: expected a type but got %s", p.peek().text)
+	}
+
+	name := &typeName{name: strings.Join(words, " ")}
+	for p.accept("*") {
+		name.pointers += 1
+		for p.peek().text == "const" || p.peek().text == "volatile" {
+			p.next()
+		}
+	}
+	if !p.accept(")") {
+		return nil, fmt.Errorf("Error: missing ) after the type %s", name.name)
+	}
+	return name, nil
+}
+
+//postfix - parses member accesses and indexes following a primary expression
+func (p *parser) postfix() (expression, error) {
+	operand, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if p.accept("[") {
+			index, err := p.binary(1)
+			if err != nil {
+				return nil, err
+			}
+			if !p.accept("]") {
+				return nil, fmt.Errorf("Error: missing ] in expression")
+			}
+			operand = &indexExpression{operand: operand, index: index}
+			continue
+		}
+		arrow := p.accept("->")
+		if !arrow && !p.accept(".") {
+			return operand, nil
+		}
+		name := p.next()
+		if name.kind != identifierToken {
+			return nil, fmt.Errorf("Error: expected member name but got %s", name.text)
+		}
+		operand = &memberExpression{operand: operand, name: name.text, arrow: arrow}
+	}
+}
+
+//primary - parses identifiers, constants and bracketed expressions
+func (p *parser) primary() (expression, error) {
+	t := p.next()
+	switch t.kind {
+	case identifierToken:
+		return &identifierExpression{name: t.text}, nil
+	case integerToken:
+		return parseIntegerLiteral(t.text)
+	case floatToken:
+		f, err := strconv.ParseFloat(strings.TrimRight(t.text, "fFlL"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("Error: %s is not a valid number", t.text)
+		}
+		return &literalExpression{number: number{kind: floatNumber, f: f}}, nil
+	case charToken:
+		c, _, tail, err := strconv.UnquoteChar(t.text, '\'')
+		if err != nil || len(tail) > 0 {
+			return nil, fmt.Errorf("Error: '%s' is not a valid character", t.text)
+		}
+		return &literalExpression{number: number{kind: signedNumber, i: int64(c)}}, nil
+	case operatorToken:
+		if t.text == "(" {
+			inner, err := p.binary(1)
+			if err != nil {
+				return nil, err
+			}
+			if !p.accept(")") {
+				return nil, fmt.Errorf("Error: missing ) in expression")
+			}
+			return inner, nil
+		}
+	case endToken:
+		return nil, fmt.Errorf("Error: unexpected end of expression")
+	}
+	return nil, fmt.Errorf("Error: unexpected %s in expression", t.text)
+}
+
+//parseIntegerLiteral - parses an integer constant (decimal, hex or octal with
+//an optional u/l suffix)
+func parseIntegerLiteral(text string) (expression, error) {
+	digits := strings.TrimRight(text, "uUlL")
+	unsigned := strings.ContainsAny(text[len(digits):], "uU")
+	u, err := strconv.ParseUint(digits, 0, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Error: %s is not a valid number", text)
+	}
+	if unsigned || u > 1<<63-1 {
+		return &literalExpression{number: number{kind: unsignedNumber, i: int64(u)}}, nil
+	}
+	return &literalExpression{number: number{kind: signedNumber, i: int64(u)}}, nil
+}
@@ -0,0 +1,463 @@
+package file
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/StardustOS/duster/debugger"
+	"github.com/go-delve/delve/pkg/dwarf/op"
+)
+
+//byteMemory is a fake of the VM's memory addressed by byte
+type byteMemory map[uint64]byte
+
+func (memory byteMemory) Read(address uint64, size uint) ([]byte, error) {
+	bytes := make([]byte, size)
+	for i := range bytes {
+		bytes[i] = memory[address+uint64(i)]
+	}
+	return bytes, nil
+}
+
+func (memory byteMemory) Write(address uint64, bytes []byte, size uint) error {
+	for i := uint(0); i < size; i++ {
+		memory[address+uint64(i)] = bytes[i]
+	}
+	return nil
+}
+
+func (memory byteMemory) writeUint(address uint64, val uint64, size int) {
+	bytes := make([]byte, 8)
+	binary.LittleEndian.PutUint64(bytes, val)
+	memory.Write(address, bytes, uint(size))
+}
+
+type conditionTest struct {
+	Condition string
+	Expected  bool
+}
+
+//The snapshot is of testfiles/conditions inside the loop of walk on its
+//second iteration (head points to the second node of the list)
+func walkSnapshot() (*op.DwarfRegisters, byteMemory) {
+	regs := &op.DwarfRegisters{ByteOrder: binary.LittleEndian, CFA: 0x8000, FrameBase: 0x8000}
+	memory := byteMemory{}
+	//head, total and i
+	memory.writeUint(0x7fd8, 0x7010, 8)
+	memory.writeUint(0x7fec, 10, 4)
+	memory.writeUint(0x7fe8, 1, 4)
+	//The list
+	memory.writeUint(0x7000, 10, 4)
+	memory.writeUint(0x7008, 0x7010, 8)
+	memory.writeUint(0x7010, 20, 4)
+	memory.writeUint(0x7018, 0x7020, 8)
+	memory.writeUint(0x7020, 30, 4)
+	memory.writeUint(0x7028, 0, 8)
+	return regs, memory
+}
+
+func TestCondition(t *testing.T) {
+	symbolicInfo, err := NewSymbolicInformation("testfiles/conditions", binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	regs, memory := walkSnapshot()
+
+	var tests = []conditionTest{
+		conditionTest{Condition: "i == 1", Expected: true},
+		conditionTest{Condition: "i == 2", Expected: false},
+		conditionTest{Condition: "head->value == 20 && head->next->value == 30", Expected: true},
+		conditionTest{Condition: "head->next->next != 0", Expected: false},
+		conditionTest{Condition: "(*head).value + total * 2 >= 40", Expected: true},
+		conditionTest{Condition: "i > 5 || total == 10", Expected: true},
+		conditionTest{Condition: "-i < 0 && !(total % 3)", Expected: false},
+		conditionTest{Condition: "(*head->next).next", Expected: false},
+		conditionTest{Condition: "1 + 2 * 3 == 7", Expected: true},
+		conditionTest{Condition: "i == 'A' - 64", Expected: true},
+	}
+
+	for _, test := range tests {
+		holds, err := symbolicInfo.Condition(test.Condition, 0x1147, regs, memory)
+		if err != nil {
+			t.Errorf("Error: %s evaluating %s", err, test.Condition)
+		} else if holds != test.Expected {
+			t.Errorf("Error: expected %s to be %t", test.Condition, test.Expected)
+		}
+	}
+}
+
+func TestConditionFloat(t *testing.T) {
+	symbolicInfo, err := NewSymbolicInformation("testfiles/conditions", binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	regs := &op.DwarfRegisters{ByteOrder: binary.LittleEndian, CFA: 0x8000, FrameBase: 0x8000}
+	memory := byteMemory{}
+	memory.writeUint(0x7fec, uint64(math.Float32bits(2.5)), 4)
+
+	holds, err := symbolicInfo.Condition("scale > 2.4 && scale < 2.6", 0x118c, regs, memory)
+	if err != nil || !holds {
+		t.Errorf("Error: expected scale to be 2.5 (%v)", err)
+	}
+}
+
+func TestConditionErrors(t *testing.T) {
+	symbolicInfo, err := NewSymbolicInformation("testfiles/conditions", binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	regs, memory := walkSnapshot()
+
+	invalid := []string{"missing == 1", "head->missing == 1", "total->value", "*total", "i / 0"}
+	for _, condition := range invalid {
+		_, err := symbolicInfo.Condition(condition, 0x1147, regs, memory)
+		if err == nil {
+			t.Errorf("Error: expected %s to fail", condition)
+		}
+	}
+}
+
+func TestCheckExpression(t *testing.T) {
+	symbolicInfo := new(SymbolicInformation)
+	valid := []string{"a == 1", "p->next->value != 0x10", "(a + b) * c >= 2.5", "c == 'x' || !d", "a[i + 1].b", "(struct foo *)0x1234", "sizeof(unsigned long) * 2", "&x", "a > 1e-5", "b < 2.5E+3"}
+	for _, expression := range valid {
+		if err := symbolicInfo.CheckExpression(expression); err != nil {
+			t.Errorf("Error: expected %s to be valid (%s)", expression, err)
+		}
+	}
+
+	invalid := []string{"a ==", "(a == 1", "a $ b", "p->", "a == 1)", "a[1", "(struct *)p", "(int *x)"}
+	for _, expression := range invalid {
+		if err := symbolicInfo.CheckExpression(expression); err == nil {
+			t.Errorf("Error: expected %s to be invalid", expression)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	symbolicInfo, err := NewSymbolicInformation("testfiles/conditions", binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	regs, memory := walkSnapshot()
+
+	variable, address, local, err := symbolicInfo.Watch("head->next->value", 0x1147, regs, memory)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if address != 0x7020 || variable.Size() != 4 || !local {
+		t.Errorf("Error: expected the local int at 0x7020 not %d bytes at %x (local %t)", variable.Size(), address, local)
+	}
+	val, err := variable.Parse([]byte{30, 0, 0, 0}, binary.LittleEndian)
+	if err != nil || val != "30" {
+		t.Errorf("Error: expected the value to be printed as 30 not %s (%v)", val, err)
+	}
+
+	_, _, _, err = symbolicInfo.Watch("total * 2", 0x1147, regs, memory)
+	if err == nil || err.Error() != "Error: cannot watch total * 2 as it is not stored in memory" {
+		t.Errorf("Error: expected an error for an expression not stored in memory not %v", err)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	symbolicInfo, err := NewSymbolicInformation("testfiles/conditions", binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	regs, memory := walkSnapshot()
+
+	variable, value, local, err := symbolicInfo.Evaluate("total * 2", 0x1147, regs, memory)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	val, err := variable.Parse(value, binary.LittleEndian)
+	if err != nil || val != "20" || !local {
+		t.Errorf("Error: expected total * 2 to be the local value 20 not %s (local %t, %v)", val, local, err)
+	}
+
+	_, _, _, err = symbolicInfo.Evaluate("missing + 1", 0x1147, regs, memory)
+	if err == nil {
+		t.Errorf("Error: expected an error for an unknown variable")
+	}
+}
+
+type expressionTest struct {
+	Expression string
+	Expected   string
+}
+
+//The snapshot is of testfiles/expressions inside area which has been passed
+//the address of square
+func areaSnapshot() (*op.DwarfRegisters, byteMemory) {
+	regs := &op.DwarfRegisters{ByteOrder: binary.LittleEndian, CFA: 0x8000, FrameBase: 0x8000}
+	memory := byteMemory{}
+	//square
+	memory.Write(0x4020, []byte("square\x00\x00"), 8)
+	corners := []uint64{0, 0, 0, 2, 2, 2, 2, 0}
+	for i, corner := range corners {
+		memory.writeUint(0x4028+uint64(i)*4, corner, 4)
+	}
+	memory.writeUint(0x4048, 0, 8)
+	memory.writeUint(0x4050, math.Float64bits(1.5), 8)
+	//s, width and values
+	memory.writeUint(0x7fc8, 0x4020, 8)
+	memory.writeUint(0x7fe8, 2, 8)
+	memory.writeUint(0x7fdc, 1, 4)
+	memory.writeUint(0x7fe0, 2, 4)
+	memory.writeUint(0x7fe4, 3, 4)
+	return regs, memory
+}
+
+func TestEvaluateExpressions(t *testing.T) {
+	symbolicInfo, err := NewSymbolicInformation("testfiles/expressions", binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	regs, memory := areaSnapshot()
+
+	var tests = []expressionTest{
+		expressionTest{Expression: "s->corners[2].x", Expected: "2"},
+		expressionTest{Expression: "square.corners[1].y * 2", Expected: "4"},
+		expressionTest{Expression: "square.name[1]", Expected: "113"},
+		expressionTest{Expression: "values[1] + values[2]", Expected: "5"},
+		expressionTest{Expression: "*&width", Expected: "2"},
+		expressionTest{Expression: "&square", Expected: "(shape*) 0x4020"},
+		expressionTest{Expression: "&values[1]", Expected: "(int*) 0x7fe0"},
+		expressionTest{Expression: "*(values + 2)", Expected: "3"},
+		expressionTest{Expression: "s + 1", Expected: "(shape*) 0x4058"},
+		expressionTest{Expression: "&values[2] - &values[0]", Expected: "2"},
+		expressionTest{Expression: "(struct shape *)0x4020", Expected: "(shape*) 0x4020"},
+		expressionTest{Expression: "((struct shape *) 0x4020)->scale * 2", Expected: "3.000000"},
+		expressionTest{Expression: "(int)square.scale", Expected: "1"},
+		expressionTest{Expression: "(char)321", Expected: "65"},
+		expressionTest{Expression: "(size_t)-1", Expected: "18446744073709551615"},
+		expressionTest{Expression: "(float)width / 4", Expected: "0.500000"},
+		expressionTest{Expression: "2.5E+3 + width", Expected: "2502.000000"},
+		expressionTest{Expression: "square.scale > 1e-5", Expected: "1"},
+		expressionTest{Expression: "(int)(width * 1e-1 * 1e+1)", Expected: "2"},
+		expressionTest{Expression: "0x1e-5", Expected: "25"},
+		expressionTest{Expression: "sizeof(struct shape)", Expected: "56"},
+		expressionTest{Expression: "sizeof square.corners", Expected: "32"},
+		expressionTest{Expression: "sizeof(size_t) == sizeof(unsigned long)", Expected: "1"},
+		expressionTest{Expression: "square.scale > 1 && width == 2", Expected: "1"},
+		expressionTest{Expression: "s->next == 0", Expected: "1"},
+		expressionTest{Expression: "s->corners[1]", Expected: "{ x: 0 y: 2 }"},
+	}
+
+	for _, test := range tests {
+		variable, value, _, err := symbolicInfo.Evaluate(test.Expression, 0x115d, regs, memory)
+		if err != nil {
+			t.Errorf("Error: %s evaluating %s", err, test.Expression)
+			continue
+		}
+		val, err := variable.Parse(value, binary.LittleEndian)
+		if err != nil || val != test.Expected {
+			t.Errorf("Error: expected %s to be %s not %s (%v)", test.Expression, test.Expected, val, err)
+		}
+	}
+
+	invalid := []string{"width[0]", "values[1.5]", "(struct missing *)0", "&(width + 1)", "sizeof(void)", "(struct shape)width", "s + s"}
+	for _, expression := range invalid {
+		_, _, _, err := symbolicInfo.Evaluate(expression, 0x115d, regs, memory)
+		if err == nil {
+			t.Errorf("Error: expected %s to fail", expression)
+		}
+	}
+}
+
+func TestValue(t *testing.T) {
+	symbolicInfo, err := NewSymbolicInformation("testfiles/expressions", binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	regs, memory := areaSnapshot()
+
+	s, err := symbolicInfo.Value("s", 0x115d, regs, memory)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if s.Kind != debugger.PointerValue || s.Type != "struct shape *" || s.Address != 0x7fc8 || s.Uint() != 0x4020 {
+		t.Errorf("Error: expected s to be a struct shape * at 0x7fc8 pointing to 0x4020 not %s %s at %x", s.Kind, s.Type, s.Address)
+	}
+
+	shape, err := s.Target()
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	if shape.Name != "*s" || shape.Kind != debugger.StructValue || shape.Address != 0x4020 || len(shape.Children) != 4 {
+		t.Fatalf("Error: expected *s to be a struct with 4 members at 0x4020 not %s %s at %x", shape.Name, shape.Kind, shape.Address)
+	}
+	corners := shape.Child("corners")
+	if corners.Type != "struct point [4]" || len(corners.Children) != 4 {
+		t.Errorf("Error: expected corners to be an array of 4 points not %s", corners.Type)
+	}
+	corner := corners.Child("[2]")
+	if corner.Address != 0x4038 || corner.Child("x").Int() != 2 || corner.String() != "{ x: 2 y: 2 }" {
+		t.Errorf("Error: expected corner 2 to be { x: 2 y: 2 } at 0x4038 not %s at %x", corner, corner.Address)
+	}
+	if scale := shape.Child("scale"); scale.Kind != debugger.FloatValue || scale.Float() != 1.5 {
+		t.Errorf("Error: expected the scale to be 1.5 not %s", scale)
+	}
+
+	_, err = shape.Child("next").Target()
+	if err == nil || err.Error() != "Error: next is a null pointer" {
+		t.Errorf("Error: expected next to be a null pointer (%v)", err)
+	}
+
+	doubled, err := symbolicInfo.Value("width * 2", 0x115d, regs, memory)
+	if err != nil || doubled.InMemory || doubled.String() != "4" {
+		t.Errorf("Error: expected width * 2 to be 4 and not in memory (%v)", err)
+	}
+}
+
+//The snapshot is of testfiles/enums inside schedule which has been passed
+//the address of idle
+func scheduleSnapshot() (*op.DwarfRegisters, byteMemory) {
+	regs := &op.DwarfRegisters{ByteOrder: binary.LittleEndian, CFA: 0x8000, FrameBase: 0x8000}
+	memory := byteMemory{}
+	//idle
+	memory.Write(0x4010, []byte("idle\x00\x00\x00\x00"), 8)
+	memory.writeUint(0x4018, 2, 4)
+	memory.writeUint(0x401c, 3, 4)
+	memory.writeUint(0x4020, 0xffffffff, 4)
+	//t and next
+	memory.writeUint(0x7fd8, 0x4010, 8)
+	memory.writeUint(0x7fec, 1, 4)
+	return regs, memory
+}
+
+func TestEvaluateEnums(t *testing.T) {
+	symbolicInfo, err := NewSymbolicInformation("testfiles/enums", binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	regs, memory := scheduleSnapshot()
+
+	var tests = []expressionTest{
+		expressionTest{Expression: "next", Expected: "STATE_READY (1)"},
+		expressionTest{Expression: "t->state", Expected: "STATE_RUNNING (2)"},
+		expressionTest{Expression: "t->flags", Expected: "FLAG_READ | FLAG_WRITE"},
+		expressionTest{Expression: "t->direction", Expected: "BACKWARDS (-1)"},
+		expressionTest{Expression: "STATE_RUNNING", Expected: "STATE_RUNNING (2)"},
+		expressionTest{Expression: "STATE_RUNNING + 1", Expected: "3"},
+		expressionTest{Expression: "(enum state)0", Expected: "STATE_BLOCKED (0)"},
+		expressionTest{Expression: "(enum flags)(FLAG_READ | FLAG_EXEC)", Expected: "FLAG_READ | FLAG_EXEC"},
+		expressionTest{Expression: "sizeof(enum direction)", Expected: "4"},
+	}
+	for _, test := range tests {
+		variable, value, _, err := symbolicInfo.Evaluate(test.Expression, 0x1138, regs, memory)
+		if err != nil {
+			t.Errorf("Error: %s evaluating %s", err, test.Expression)
+			continue
+		}
+		val, err := variable.Parse(value, binary.LittleEndian)
+		if err != nil || val != test.Expected {
+			t.Errorf("Error: expected %s to be %s not %s (%v)", test.Expression, test.Expected, val, err)
+		}
+	}
+
+	conditions := map[string]bool{
+		"t->state == STATE_RUNNING":   true,
+		"next == STATE_BLOCKED":       false,
+		"t->flags & FLAG_WRITE":       true,
+		"t->direction < STOPPED":      true,
+		"t->direction == BACKWARDS":   true,
+		"(t->flags & FLAG_EXEC) != 0": false,
+	}
+	for condition, expected := range conditions {
+		result, err := symbolicInfo.Condition(condition, 0x1138, regs, memory)
+		if err != nil || result != expected {
+			t.Errorf("Error: expected %s to be %t (%v)", condition, expected, err)
+		}
+	}
+
+	thread, err := symbolicInfo.Value("*t", 0x1138, regs, memory)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	state := thread.Child("state")
+	if state.Kind != debugger.EnumValue || state.Type != "enum state" || state.Symbol() != "STATE_RUNNING" {
+		t.Errorf("Error: expected the state to be STATE_RUNNING not %s %s %s", state.Kind, state.Type, state.Symbol())
+	}
+	if thread.String() != "{ name: 105 100 108 101 0 0 0 0 state: STATE_RUNNING (2) flags: FLAG_READ | FLAG_WRITE direction: BACKWARDS (-1) }" {
+		t.Errorf("Error: unexpected value of *t %s", thread)
+	}
+
+	_, err = symbolicInfo.Value("STATE_MISSING", 0x1138, regs, memory)
+	if err == nil || err.Error() != "Error: no symbol STATE_MISSING in current context" {
+		t.Errorf("Error: expected STATE_MISSING not to be found (%v)", err)
+	}
+}
+
+//The snapshot is of testfiles/bitfields inside present which has been passed
+//the address of entry (the globals hold the values they're initialised with)
+func presentSnapshot() (*op.DwarfRegisters, byteMemory) {
+	regs := &op.DwarfRegisters{ByteOrder: binary.LittleEndian, CFA: 0x8000, FrameBase: 0x8000}
+	memory := byteMemory{}
+	memory.Write(0x4010, []byte{0xab, 0x5a, 0x34, 0x12, 0x00, 0x00, 0xf0, 0xff}, 8)
+	memory.Write(0x4018, []byte{0xe3, 0x00, 0x9c, 0xaf, 0x2a, 0x00, 0x00, 0x00}, 8)
+	memory.Write(0x4020, []byte{0xef, 0xbe, 0xad, 0xde}, 4)
+	//p and frame
+	memory.writeUint(0x7fd8, 0x4010, 8)
+	memory.writeUint(0x7fec, 0x12345, 4)
+	return regs, memory
+}
+
+func TestEvaluateBitfields(t *testing.T) {
+	symbolicInfo, err := NewSymbolicInformation("testfiles/bitfields", binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	regs, memory := presentSnapshot()
+
+	var tests = []expressionTest{
+		expressionTest{Expression: "p->present", Expected: "1"},
+		expressionTest{Expression: "p->reserved", Expected: "341"},
+		expressionTest{Expression: "p->frame", Expected: "74565"},
+		expressionTest{Expression: "p->frame == frame", Expected: "1"},
+		expressionTest{Expression: "entry.available + 1", Expected: "2048"},
+		expressionTest{Expression: "entry.nx", Expected: "-1"},
+		expressionTest{Expression: "header.delta", Expected: "-2"},
+		expressionTest{Expression: "header.count * 2", Expected: "-200"},
+		expressionTest{Expression: "header.state", Expected: "STATE_RUNNING (2)"},
+		expressionTest{Expression: "header.busy", Expected: "true"},
+		expressionTest{Expression: "header.id", Expected: "42"},
+		expressionTest{Expression: "value.low", Expected: "48879"},
+	}
+	for _, test := range tests {
+		variable, value, _, err := symbolicInfo.Evaluate(test.Expression, 0x1131, regs, memory)
+		if err != nil {
+			t.Errorf("Error: %s evaluating %s", err, test.Expression)
+			continue
+		}
+		val, err := variable.Parse(value, binary.LittleEndian)
+		if err != nil || val != test.Expected {
+			t.Errorf("Error: expected %s to be %s not %s (%v)", test.Expression, test.Expected, val, err)
+		}
+	}
+
+	invalid := []string{"&p->present", "&header.count"}
+	for _, expression := range invalid {
+		_, _, _, err := symbolicInfo.Evaluate(expression, 0x1131, regs, memory)
+		if err == nil {
+			t.Errorf("Error: expected %s to fail", expression)
+		}
+	}
+	_, _, _, err = symbolicInfo.Watch("p->present", 0x1131, regs, memory)
+	if err == nil {
+		t.Errorf("Error: expected a bitfield not to be watched")
+	}
+
+	header, err := symbolicInfo.Value("header", 0x1131, regs, memory)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	count := header.Child("count")
+	if count.InMemory || count.Type != "short int" || count.Int() != -100 {
+		t.Errorf("Error: expected count to be a short int of -100 not in memory not %s %s", count.Type, count)
+	}
+	if header.String() != "{ version: 3 delta: -2 count: -100 state: STATE_RUNNING (2) busy: true id: 42 }" {
+		t.Errorf("Error: unexpected value of header %s", header)
+	}
+}
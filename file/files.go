@@ -3,6 +3,7 @@ package file
 import (
 	"debug/dwarf"
 	"debug/elf"
+	"sort"
 	"strings"
 )
 
@@ -36,6 +37,8 @@ type LineInformation struct {
 	Name            string
 	data            *dwarf.Data
 	pcToLineEntry     map[uint64]dwarf.LineEntry
+	//addresses holds the keys of pcToLineEntry in order
+	addresses         []uint64
 	filenameToAddress map[string]info
 	currentLine     int
 	currentFile     string
@@ -84,9 +87,67 @@ func (lineInfo *LineInformation) Init() error {
 		}
 	}
 
+	for address := range lineInfo.pcToLineEntry {
+		lineInfo.addresses = append(lineInfo.addresses, address)
+	}
+	sort.Slice(lineInfo.addresses, func(i, j int) bool {
+		return lineInfo.addresses[i] < lineInfo.addresses[j]
+	})
 	return nil
 }
 
+//startsRange - checks whether an address is the start of a run of code
+//belonging to its line (i.e. the code before it is from a different line)
+func (lineInfo *LineInformation) startsRange(address uint64) bool {
+	index := sort.Search(len(lineInfo.addresses), func(i int) bool {
+		return lineInfo.addresses[i] >= address
+	})
+	if index == 0 {
+		return true
+	}
+	previous := lineInfo.pcToLineEntry[lineInfo.addresses[index-1]]
+	current := lineInfo.pcToLineEntry[address]
+	return previous.Line != current.Line || previous.File.Name != current.File.Name || previous.EndSequence
+}
+
+//LineAddresses - returns the address of the start of each block of code that
+//a line was compiled into (e.g. the condition of a for loop is checked in a different
+//place to where it is initialised). If the line has no code (e.g. it is a comment) the
+//next line with code is used instead. Returns the line that was used.
+func (lineInfo *LineInformation) LineAddresses(filename string, line int) ([]uint64, int) {
+	info, ok := lineInfo.filenameToAddress[filename]
+	if !ok {
+		return nil, 0
+	}
+
+	used := 0
+	for candidate := range info.lineToAddressInfo {
+		if candidate >= line && (used == 0 || candidate < used) {
+			used = candidate
+		}
+	}
+	if used == 0 {
+		return nil, 0
+	}
+
+	candidates := append([]uint64{}, info.lineToAddressInfo[used]...)
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i] < candidates[j]
+	})
+
+	var addresses []uint64
+	for i, address := range candidates {
+		//The line table can have several rows for the same address
+		if i > 0 && candidates[i-1] == address {
+			continue
+		}
+		if lineInfo.startsRange(address) {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses, used
+}
+
 //Address - gets the address of a place in a file and line
 func (lineInfo *LineInformation) Address(filename string, line int) uint64 {
 	if info, ok := lineInfo.filenameToAddress[filename]; ok {
@@ -113,6 +174,34 @@ func (lineInfo *LineInformation) AddressToLine(address uint64) (string, int, err
 	return lineEntry.File.Name, lineEntry.Line, nil 
 }
 
+//SkipPrologue - takes the range of a function and returns the address just
+//after its prologue (i.e. once the frame has been set up). The compiler may mark
+//this with prologue_end, otherwise we use the address of the function's second line.
+func (lineInfo *LineInformation) SkipPrologue(lowPC, highPC uint64) uint64 {
+	var entries []dwarf.LineEntry
+	for address, entry := range lineInfo.pcToLineEntry {
+		if address >= lowPC && address < highPC && entry.IsStmt {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Address < entries[j].Address
+	})
+
+	for _, entry := range entries {
+		if entry.PrologueEnd {
+			return entry.Address
+		}
+	}
+
+	for _, entry := range entries {
+		if entry.Address > lowPC && entry.Line != entries[0].Line {
+			return entry.Address
+		}
+	}
+	return lowPC
+}
+
 func (lineInfo *LineInformation) CurrentLine() (string, int) {
 	return lineInfo.currentFile, lineInfo.currentLine
 }
@@ -48,3 +48,46 @@ func TestIsNewLine(t *testing.T) {
 	}
 
 }
+
+func TestSkipPrologue(t *testing.T) {
+	file := LineInformation{Name: "testfiles/conditions"}
+	err := file.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//gcc doesn't mark the end of the prologue so the second line is used
+	address := file.SkipPrologue(0x1129, 0x1166)
+	if address != 0x1131 {
+		t.Errorf("Error: expected the prologue of walk to end at 0x1131 not 0x%x", address)
+	}
+	address = file.SkipPrologue(0x1166, 0x11c7)
+	if address != 0x116e {
+		t.Errorf("Error: expected the prologue of main to end at 0x116e not 0x%x", address)
+	}
+}
+
+func TestLineAddresses(t *testing.T) {
+	file := LineInformation{Name: "testfiles/conditions"}
+	err := file.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//The for loop is initialised in one place and checked/incremented in another
+	addresses, line := file.LineAddresses("conditions.c", 8)
+	if line != 8 || len(addresses) != 2 || addresses[0] != 0x1138 || addresses[1] != 0x1156 {
+		t.Errorf("Error: expected line 8 at 0x1138 and 0x1156 not line %d at %x", line, addresses)
+	}
+
+	//Line 11 is just a closing brace so we should snap to the return on line 12
+	addresses, line = file.LineAddresses("conditions.c", 11)
+	if line != 12 || len(addresses) != 1 || addresses[0] != 0x1161 {
+		t.Errorf("Error: expected line 12 at 0x1161 not line %d at %x", line, addresses)
+	}
+
+	addresses, line = file.LineAddresses("conditions.c", 100)
+	if addresses != nil || line != 0 {
+		t.Errorf("Error: expected no addresses after the end of the file")
+	}
+}
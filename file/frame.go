@@ -0,0 +1,644 @@
+package file
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/StardustOS/duster/debugger"
+	"github.com/go-delve/delve/pkg/dwarf/op"
+	"github.com/go-delve/delve/pkg/dwarf/util"
+)
+
+//The call frame instructions (DWARF 4 specification section 6.4.2)
+const (
+	cfaAdvanceLoc           = 0x40
+	cfaOffset               = 0x80
+	cfaRestore              = 0xc0
+	cfaNop                  = 0x00
+	cfaSetLoc               = 0x01
+	cfaAdvanceLoc1          = 0x02
+	cfaAdvanceLoc2          = 0x03
+	cfaAdvanceLoc4          = 0x04
+	cfaOffsetExtended       = 0x05
+	cfaRestoreExtended      = 0x06
+	cfaUndefined            = 0x07
+	cfaSameValue            = 0x08
+	cfaRegister             = 0x09
+	cfaRememberState        = 0x0a
+	cfaRestoreState         = 0x0b
+	cfaDefCFA               = 0x0c
+	cfaDefCFARegister       = 0x0d
+	cfaDefCFAOffset         = 0x0e
+	cfaDefCFAExpression     = 0x0f
+	cfaExpression           = 0x10
+	cfaOffsetExtendedSf     = 0x11
+	cfaDefCFASf             = 0x12
+	cfaDefCFAOffsetSf       = 0x13
+	cfaValOffset            = 0x14
+	cfaValOffsetSf          = 0x15
+	cfaValExpression        = 0x16
+	cfaGNUArgsSize          = 0x2e
+	cfaGNUNegOffsetExtended = 0x2f
+)
+
+//The pointer encodings used by .eh_frame (Linux Standard Base 10.5)
+const (
+	pointerAbsolute = 0x00
+	pointerUleb128  = 0x01
+	pointerUdata2   = 0x02
+	pointerUdata4   = 0x03
+	pointerUdata8   = 0x04
+	pointerSleb128  = 0x09
+	pointerSdata2   = 0x0a
+	pointerSdata4   = 0x0b
+	pointerSdata8   = 0x0c
+	pointerPCRel    = 0x10
+	pointerOmit     = 0xff
+)
+
+//The AMD64 DWARF register numbers needed for unwinding
+const (
+	registerRbp = 6
+	registerRsp = 7
+	registerRip = 16
+)
+
+type ruleType int
+
+const (
+	ruleUndefined ruleType = iota
+	ruleSameValue
+	ruleOffset
+	ruleValOffset
+	ruleRegister
+	ruleExpression
+	ruleValExpression
+)
+
+//rule describes how to recover a register (or the CFA) of the caller
+type rule struct {
+	kind       ruleType
+	register   uint64
+	offset     int64
+	expression []byte
+}
+
+//commonInformation represents a Common Information Entry (CIE)
+type commonInformation struct {
+	codeAlignment       uint64
+	dataAlignment       int64
+	returnAddress       uint64
+	pointerEncoding     byte
+	hasAugmentationData bool
+	instructions        []byte
+}
+
+//frameDescription represents a Frame Description Entry (FDE)
+type frameDescription struct {
+	cie          *commonInformation
+	begin        uint64
+	end          uint64
+	instructions []byte
+}
+
+//frameState is a row of the call frame table
+type frameState struct {
+	cfa       rule
+	registers map[uint64]rule
+}
+
+func (state frameState) copy() frameState {
+	registers := make(map[uint64]rule)
+	for register, r := range state.registers {
+		registers[register] = r
+	}
+	return frameState{cfa: state.cfa, registers: registers}
+}
+
+//CallFrameInformation handles unwinding the stack using the call
+//frame information found in the .debug_frame or .eh_frame sections
+type CallFrameInformation struct {
+	endianess    binary.ByteOrder
+	descriptions []*frameDescription
+}
+
+//sectionReader - helper for reading the fields of a section
+type sectionReader struct {
+	data      []byte
+	position  int
+	address   uint64
+	endianess binary.ByteOrder
+}
+
+func (reader *sectionReader) uint8() byte {
+	val := reader.data[reader.position]
+	reader.position += 1
+	return val
+}
+
+func (reader *sectionReader) uint16() uint16 {
+	val := reader.endianess.Uint16(reader.data[reader.position:])
+	reader.position += 2
+	return val
+}
+
+func (reader *sectionReader) uint32() uint32 {
+	val := reader.endianess.Uint32(reader.data[reader.position:])
+	reader.position += 4
+	return val
+}
+
+func (reader *sectionReader) uint64() uint64 {
+	val := reader.endianess.Uint64(reader.data[reader.position:])
+	reader.position += 8
+	return val
+}
+
+func (reader *sectionReader) uleb128() uint64 {
+	buffer := bytes.NewBuffer(reader.data[reader.position:])
+	val, length := util.DecodeULEB128(buffer)
+	reader.position += int(length)
+	return val
+}
+
+func (reader *sectionReader) sleb128() int64 {
+	buffer := bytes.NewBuffer(reader.data[reader.position:])
+	val, length := util.DecodeSLEB128(buffer)
+	reader.position += int(length)
+	return val
+}
+
+func (reader *sectionReader) string() string {
+	start := reader.position
+	for reader.data[reader.position] != 0 {
+		reader.position += 1
+	}
+	reader.position += 1
+	return string(reader.data[start : reader.position-1])
+}
+
+//pointer reads a pointer in the encoding used by the .eh_frame
+func (reader *sectionReader) pointer(encoding byte) uint64 {
+	if encoding == pointerOmit {
+		return 0
+	}
+	base := uint64(0)
+	if encoding&0x70 == pointerPCRel {
+		base = reader.address + uint64(reader.position)
+	}
+
+	var val uint64
+	switch encoding & 0x0f {
+	case pointerAbsolute, pointerUdata8, pointerSdata8:
+		val = reader.uint64()
+	case pointerUleb128:
+		val = reader.uleb128()
+	case pointerUdata2:
+		val = uint64(reader.uint16())
+	case pointerSdata2:
+		val = uint64(int16(reader.uint16()))
+	case pointerUdata4:
+		val = uint64(reader.uint32())
+	case pointerSdata4:
+		val = uint64(int32(reader.uint32()))
+	case pointerSleb128:
+		val = uint64(reader.sleb128())
+	}
+	return base + val
+}
+
+//parseCIE - parses a common information entry, the reader must be positioned
+//just after the CIE id
+func parseCIE(reader *sectionReader, end int, ehFrame bool) *commonInformation {
+	cie := &commonInformation{pointerEncoding: pointerAbsolute}
+	version := reader.uint8()
+	augmentation := reader.string()
+	if version >= 4 {
+		//Address and segment selector size
+		reader.position += 2
+	}
+	cie.codeAlignment = reader.uleb128()
+	cie.dataAlignment = reader.sleb128()
+	if version == 1 {
+		cie.returnAddress = uint64(reader.uint8())
+	} else {
+		cie.returnAddress = reader.uleb128()
+	}
+
+	if len(augmentation) > 0 && augmentation[0] == 'z' {
+		cie.hasAugmentationData = true
+		length := reader.uleb128()
+		augmentationEnd := reader.position + int(length)
+		for _, character := range augmentation[1:] {
+			switch character {
+			case 'R':
+				cie.pointerEncoding = reader.uint8()
+			case 'L':
+				reader.uint8()
+			case 'P':
+				encoding := reader.uint8()
+				reader.pointer(encoding & 0x7f)
+			}
+		}
+		reader.position = augmentationEnd
+	} else if ehFrame && augmentation == "eh" {
+		//Old GCC augmentation which is followed by a pointer
+		reader.uint64()
+	}
+	cie.instructions = reader.data[reader.position:end]
+	return cie
+}
+
+//parseFrameSection - parses a .debug_frame or .eh_frame section. The two
+//formats are almost identical, the .eh_frame differs in how the CIE is found
+//and how addresses are encoded.
+func parseFrameSection(data []byte, address uint64, endianess binary.ByteOrder, ehFrame bool) ([]*frameDescription, error) {
+	reader := &sectionReader{data: data, address: address, endianess: endianess}
+	cies := make(map[int]*commonInformation)
+	var descriptions []*frameDescription
+
+	for reader.position+4 <= len(data) {
+		start := reader.position
+		length := uint64(reader.uint32())
+		if length == 0 {
+			if ehFrame {
+				//A zero length marks the end of the .eh_frame
+				break
+			}
+			continue
+		}
+		dwarf64 := length == 0xffffffff
+		if dwarf64 {
+			length = reader.uint64()
+		}
+		end := reader.position + int(length)
+		if end > len(data) {
+			return nil, InvalidDWARF
+		}
+
+		idPosition := reader.position
+		var id uint64
+		if dwarf64 {
+			id = reader.uint64()
+		} else {
+			id = uint64(reader.uint32())
+		}
+
+		isCIE := (ehFrame && id == 0) || (!ehFrame && (id == 0xffffffff || id == 0xffffffffffffffff))
+		if isCIE {
+			cies[start] = parseCIE(reader, end, ehFrame)
+			reader.position = end
+			continue
+		}
+
+		//In .eh_frame the pointer is relative to the field, in .debug_frame it's
+		//an offset from the start of the section
+		ciePosition := int(id)
+		if ehFrame {
+			ciePosition = idPosition - int(id)
+		}
+		cie, ok := cies[ciePosition]
+		if !ok {
+			return nil, InvalidDWARF
+		}
+
+		description := &frameDescription{cie: cie}
+		if ehFrame {
+			description.begin = reader.pointer(cie.pointerEncoding)
+			description.end = description.begin + reader.pointer(cie.pointerEncoding&0x0f)
+			if cie.hasAugmentationData {
+				length := reader.uleb128()
+				reader.position += int(length)
+			}
+		} else {
+			description.begin = reader.uint64()
+			description.end = description.begin + reader.uint64()
+		}
+		description.instructions = data[reader.position:end]
+		descriptions = append(descriptions, description)
+		reader.position = end
+	}
+	return descriptions, nil
+}
+
+//NewCallFrameInformation - constructor for CallFrameInformation, it reads the
+//.debug_frame and .eh_frame sections of the ELF file
+func NewCallFrameInformation(file *elf.File, endianess binary.ByteOrder) (*CallFrameInformation, error) {
+	frameInfo := &CallFrameInformation{endianess: endianess}
+	sections := []struct {
+		name    string
+		ehFrame bool
+	}{
+		{".debug_frame", false},
+		{".eh_frame", true},
+	}
+
+	for _, section := range sections {
+		elfSection := file.Section(section.name)
+		if elfSection == nil {
+			continue
+		}
+		data, err := elfSection.Data()
+		if err != nil {
+			return nil, err
+		}
+		descriptions, err := parseFrameSection(data, elfSection.Addr, endianess, section.ehFrame)
+		if err != nil {
+			return nil, err
+		}
+		frameInfo.descriptions = append(frameInfo.descriptions, descriptions...)
+	}
+
+	sort.Slice(frameInfo.descriptions, func(i, j int) bool {
+		return frameInfo.descriptions[i].begin < frameInfo.descriptions[j].begin
+	})
+	return frameInfo, nil
+}
+
+//findDescription - returns the frame description entry that covers the pc
+func (frameInfo *CallFrameInformation) findDescription(pc uint64) *frameDescription {
+	index := sort.Search(len(frameInfo.descriptions), func(i int) bool {
+		return frameInfo.descriptions[i].end > pc
+	})
+	for ; index < len(frameInfo.descriptions); index++ {
+		description := frameInfo.descriptions[index]
+		if description.begin > pc {
+			break
+		}
+		if description.begin <= pc && pc < description.end {
+			return description
+		}
+	}
+	return nil
+}
+
+//execute - runs the call frame instructions until the location passes the pc
+func (frameInfo *CallFrameInformation) execute(state *frameState, initial frameState, cie *commonInformation, instructions []byte, location, pc uint64) error {
+	reader := &sectionReader{data: instructions, endianess: frameInfo.endianess}
+	var stack []frameState
+
+	for reader.position < len(instructions) {
+		instruction := reader.uint8()
+		operand := uint64(instruction & 0x3f)
+		switch instruction & 0xc0 {
+		case cfaAdvanceLoc:
+			location += operand * cie.codeAlignment
+			if location > pc {
+				return nil
+			}
+			continue
+		case cfaOffset:
+			state.registers[operand] = rule{kind: ruleOffset, offset: int64(reader.uleb128()) * cie.dataAlignment}
+			continue
+		case cfaRestore:
+			state.registers[operand] = initial.registers[operand]
+			continue
+		}
+
+		switch instruction {
+		case cfaNop:
+		case cfaSetLoc:
+			location = reader.pointer(cie.pointerEncoding &^ pointerPCRel)
+		case cfaAdvanceLoc1, cfaAdvanceLoc2, cfaAdvanceLoc4:
+			var delta uint64
+			switch instruction {
+			case cfaAdvanceLoc1:
+				delta = uint64(reader.uint8())
+			case cfaAdvanceLoc2:
+				delta = uint64(reader.uint16())
+			case cfaAdvanceLoc4:
+				delta = uint64(reader.uint32())
+			}
+			location += delta * cie.codeAlignment
+			if location > pc {
+				return nil
+			}
+		case cfaOffsetExtended:
+			register := reader.uleb128()
+			state.registers[register] = rule{kind: ruleOffset, offset: int64(reader.uleb128()) * cie.dataAlignment}
+		case cfaOffsetExtendedSf:
+			register := reader.uleb128()
+			state.registers[register] = rule{kind: ruleOffset, offset: reader.sleb128() * cie.dataAlignment}
+		case cfaGNUNegOffsetExtended:
+			register := reader.uleb128()
+			state.registers[register] = rule{kind: ruleOffset, offset: -int64(reader.uleb128()) * cie.dataAlignment}
+		case cfaValOffset:
+			register := reader.uleb128()
+			state.registers[register] = rule{kind: ruleValOffset, offset: int64(reader.uleb128()) * cie.dataAlignment}
+		case cfaValOffsetSf:
+			register := reader.uleb128()
+			state.registers[register] = rule{kind: ruleValOffset, offset: reader.sleb128() * cie.dataAlignment}
+		case cfaRestoreExtended:
+			register := reader.uleb128()
+			state.registers[register] = initial.registers[register]
+		case cfaUndefined:
+			state.registers[reader.uleb128()] = rule{kind: ruleUndefined}
+		case cfaSameValue:
+			state.registers[reader.uleb128()] = rule{kind: ruleSameValue}
+		case cfaRegister:
+			register := reader.uleb128()
+			state.registers[register] = rule{kind: ruleRegister, register: reader.uleb128()}
+		case cfaRememberState:
+			stack = append(stack, state.copy())
+		case cfaRestoreState:
+			if len(stack) == 0 {
+				return InvalidDWARF
+			}
+			//The CFA is not part of the state that is remembered
+			cfa := state.cfa
+			*state = stack[len(stack)-1]
+			state.cfa = cfa
+			stack = stack[:len(stack)-1]
+		case cfaDefCFA:
+			state.cfa = rule{kind: ruleRegister, register: reader.uleb128()}
+			state.cfa.offset = int64(reader.uleb128())
+		case cfaDefCFASf:
+			state.cfa = rule{kind: ruleRegister, register: reader.uleb128()}
+			state.cfa.offset = reader.sleb128() * cie.dataAlignment
+		case cfaDefCFARegister:
+			state.cfa.kind = ruleRegister
+			state.cfa.register = reader.uleb128()
+		case cfaDefCFAOffset:
+			state.cfa.offset = int64(reader.uleb128())
+		case cfaDefCFAOffsetSf:
+			state.cfa.offset = reader.sleb128() * cie.dataAlignment
+		case cfaDefCFAExpression:
+			length := int(reader.uleb128())
+			state.cfa = rule{kind: ruleExpression, expression: instructions[reader.position : reader.position+length]}
+			reader.position += length
+		case cfaExpression, cfaValExpression:
+			register := reader.uleb128()
+			length := int(reader.uleb128())
+			kind := ruleExpression
+			if instruction == cfaValExpression {
+				kind = ruleValExpression
+			}
+			state.registers[register] = rule{kind: kind, expression: instructions[reader.position : reader.position+length]}
+			reader.position += length
+		case cfaGNUArgsSize:
+			reader.uleb128()
+		default:
+			return fmt.Errorf("Error: unknown call frame instruction 0x%x", instruction)
+		}
+	}
+	return nil
+}
+
+//state - works out the row of the call frame table for the pc. If there
+//is no frame information for the pc we assume the frame pointer has been
+//set up (i.e. the code was compiled with -fno-omit-frame-pointer).
+func (frameInfo *CallFrameInformation) state(pc uint64) (frameState, uint64, error) {
+	description := frameInfo.findDescription(pc)
+	if description == nil {
+		state := frameState{
+			cfa: rule{kind: ruleRegister, register: registerRbp, offset: 16},
+			registers: map[uint64]rule{
+				registerRbp: rule{kind: ruleOffset, offset: -16},
+				registerRip: rule{kind: ruleOffset, offset: -8},
+			},
+		}
+		return state, registerRip, nil
+	}
+
+	cie := description.cie
+	initial := frameState{registers: make(map[uint64]rule)}
+	err := frameInfo.execute(&initial, initial, cie, cie.instructions, description.begin, description.end)
+	if err != nil {
+		return frameState{}, 0, err
+	}
+	state := initial.copy()
+	err = frameInfo.execute(&state, initial, cie, description.instructions, description.begin, pc)
+	return state, cie.returnAddress, err
+}
+
+//evaluate - runs a DWARF expression that has the CFA pushed on to the stack
+//before it is executed
+func evaluate(regs *op.DwarfRegisters, expression []byte) (uint64, error) {
+	program := append([]byte{byte(op.DW_OP_call_frame_cfa)}, expression...)
+	val, _, err := op.ExecuteStackProgram(*regs, program)
+	return uint64(val), err
+}
+
+//frameAddress - works out the CFA of the frame with the registers given
+func (state frameState) frameAddress(regs *op.DwarfRegisters) (uint64, error) {
+	switch state.cfa.kind {
+	case ruleRegister:
+		return uint64(int64(regs.Uint64Val(state.cfa.register)) + state.cfa.offset), nil
+	case ruleExpression:
+		val, _, err := op.ExecuteStackProgram(*regs, state.cfa.expression)
+		return uint64(val), err
+	}
+	return 0, InvalidDWARF
+}
+
+//SetCFA - sets the CFA and frame base of the registers of a frame without
+//unwinding it (the frame pointer is only used if the PC has no frame information)
+func (frameInfo *CallFrameInformation) SetCFA(regs *op.DwarfRegisters) error {
+	state, _, err := frameInfo.state(regs.Uint64Val(registerRip))
+	if err != nil {
+		return err
+	}
+	cfa, err := state.frameAddress(regs)
+	if err != nil {
+		return err
+	}
+	regs.CFA = int64(cfa)
+	regs.FrameBase = int64(cfa)
+	return nil
+}
+
+//Unwind - takes the registers of a frame and returns the registers of its
+//caller. The CFA and frame base of the registers passed are set as a side effect.
+func (frameInfo *CallFrameInformation) Unwind(regs *op.DwarfRegisters, memory debugger.MemoryAccess) (*op.DwarfRegisters, error) {
+	pc := regs.Uint64Val(registerRip)
+	state, returnAddress, err := frameInfo.state(pc)
+	if err != nil {
+		return nil, err
+	}
+
+	cfa, err := state.frameAddress(regs)
+	if err != nil {
+		return nil, err
+	}
+	regs.CFA = int64(cfa)
+	regs.FrameBase = int64(cfa)
+
+	caller := &op.DwarfRegisters{
+		ByteOrder: regs.ByteOrder,
+		PCRegNum:  registerRip,
+		SPRegNum:  registerRsp,
+		BPRegNum:  registerRbp,
+	}
+	for register, reg := range regs.Regs {
+		if reg == nil || register == registerRip || register == registerRsp {
+			continue
+		}
+		r, ok := state.registers[uint64(register)]
+		if !ok {
+			//Registers without a rule keep their value
+			r = rule{kind: ruleSameValue}
+		}
+		val, ok, err := frameInfo.recover(uint64(register), r, regs, cfa, memory)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			caller.AddReg(uint64(register), op.DwarfRegisterFromUint64(val))
+		}
+	}
+
+	r, ok := state.registers[returnAddress]
+	if !ok {
+		return nil, fmt.Errorf("Error: no return address for frame at 0x%x", pc)
+	}
+	pc, ok, err = frameInfo.recover(returnAddress, r, regs, cfa, memory)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("Error: no return address for frame at 0x%x", pc)
+	}
+	caller.AddReg(registerRip, op.DwarfRegisterFromUint64(pc))
+	//By definition the CFA is the stack pointer in the caller before the call
+	caller.AddReg(registerRsp, op.DwarfRegisterFromUint64(cfa))
+	return caller, nil
+}
+
+//recover - works out the value of a register in the caller using its rule
+func (frameInfo *CallFrameInformation) recover(register uint64, r rule, regs *op.DwarfRegisters, cfa uint64, memory debugger.MemoryAccess) (uint64, bool, error) {
+	switch r.kind {
+	case ruleUndefined:
+		return 0, false, nil
+	case ruleSameValue:
+		return regs.Uint64Val(register), true, nil
+	case ruleOffset:
+		val, err := frameInfo.readWord(memory, uint64(int64(cfa)+r.offset))
+		return val, err == nil, err
+	case ruleValOffset:
+		return uint64(int64(cfa) + r.offset), true, nil
+	case ruleRegister:
+		return regs.Uint64Val(r.register), true, nil
+	case ruleExpression:
+		address, err := evaluate(regs, r.expression)
+		if err != nil {
+			return 0, false, err
+		}
+		val, err := frameInfo.readWord(memory, address)
+		return val, err == nil, err
+	case ruleValExpression:
+		val, err := evaluate(regs, r.expression)
+		return val, err == nil, err
+	}
+	return 0, false, nil
+}
+
+func (frameInfo *CallFrameInformation) readWord(memory debugger.MemoryAccess, address uint64) (uint64, error) {
+	bytes, err := memory.Read(address, 8)
+	if err != nil {
+		return 0, err
+	}
+	return frameInfo.endianess.Uint64(bytes), nil
+}
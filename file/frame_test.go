@@ -0,0 +1,145 @@
+package file
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/go-delve/delve/pkg/dwarf/op"
+)
+
+//memorySnapshot is a fake of the VM's memory
+type memorySnapshot map[uint64]uint64
+
+func (memory memorySnapshot) Read(address uint64, size uint) ([]byte, error) {
+	bytes := make([]byte, 8)
+	binary.LittleEndian.PutUint64(bytes, memory[address])
+	return bytes[:size], nil
+}
+
+func (memory memorySnapshot) Write(address uint64, bytes []byte, size uint) error {
+	memory[address] = binary.LittleEndian.Uint64(bytes)
+	return nil
+}
+
+type unwound struct {
+	PC       uint64
+	SP       uint64
+	CFA      int64
+	Function string
+}
+
+//The snapshot is of testfiles/backtrace stopped on the first instruction of leaf,
+//which is called by inner, which is called by outer and so on.
+func snapshot() (*op.DwarfRegisters, memorySnapshot) {
+	regs := &op.DwarfRegisters{ByteOrder: binary.LittleEndian, PCRegNum: 16, SPRegNum: 7, BPRegNum: 6}
+	regs.AddReg(16, op.DwarfRegisterFromUint64(0x1139))
+	regs.AddReg(7, op.DwarfRegisterFromUint64(0x7ef0))
+	regs.AddReg(6, op.DwarfRegisterFromUint64(0x7f10))
+	memory := memorySnapshot{
+		//Return address into inner
+		0x7ef0: 0x1167,
+		//inner's frame (saved frame pointer of outer and return address into outer)
+		0x7f10: 0x7f38,
+		0x7f18: 0x118c,
+		//outer's frame
+		0x7f38: 0x7f60,
+		0x7f40: 0x11a2,
+	}
+	return regs, memory
+}
+
+var expectedFrames = []unwound{
+	unwound{PC: 0x1139, SP: 0x7ef0, CFA: 0x7ef8, Function: "leaf"},
+	unwound{PC: 0x1167, SP: 0x7ef8, CFA: 0x7f20, Function: "inner"},
+	unwound{PC: 0x118c, SP: 0x7f20, CFA: 0x7f48, Function: "outer"},
+	unwound{PC: 0x11a2, SP: 0x7f48, Function: "main"},
+}
+
+func testUnwind(t *testing.T, filename string) {
+	symbolicInfo, err := NewSymbolicInformation(filename, binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	regs, memory := snapshot()
+	for level, expected := range expectedFrames {
+		if regs.PC() != expected.PC {
+			t.Fatalf("Frame %d: expected PC 0x%x but got 0x%x", level, expected.PC, regs.PC())
+		}
+		if regs.SP() != expected.SP {
+			t.Errorf("Frame %d: expected SP 0x%x but got 0x%x", level, expected.SP, regs.SP())
+		}
+		pc := regs.PC()
+		if level > 0 {
+			pc -= 1
+		}
+		function, err := symbolicInfo.GetFunction(pc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if function.Name() != expected.Function {
+			t.Errorf("Frame %d: expected function %s but got %s", level, expected.Function, function.Name())
+		}
+		if level == len(expectedFrames)-1 {
+			break
+		}
+		caller, err := symbolicInfo.Unwind(regs, memory)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if regs.CFA != expected.CFA {
+			t.Errorf("Frame %d: expected CFA 0x%x but got 0x%x", level, expected.CFA, regs.CFA)
+		}
+		regs = caller
+	}
+}
+
+//Tests unwinding using the .eh_frame section
+func TestUnwindEhFrame(t *testing.T) {
+	testUnwind(t, "testfiles/backtrace")
+}
+
+//Tests unwinding using the .debug_frame section
+func TestUnwindDebugFrame(t *testing.T) {
+	testUnwind(t, "testfiles/backtrace_debug_frame")
+}
+
+//Tests the CFA of the innermost frame comes from the call frame information
+//(not the frame pointer, which still belongs to inner on the first instruction of leaf)
+func TestSetCFA(t *testing.T) {
+	symbolicInfo, err := NewSymbolicInformation("testfiles/backtrace", binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	regs, _ := snapshot()
+	if err := symbolicInfo.SetCFA(regs); err != nil {
+		t.Fatal(err)
+	}
+	if regs.CFA != expectedFrames[0].CFA {
+		t.Errorf("Expected CFA 0x%x but got 0x%x", expectedFrames[0].CFA, regs.CFA)
+	}
+	if regs.FrameBase != regs.CFA {
+		t.Errorf("Expected frame base 0x%x but got 0x%x", regs.CFA, regs.FrameBase)
+	}
+	if regs.PC() != expectedFrames[0].PC || regs.SP() != expectedFrames[0].SP {
+		t.Errorf("Expected the registers to be left alone but got PC 0x%x and SP 0x%x", regs.PC(), regs.SP())
+	}
+}
+
+//Tests the parameters of a function are found in order
+func TestParameters(t *testing.T) {
+	symbolicInfo, err := NewSymbolicInformation("testfiles/backtrace", binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	function, err := symbolicInfo.GetFunction(0x1160)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parameters := function.Parameters()
+	if len(parameters) != 2 {
+		t.Fatalf("Expected 2 parameters but got %d", len(parameters))
+	}
+	if parameters[0].Name() != "b" || parameters[1].Name() != "c" {
+		t.Errorf("Expected parameters b and c but got %s and %s", parameters[0].Name(), parameters[1].Name())
+	}
+}
@@ -0,0 +1,79 @@
+package file
+
+import (
+	"debug/dwarf"
+
+	"github.com/StardustOS/duster/debugger"
+)
+
+//Function represents a function (subprogram) in the program
+type Function struct {
+	name       string
+	returnType Type
+	parameters []debugger.Variable
+	LowerPC    uint64
+	UpperPC    uint64
+}
+
+//Name returns the name of the function
+func (function *Function) Name() string {
+	return function.name
+}
+
+//ReturnType returns a variable (with no location) that represents
+//the value returned by the function. Returns nil for void functions.
+func (function *Function) ReturnType() debugger.Variable {
+	if function.returnType == nil {
+		return nil
+	}
+	return &Variable{name: function.name, typeVar: function.returnType}
+}
+
+//Parameters returns the formal parameters of the function (in the order
+//they're declared)
+func (function *Function) Parameters() []debugger.Variable {
+	return function.parameters
+}
+
+//Range returns the addresses the function's instructions occupy (the
+//upper address is just past the end)
+func (function *Function) Range() (uint64, uint64) {
+	return function.LowerPC, function.UpperPC
+}
+
+//AddParameter adds a formal parameter to the function
+func (function *Function) AddParameter(variable *Variable) {
+	function.parameters = append(function.parameters, variable)
+}
+
+//parseFunction - parses the DWARF entry of a subprogram
+func parseFunction(entry *dwarf.Entry, manager *TypeManager, lowPC, highPC uint64) *Function {
+	function := &Function{LowerPC: lowPC, UpperPC: highPC}
+	field := entry.AttrField(dwarf.AttrName)
+	if field != nil {
+		function.name = field.Val.(string)
+	}
+
+	//Functions without a type return void
+	field = entry.AttrField(dwarf.AttrType)
+	if field != nil {
+		function.returnType = manager.getType(field.Val.(dwarf.Offset))
+	}
+	return function
+}
+
+//isFloat - checks whether a type is floating point once any typedefs
+//or qualifiers have been removed
+func isFloat(t Type) bool {
+	switch t.(type) {
+	case *BaseType:
+		return t.(*BaseType).Encoding == Float
+	case *TypeDef:
+		return isFloat(t.(*TypeDef).Base)
+	case *ConstType:
+		return isFloat(t.(*ConstType).t)
+	case *VolatileType:
+		return isFloat(t.(*VolatileType).t)
+	}
+	return false
+}
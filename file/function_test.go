@@ -0,0 +1,105 @@
+package file
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+type functionTest struct {
+	PC       uint64
+	Name     string
+	Data     []byte
+	Float    bool
+	Expected string
+}
+
+func TestGetFunction(t *testing.T) {
+	square := make([]byte, 4)
+	binary.LittleEndian.PutUint32(square, 16)
+	half := make([]byte, 8)
+	binary.LittleEndian.PutUint64(half, math.Float64bits(1.5))
+	pair := make([]byte, 8)
+	binary.LittleEndian.PutUint32(pair, 16)
+	binary.LittleEndian.PutUint32(pair[4:], 2)
+
+	var tests = []functionTest{
+		functionTest{PC: 0x1140, Name: "square", Data: square, Expected: "16"},
+		functionTest{PC: 0x1150, Name: "half", Data: half, Float: true, Expected: "1.500000"},
+		functionTest{PC: 0x1180, Name: "make_pair", Data: pair, Expected: "{ first: 16 second: 2 }"},
+	}
+
+	symbolicInfo, err := NewSymbolicInformation("testfiles/functions", binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		function, err := symbolicInfo.GetFunction(test.PC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if function.Name() != test.Name {
+			t.Errorf("Expected function %s but got %s", test.Name, function.Name())
+		}
+		returnType := function.ReturnType()
+		if returnType == nil {
+			t.Fatalf("Expected %s to have a return type", test.Name)
+		}
+		if symbolicInfo.IsFloat(returnType) != test.Float {
+			t.Errorf("Expected IsFloat to be %t for %s", test.Float, test.Name)
+		}
+		str, err := returnType.Parse(test.Data, binary.LittleEndian)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if str != test.Expected {
+			t.Errorf("Expected %s but got %s", test.Expected, str)
+		}
+	}
+}
+
+func TestGetFunctionVoid(t *testing.T) {
+	symbolicInfo, err := NewSymbolicInformation("testfiles/functions", binary.LittleEndian)
+	if err != nil {
+		t.Fatal(err)
+	}
+	function, err := symbolicInfo.GetFunction(0x1195)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if function.Name() != "show" {
+		t.Errorf("Expected function show but got %s", function.Name())
+	}
+	if function.ReturnType() != nil {
+		t.Error("Expected show to have no return type")
+	}
+}
+
+func TestLookupFunction(t *testing.T) {
+	symbolicInfo, err := NewSymbolicInformation("testfiles/conditions", binary.LittleEndian)
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+
+	function, err := symbolicInfo.LookupFunction("walk")
+	if err != nil {
+		t.Fatalf("Error: %s", err)
+	}
+	low, high := function.Range()
+	if function.Name() != "walk" || low != 0x1129 || high != 0x1166 {
+		t.Errorf("Error: expected walk at [0x1129, 0x1166) not %s at [0x%x, 0x%x)", function.Name(), low, high)
+	}
+	if len(function.Parameters()) != 1 || function.Parameters()[0].Name() != "head" {
+		t.Errorf("Error: expected walk to have the parameter head")
+	}
+
+	_, err = symbolicInfo.LookupFunction("run")
+	if err != FunctionNotFound {
+		t.Errorf("Error: expected function not found but got %v", err)
+	}
+
+	names := symbolicInfo.Functions()
+	if len(names) != 2 || names[0] != "main" || names[1] != "walk" {
+		t.Errorf("Error: expected the functions main and walk not %v", names)
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"debug/elf"
 	"encoding/binary"
 	"fmt"
+	"sort"
 
 	"github.com/StardustOS/duster/debugger"
+	"github.com/go-delve/delve/pkg/dwarf/op"
 )
 
 //SymbolicInformation represents the type and variables 
@@ -17,6 +19,8 @@ type SymbolicInformation struct {
 	types     *TypeManager
 	symbols   *SymbolManager
 	cu        *dwarf.Entry
+	frames    *CallFrameInformation
+	functions map[string]uint64
 	endianess binary.ByteOrder
 }
 
@@ -119,6 +123,187 @@ func (symbolicInfo *SymbolicInformation) GetPointContentSize(variable debugger.V
 	return pointer.typeOfPointer.Size()
 }
 
+//GetFunction - takes the current program counter and returns the function
+//it is in
+func (symbolicInfo *SymbolicInformation) GetFunction(rip uint64) (debugger.Function, error) {
+	err := symbolicInfo.Parse(rip)
+	if err != nil {
+		return nil, err
+	}
+	function, err := symbolicInfo.symbols.GetFunction(rip)
+	if err != nil {
+		return nil, err
+	}
+	return function, nil
+}
+
+//indexFunctions - records the address of every function in the program so
+//they can be found by name (unlike the symbols this covers every compile unit)
+func (symbolicInfo *SymbolicInformation) indexFunctions() error {
+	if symbolicInfo.functions != nil {
+		return nil
+	}
+
+	functions := make(map[string]uint64)
+	reader := symbolicInfo.data.Reader()
+	for entry, err := reader.Next(); entry != nil; entry, err = reader.Next() {
+		if err != nil {
+			return err
+		}
+		if entry.Tag != dwarf.TagSubprogram {
+			continue
+		}
+
+		//Declarations and inlined functions don't have any code of their own
+		name, ok := entry.Val(dwarf.AttrName).(string)
+		lowPC, highPC, err := parsePC(entry)
+		if !ok || err != nil || lowPC == highPC {
+			continue
+		}
+		functions[name] = lowPC
+	}
+	symbolicInfo.functions = functions
+	return nil
+}
+
+//LookupFunction - takes the name of a function and returns it
+func (symbolicInfo *SymbolicInformation) LookupFunction(name string) (debugger.Function, error) {
+	err := symbolicInfo.indexFunctions()
+	if err != nil {
+		return nil, err
+	}
+
+	address, ok := symbolicInfo.functions[name]
+	if !ok {
+		return nil, FunctionNotFound
+	}
+	return symbolicInfo.GetFunction(address)
+}
+
+//Functions - returns the names of all the functions in the program (sorted)
+func (symbolicInfo *SymbolicInformation) Functions() []string {
+	err := symbolicInfo.indexFunctions()
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for name := range symbolicInfo.functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//IsFloat - takes a variable and returns whether it is a floating point number
+func (symbolicInfo *SymbolicInformation) IsFloat(variable debugger.Variable) bool {
+	v := variable.(*Variable)
+	return isFloat(v.typeVar)
+}
+
+//Unwind - takes the registers of a frame and returns the registers of the
+//frame that called it
+func (symbolicInfo *SymbolicInformation) Unwind(regs *op.DwarfRegisters, memory debugger.MemoryAccess) (*op.DwarfRegisters, error) {
+	return symbolicInfo.frames.Unwind(regs, memory)
+}
+
+//SetCFA - sets the CFA and frame base of the registers of a frame from the
+//call frame information
+func (symbolicInfo *SymbolicInformation) SetCFA(regs *op.DwarfRegisters) error {
+	return symbolicInfo.frames.SetCFA(regs)
+}
+
+//CheckExpression - checks a C expression is well formed without evaluating it
+func (symbolicInfo *SymbolicInformation) CheckExpression(expression string) error {
+	eval := &evaluator{types: symbolicInfo.types}
+	_, err := parseExpression(expression, eval.isType)
+	return err
+}
+
+//Condition - evaluates a C expression in the frame described by the program
+//counter and registers, and returns whether it is true
+func (symbolicInfo *SymbolicInformation) Condition(expression string, pc uint64, regs *op.DwarfRegisters, memory debugger.MemoryAccess) (bool, error) {
+	err := symbolicInfo.Parse(pc)
+	if err != nil {
+		return false, err
+	}
+	eval := &evaluator{pc: pc, regs: regs, memory: memory, symbols: symbolicInfo.symbols, types: symbolicInfo.types, endianess: symbolicInfo.endianess}
+	return eval.evaluateCondition(expression)
+}
+
+//Watch - evaluates a C expression which refers to memory in the frame described by
+//the program counter and registers. Returns a variable describing the memory, its
+//address and whether the expression uses local variables.
+func (symbolicInfo *SymbolicInformation) Watch(expression string, pc uint64, regs *op.DwarfRegisters, memory debugger.MemoryAccess) (debugger.Variable, uint64, bool, error) {
+	result, eval, err := symbolicInfo.evaluate(expression, pc, regs, memory)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if !result.inMemory || result.t == nil {
+		return nil, 0, false, fmt.Errorf("Error: cannot watch %s as it is not stored in memory", expression)
+	}
+
+	location := make([]byte, 9)
+	location[0] = byte(op.DW_OP_addr)
+	symbolicInfo.endianess.PutUint64(location[1:], result.address)
+	return &Variable{name: expression, typeVar: result.t, location: location}, result.address, eval.local, nil
+}
+
+//Evaluate - evaluates a C expression in the frame described by the program counter
+//and registers. Returns a variable describing its type, the bytes of its value and
+//whether the expression uses local variables.
+func (symbolicInfo *SymbolicInformation) Evaluate(expression string, pc uint64, regs *op.DwarfRegisters, memory debugger.MemoryAccess) (debugger.Variable, []byte, bool, error) {
+	result, eval, err := symbolicInfo.evaluate(expression, pc, regs, memory)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	bytes, err := eval.load(result)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	return &Variable{name: expression, typeVar: result.t}, bytes, eval.local, nil
+}
+
+//Value - evaluates a C expression in the frame described by the program counter
+//and registers and returns its value as a tree
+func (symbolicInfo *SymbolicInformation) Value(expression string, pc uint64, regs *op.DwarfRegisters, memory debugger.MemoryAccess) (*debugger.Value, error) {
+	result, eval, err := symbolicInfo.evaluate(expression, pc, regs, memory)
+	if err != nil {
+		return nil, err
+	}
+	return eval.tree(expression, result)
+}
+
+//VariableValue - returns the value of a variable as a tree given the bytes stored in it
+func (symbolicInfo *SymbolicInformation) VariableValue(variable debugger.Variable, bytes []byte, memory debugger.MemoryAccess) (*debugger.Value, error) {
+	v := variable.(*Variable)
+	if bytes == nil {
+		return nil, fmt.Errorf("Error: the value of %s is not available", v.Name())
+	}
+	eval := &evaluator{memory: memory, symbols: symbolicInfo.symbols, types: symbolicInfo.types, endianess: symbolicInfo.endianess}
+	return eval.tree(v.Name(), &value{t: v.typeVar, bytes: bytes})
+}
+
+//evaluate - parses and evaluates a C expression returning its value along
+//with the evaluator used
+func (symbolicInfo *SymbolicInformation) evaluate(expression string, pc uint64, regs *op.DwarfRegisters, memory debugger.MemoryAccess) (*value, *evaluator, error) {
+	err := symbolicInfo.Parse(pc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	eval := &evaluator{pc: pc, regs: regs, memory: memory, symbols: symbolicInfo.symbols, types: symbolicInfo.types, endianess: symbolicInfo.endianess}
+	tree, err := parseExpression(expression, eval.isType)
+	if err != nil {
+		return nil, nil, err
+	}
+	result, err := tree.evaluate(eval)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, eval, nil
+}
+
 //SymbolManager - returns the symbol manager
 func (symbolicInfo *SymbolicInformation) SymbolManager() *SymbolManager {
 	return symbolicInfo.symbols
@@ -134,8 +319,13 @@ func NewSymbolicInformation(filename string, endianess binary.ByteOrder) (*Symbo
 	if err != nil {
 		return nil, err
 	}
+	frames, err := NewCallFrameInformation(file, endianess)
+	if err != nil {
+		return nil, err
+	}
 	symbolicInfo := new(SymbolicInformation)
 	symbolicInfo.data = dwarfData
+	symbolicInfo.frames = frames
 	symbolicInfo.endianess = endianess
 	return symbolicInfo, nil
 }
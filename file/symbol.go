@@ -8,10 +8,11 @@ import (
 type SymbolError int
 
 const (
-	InvalidDWARF   SymbolError = 0
-	SymbolNotFound SymbolError = 1
-	NoLoctionFound SymbolError = 2
-	NoName         SymbolError = 3
+	InvalidDWARF     SymbolError = 0
+	SymbolNotFound   SymbolError = 1
+	NoLoctionFound   SymbolError = 2
+	NoName           SymbolError = 3
+	FunctionNotFound SymbolError = 4
 )
 
 func (err SymbolError) Error() string {
@@ -22,6 +23,8 @@ func (err SymbolError) Error() string {
 		return "Error: symbol not found"
 	case NoLoctionFound:
 		return "Error: not found location"
+	case FunctionNotFound:
+		return "Error: function not found"
 	}
 	return ""
 }
@@ -30,6 +33,7 @@ type SymbolTable struct {
 	parent   *SymbolTable
 	symbols  map[string]*Variable
 	children []*SymbolTable
+	function *Function
 	LowerPC  uint64
 	UpperPC  uint64
 }
@@ -121,6 +125,9 @@ func (manager *SymbolManager) ParseDwarfEntry(entry *dwarf.Entry) error {
 			return err
 		}
 		manager.currentTable.AddVariable(variable)
+		if entry.Tag == dwarf.TagFormalParameter && manager.currentTable.function != nil {
+			manager.currentTable.function.AddParameter(variable)
+		}
 	case dwarf.TagSubprogram:
 		lowPC, highPC, err := parsePC(entry)
 		if err != nil {
@@ -128,6 +135,7 @@ func (manager *SymbolManager) ParseDwarfEntry(entry *dwarf.Entry) error {
 		}
 		parent := manager.rootTable
 		newTable := &SymbolTable{LowerPC: lowPC, UpperPC: highPC}
+		newTable.function = parseFunction(entry, manager.typemanager, lowPC, highPC)
 		parent.AddChild(newTable)
 		newTable.AddParent(parent)
 		manager.currentTable = newTable
@@ -158,6 +166,16 @@ func (manager *SymbolManager) GetSymbol(pc uint64, name string) (*Variable, erro
 	return variable, err
 }
 
+//GetFunction - returns the function that the pc is in
+func (manager *SymbolManager) GetFunction(pc uint64) (*Function, error) {
+	for table := manager.rootTable.GetNextTable(pc); table != nil; table = table.Parent() {
+		if table.function != nil {
+			return table.function, nil
+		}
+	}
+	return nil, FunctionNotFound
+}
+
 func parsePC(entry *dwarf.Entry) (lower, upper uint64, err error) {
 	lowPC := entry.AttrField(dwarf.AttrLowpc)
 	highPC := entry.AttrField(dwarf.AttrHighpc)
@@ -0,0 +1,22 @@
+#include <stdio.h>
+
+int leaf(void) {
+    int value = 42;
+    return value;
+}
+
+int inner(int b, int c) {
+    int sum = b + c;
+    sum += leaf();
+    return sum;
+}
+
+int outer(int a) {
+    int result = inner(a, a * 2);
+    return result;
+}
+
+int main(void) {
+    printf("%d\n", outer(3));
+    return 0;
+}
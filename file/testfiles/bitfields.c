@@ -0,0 +1,38 @@
+enum state { STATE_BLOCKED, STATE_READY, STATE_RUNNING };
+
+struct pte {
+	unsigned int present : 1;
+	unsigned int writable : 1;
+	unsigned int user : 1;
+	unsigned int reserved : 9;
+	unsigned long frame : 40;
+	unsigned int available : 11;
+	int nx : 1;
+};
+
+struct ring_header {
+	unsigned char version : 4;
+	signed char delta : 4;
+	short count : 12;
+	enum state state : 3;
+	_Bool busy : 1;
+	int id;
+};
+
+union reg {
+	unsigned int raw;
+	unsigned int low : 16;
+};
+
+struct pte entry = {1, 1, 0, 0x155, 0x12345, 0x7ff, -1};
+struct ring_header header = {3, -2, -100, STATE_RUNNING, 1, 42};
+union reg value = {0xdeadbeef};
+
+int present(struct pte *p) {
+	int frame = p->frame;
+	return p->present && frame != 0;
+}
+
+int main() {
+	return present(&entry) + header.count + value.low;
+}
@@ -0,0 +1,21 @@
+struct node {
+    int value;
+    struct node *next;
+};
+
+int walk(struct node *head) {
+    int total = 0;
+    for (int i = 0; head != 0; i++) {
+        total += head->value;
+        head = head->next;
+    }
+    return total;
+}
+
+int main(void) {
+    struct node third = {30, 0};
+    struct node second = {20, &third};
+    struct node first = {10, &second};
+    float scale = 2.5;
+    return walk(&first) * scale;
+}
@@ -0,0 +1,30 @@
+enum state { STATE_BLOCKED, STATE_READY, STATE_RUNNING };
+
+enum flags { FLAG_READ = 1, FLAG_WRITE = 2, FLAG_EXEC = 4 };
+
+enum direction { BACKWARDS = -1, STOPPED, FORWARDS };
+
+struct thread {
+	char name[8];
+	enum state state;
+	enum flags flags;
+	enum direction direction;
+};
+
+struct thread idle = {"idle", STATE_RUNNING, FLAG_READ | FLAG_WRITE, BACKWARDS};
+
+int schedule(struct thread *t) {
+	enum state next = STATE_READY;
+	if (t->state == STATE_RUNNING && (t->flags & FLAG_EXEC) == 0) {
+		next = STATE_BLOCKED;
+	}
+	return next;
+}
+
+int main() {
+	return schedule(&idle);
+}
+
+enum access { RD = 1, WR = 2 };
+
+enum access mode = RD | WR;
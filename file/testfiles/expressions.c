@@ -0,0 +1,25 @@
+typedef unsigned long size_t;
+
+struct point {
+    int x;
+    int y;
+};
+
+struct shape {
+    char name[8];
+    struct point corners[4];
+    struct shape *next;
+    double scale;
+};
+
+struct shape square = {"square", {{0, 0}, {0, 2}, {2, 2}, {2, 0}}, 0, 1.5};
+
+size_t area(struct shape *s) {
+    size_t width = s->corners[2].x - s->corners[0].x;
+    int values[3] = {1, 2, 3};
+    return width * width * values[0];
+}
+
+int main(void) {
+    return area(&square);
+}
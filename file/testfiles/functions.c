@@ -0,0 +1,35 @@
+#include <stdio.h>
+
+struct pair {
+    int first;
+    int second;
+};
+
+int square(int x) {
+    int result = x * x;
+    return result;
+}
+
+double half(double value) {
+    return value / 2;
+}
+
+struct pair make_pair(int first, int second) {
+    struct pair p;
+    p.first = first;
+    p.second = second;
+    return p;
+}
+
+void show(int value) {
+    printf("%d\n", value);
+}
+
+int main(void) {
+    int total = square(4);
+    double h = half(3.0);
+    struct pair p = make_pair(total, 2);
+    show(p.first + p.second);
+    printf("%f\n", h);
+    return 0;
+}
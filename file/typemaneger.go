@@ -74,9 +74,20 @@ func (arr *Array) SetSize(size int) {
 }
 
 //Size returns the total number of bytes used to represent the array
-//(i.e. number of elements multipled by the size of the type)
+//(i.e. number of elements multipled by the size of the type). Note
+//noElement holds the upper bound of the array (one less than its length).
 func (arr *Array) Size() int {
-	return arr.noElement * (arr.typeArray.Size() + 1)
+	return (arr.noElement + 1) * arr.typeArray.Size()
+}
+
+//Length returns the number of elements in the array
+func (arr *Array) Length() int {
+	return arr.noElement + 1
+}
+
+//Element returns the type of the elements of the array
+func (arr *Array) Element() Type {
+	return arr.typeArray
 }
 
 //Parse returns a human readable string of the array
@@ -217,6 +228,80 @@ type Attribute struct {
 	Offset    int
 	//The type of the attribute
 	base      Type
+	//BitSize is the number of bits in a bitfield (0 if it isn't one) and
+	//BitOffset is where its bits start in the byte at Offset (counting from
+	//the least significant bit on little endian machines and the most
+	//significant on big endian ones, the same as DW_AT_data_bit_offset)
+	BitSize   int
+	BitOffset int
+}
+
+//storage - returns the number of bytes (starting at Offset) the attribute is stored in
+func (attr *Attribute) storage() int {
+	if attr.BitSize == 0 {
+		return attr.base.Size()
+	}
+	return (attr.BitOffset + attr.BitSize + 7) / 8
+}
+
+//field - returns the bytes of the attribute from the bytes of the struct it is in
+func (attr *Attribute) field(bytes []byte, endianess binary.ByteOrder) []byte {
+	stored := bytes[attr.Offset : attr.Offset+attr.storage()]
+	if attr.BitSize == 0 {
+		return stored
+	}
+	return attr.extract(stored, endianess)
+}
+
+//extract - takes the bytes a bitfield is stored in and returns its value as
+//the bytes of its type (sign extended if the type is signed)
+func (attr *Attribute) extract(stored []byte, endianess binary.ByteOrder) []byte {
+	var integer uint64
+	end := attr.BitOffset + attr.BitSize
+	for i, b := range stored {
+		//shift is how far left the byte is moved so the bitfield ends up
+		//in the least significant bits
+		shift := 8*i - attr.BitOffset
+		if endianess == binary.BigEndian {
+			shift = end - 8*(i+1)
+		}
+		if shift >= 0 {
+			integer |= uint64(b) << uint(shift)
+		} else {
+			integer |= uint64(b) >> uint(-shift)
+		}
+	}
+
+	if attr.BitSize < 64 {
+		integer &= 1<<uint(attr.BitSize) - 1
+		if isSigned(attr.base) && integer&(1<<uint(attr.BitSize-1)) != 0 {
+			integer |= ^uint64(0) << uint(attr.BitSize)
+		}
+	}
+
+	bytes := make([]byte, attr.base.Size())
+	switch len(bytes) {
+	case 1:
+		bytes[0] = byte(integer)
+	case 2:
+		endianess.PutUint16(bytes, uint16(integer))
+	case 4:
+		endianess.PutUint32(bytes, uint32(integer))
+	case 8:
+		endianess.PutUint64(bytes, integer)
+	}
+	return bytes
+}
+
+//isSigned - returns whether a type holds signed integers
+func isSigned(t Type) bool {
+	switch t := resolve(t).(type) {
+	case *BaseType:
+		return t.Encoding == Sinteger || t.Encoding == Schar
+	case *Enum:
+		return t.signed
+	}
+	return false
 }
 
 //Struct represents a struct time in C
@@ -225,6 +310,8 @@ type Struct struct {
 	Name       string
 	attributes []*Attribute
 	needType   map[dwarf.Offset][]*Attribute
+	//byteSize is the size given by the DWARF (which includes any padding)
+	byteSize int
 }
 
 //AddAtribute adds an attribute to the struct
@@ -255,6 +342,9 @@ func (s *Struct) AddType(offset dwarf.Offset, t Type) {
 //encodes this information makes sure the calculation accounts
 //for the offset due to C's alignment rules
 func (s *Struct) Size() int {
+	if s.byteSize > 0 {
+		return s.byteSize
+	}
 	size := 0
 	for _, attr := range s.attributes {
 		size += attr.Offset
@@ -266,9 +356,7 @@ func (s *Struct) Size() int {
 func (s *Struct) Parse(bytes []byte, endianess binary.ByteOrder) (string, error) {
 	str := "{"
 	for _, val := range s.attributes {
-		start := val.Offset
-		end := val.Offset + val.base.Size()
-		attributeData := bytes[start:end]
+		attributeData := val.field(bytes, endianess)
 		out, err := val.base.Parse(attributeData, endianess)
 		if err != nil {
 			return "", err
@@ -284,6 +372,7 @@ type Union struct {
 	Name       string
 	attributes []*Attribute
 	needType   map[dwarf.Offset][]*Attribute
+	byteSize   int
 }
 
 //AddAtribute add an attribute (i.e. a potential of intrepreting the data)
@@ -311,6 +400,9 @@ func (s *Union) AddType(offset dwarf.Offset, t Type) {
 //Size calculates the size of the union (i.e. returns the largest
 //size of the potential types it can hold)
 func (union *Union) Size() int {
+	if union.byteSize > 0 {
+		return union.byteSize
+	}
 	var largest int
 	for _, attr := range union.attributes {
 		if largest < attr.base.Size() {
@@ -325,7 +417,7 @@ func (union *Union) Size() int {
 func (union *Union) Parse(bytes []byte, endianess binary.ByteOrder) (string, error) {
 	str := "{"
 	for _, attr := range union.attributes {
-		val, err := attr.base.Parse(bytes[:attr.base.Size()], endianess)
+		val, err := attr.base.Parse(attr.field(bytes, endianess), endianess)
 		if err != nil {
 			return "", err
 		}
@@ -472,6 +564,9 @@ func parseUnion(entry *dwarf.Entry) (*Union, error) {
 		return nil, errors.New("Error: Union has no name")
 	}
 	newUnion.Name = field.Val.(string)
+	if size, ok := entry.Val(dwarf.AttrByteSize).(int64); ok {
+		newUnion.byteSize = int(size)
+	}
 	return newUnion, nil
 }
 
@@ -483,6 +578,9 @@ func parseStruct(entry *dwarf.Entry) (*Struct, error) {
 		return nil, AnnoymousStruct
 	}
 	newStruct.Name = field.Val.(string)
+	if size, ok := entry.Val(dwarf.AttrByteSize).(int64); ok {
+		newStruct.byteSize = int(size)
+	}
 	return newStruct, nil
 }
 
@@ -509,14 +607,42 @@ func parseMember(entry *dwarf.Entry, manager *TypeManager) (*Attribute, error) {
 	}
 
 	field = entry.AttrField(dwarf.AttrDataMemberLoc)
-	if field == nil {
-		return newAttribute, nil //errors.New("No memeber location")
+	if field != nil {
+		newAttribute.Offset = int(field.Val.(int64))
 	}
-	newAttribute.Offset = int(field.Val.(int64))
-
+	parseBitfield(entry, newAttribute, manager.Endianess)
 	return newAttribute, nil
 }
 
+//parseBitfield - works out where the bits of a bitfield are (if the member is one).
+//DWARF 4 and earlier give the offset from the most significant bit of a storage
+//unit at the member location, DWARF 5 gives the offset from the start of the struct.
+func parseBitfield(entry *dwarf.Entry, attr *Attribute, endianess binary.ByteOrder) {
+	bitSize, ok := entry.Val(dwarf.AttrBitSize).(int64)
+	if !ok {
+		return
+	}
+	attr.BitSize = int(bitSize)
+
+	bitOffset := int64(attr.Offset) * 8
+	if offset, ok := entry.Val(dwarf.AttrDataBitOffset).(int64); ok {
+		bitOffset = offset
+	} else if offset, ok := entry.Val(dwarf.AttrBitOffset).(int64); ok {
+		if endianess == binary.BigEndian {
+			bitOffset += offset
+		} else {
+			//The most significant bit of the unit is its last bit on little endian machines
+			unit, ok := entry.Val(dwarf.AttrByteSize).(int64)
+			if !ok && attr.base != nil {
+				unit = int64(attr.base.Size())
+			}
+			bitOffset += unit*8 - offset - bitSize
+		}
+	}
+	attr.Offset = int(bitOffset / 8)
+	attr.BitOffset = int(bitOffset % 8)
+}
+
 //Parses a pointer 
 func parsePointer(entry *dwarf.Entry, manager *TypeManager) (*Pointer, error) {
 	pointer := new(Pointer)
@@ -547,6 +673,7 @@ type TypeManager struct {
 	waitingDef   map[dwarf.Offset][]Type
 	current      ComplexType
 	currentArray *Array
+	currentEnum  *Enum
 }
 
 //addWaiting - waiting list for any type that needs another type to be
@@ -604,6 +731,34 @@ func (manager *TypeManager) getType(offset dwarf.Offset) Type {
 	return manager.types[offset]
 }
 
+//Lookup returns the type with the name given (nil if there isn't one). Structs,
+//unions and enums are named as they are in C (e.g. struct foo), a struct which has
+//only been declared is only returned if it has not been defined.
+func (manager *TypeManager) Lookup(name string) Type {
+	var found Type
+	for _, t := range manager.types {
+		var matches, complete bool
+		switch t := t.(type) {
+		case *BaseType:
+			matches, complete = t.Name == name, true
+		case *TypeDef:
+			matches, complete = t.Name == name, true
+		case *Struct:
+			matches, complete = "struct "+t.Name == name, len(t.attributes) > 0
+		case *Union:
+			matches, complete = "union "+t.Name == name, len(t.attributes) > 0
+		case *Enum:
+			matches, complete = t.Name != "" && "enum "+t.Name == name, len(t.Enumerators) > 0
+		}
+		if matches && complete {
+			return t
+		} else if matches {
+			found = t
+		}
+	}
+	return found
+}
+
 //Size returns the size based off the dwarf.Offset 
 //(which is unique to each type)
 func (manager *TypeManager) Size(offset dwarf.Offset) int {
@@ -687,6 +842,161 @@ func parseConst(entry *dwarf.Entry, manager *TypeManager) (*ConstType, error) {
 	return constant, nil
 }
 
+//Enumerator is one of the named values of an enum
+type Enumerator struct {
+	Name  string
+	Value int64
+}
+
+//Enum represents an enumeration type in C (i.e. enum state { RUNNING, BLOCKED })
+type Enum struct {
+	//Name of the enum (empty if it is anonymous)
+	Name        string
+	size        int
+	signed      bool
+	Enumerators []*Enumerator
+}
+
+//Size returns the number of bytes used to store the enum
+func (e *Enum) Size() int {
+	return e.size
+}
+
+//integer - returns the value stored in the bytes of the enum
+func (e *Enum) integer(bytes []byte, endianess binary.ByteOrder) int64 {
+	if e.signed {
+		return parseInteger(bytes, endianess)
+	}
+	return int64(parseUinteger(bytes, endianess))
+}
+
+//isFlags - returns whether the enumerators are flags which can be OR-ed
+//together (i.e. each one other than 0 is a single bit of its own and they
+//aren't just the values 0 to n-1 given to { A, B, C } by default)
+func (e *Enum) isFlags() bool {
+	var seen int64
+	sequential := true
+	for i, enumerator := range e.Enumerators {
+		if enumerator.Value != int64(i) {
+			sequential = false
+		}
+		if enumerator.Value == 0 {
+			continue
+		}
+		//Each flag is a bit of its own
+		if enumerator.Value < 0 || enumerator.Value&(enumerator.Value-1) != 0 || seen&enumerator.Value != 0 {
+			return false
+		}
+		seen |= enumerator.Value
+	}
+	return !sequential
+}
+
+//Symbol returns the name of a value of the enum. If no enumerator has the value
+//and the enum holds flags it is written as the flags OR-ed together (A | B). An
+//empty string is returned if it can't be named (e.g. it has bits no flag has).
+func (e *Enum) Symbol(value int64) string {
+	for _, enumerator := range e.Enumerators {
+		if enumerator.Value == value {
+			return enumerator.Name
+		}
+	}
+	if value == 0 || !e.isFlags() {
+		return ""
+	}
+
+	var names []string
+	for _, enumerator := range e.Enumerators {
+		if enumerator.Value != 0 && value&enumerator.Value == enumerator.Value {
+			names = append(names, enumerator.Name)
+			value &^= enumerator.Value
+		}
+	}
+	if value != 0 {
+		return ""
+	}
+	return strings.Join(names, " | ")
+}
+
+//Parse returns the name of the enumerator along with its value, e.g. RUNNING (2),
+//or the flags OR-ed together (A | B)
+func (e *Enum) Parse(bytes []byte, endianess binary.ByteOrder) (string, error) {
+	if len(bytes) != e.size {
+		return "", fmt.Errorf("Error: enum %s expects %d bytes but got %d", e.Name, e.size, len(bytes))
+	}
+	value := e.integer(bytes, endianess)
+	symbol := e.Symbol(value)
+	if symbol == "" {
+		return fmt.Sprintf("%d", value), nil
+	} else if strings.Contains(symbol, " | ") {
+		return symbol, nil
+	}
+	return fmt.Sprintf("%s (%d)", symbol, value), nil
+}
+
+//Lookup returns the enumerator with the name given (nil if there isn't one)
+func (e *Enum) Lookup(name string) *Enumerator {
+	for _, enumerator := range e.Enumerators {
+		if enumerator.Name == name {
+			return enumerator
+		}
+	}
+	return nil
+}
+
+//parseEnum parses the enumeration type from the DWARF (its enumerators
+//follow it)
+func parseEnum(entry *dwarf.Entry) (*Enum, error) {
+	enum := new(Enum)
+	enum.Name, _ = entry.Val(dwarf.AttrName).(string)
+	size, ok := entry.Val(dwarf.AttrByteSize).(int64)
+	if !ok {
+		return nil, errors.New("Error: no byte size for the enum")
+	}
+	enum.size = int(size)
+	//Older compilers don't give the encoding, parseEnumerator then makes
+	//an enum with negative values signed
+	if encoding, ok := entry.Val(dwarf.AttrEncoding).(int64); ok {
+		enum.signed = DType(encoding) == Sinteger
+	}
+	return enum, nil
+}
+
+//parseEnumerator parses an enumerator and adds it to its enum
+func parseEnumerator(entry *dwarf.Entry, enum *Enum) error {
+	name, ok := entry.Val(dwarf.AttrName).(string)
+	if !ok {
+		return errors.New("Error: no name for the enumerator")
+	}
+	var value int64
+	switch v := entry.Val(dwarf.AttrConstValue).(type) {
+	case int64:
+		value = v
+	case uint64:
+		value = int64(v)
+	default:
+		return fmt.Errorf("Error: no value for the enumerator %s", name)
+	}
+	if value < 0 {
+		enum.signed = true
+	}
+	enum.Enumerators = append(enum.Enumerators, &Enumerator{Name: name, Value: value})
+	return nil
+}
+
+//Enumerator returns the enum which has an enumerator with the name given
+//(nil if there isn't one)
+func (manager *TypeManager) Enumerator(name string) (*Enum, *Enumerator) {
+	for _, t := range manager.types {
+		if enum, ok := t.(*Enum); ok {
+			if enumerator := enum.Lookup(name); enumerator != nil {
+				return enum, enumerator
+			}
+		}
+	}
+	return nil, nil
+}
+
 //ParseDwarfEntry parses a dwarf entry and adds it the typemanager struct
 func (manager *TypeManager) ParseDwarfEntry(entry *dwarf.Entry) error {
 	var added bool
@@ -770,6 +1080,22 @@ func (manager *TypeManager) ParseDwarfEntry(entry *dwarf.Entry) error {
 		}
 		manager.addType(entry.Offset, constant)
 		added = true
+	case dwarf.TagEnumerationType:
+		enum, err := parseEnum(entry)
+		if err != nil {
+			return err
+		}
+		manager.addType(entry.Offset, enum)
+		added = true
+		manager.currentEnum = enum
+	case dwarf.TagEnumerator:
+		if manager.currentEnum == nil {
+			return nil
+		}
+		err := parseEnumerator(entry, manager.currentEnum)
+		if err != nil {
+			return err
+		}
 	}
 
 	if added {
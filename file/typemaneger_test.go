@@ -346,3 +346,101 @@ func TestConst(t *testing.T) {
 	}
 
 }
+
+func TestEnum(t *testing.T) {
+	value := func(v int32) []byte {
+		data := make([]byte, 4)
+		binary.LittleEndian.PutUint32(data, uint32(v))
+		return data
+	}
+	var tests = []val{
+		val{offset: 0x0000002e, data: value(2), expected: "STATE_RUNNING (2)"},
+		val{offset: 0x0000002e, data: value(7), expected: "7"},
+		val{offset: 0x0000002e, data: value(3), expected: "3"},
+		val{offset: 0x00000057, data: value(4), expected: "FLAG_EXEC (4)"},
+		val{offset: 0x00000057, data: value(3), expected: "FLAG_READ | FLAG_WRITE"},
+		val{offset: 0x00000057, data: value(13), expected: "13"},
+		val{offset: 0x00000057, data: value(8), expected: "8"},
+		val{offset: 0x00000079, data: value(-1), expected: "BACKWARDS (-1)"},
+		val{offset: 0x00000113, data: value(3), expected: "RD | WR"},
+		val{offset: 0x00000113, data: value(2), expected: "WR (2)"},
+		val{offset: 0x00000113, data: value(4), expected: "4"},
+	}
+	reader := setup("./testfiles/enums", t)
+	var manager TypeManager
+	manager.Endianess = binary.LittleEndian
+	for entry, _ := reader.Next(); entry != nil; entry, _ = reader.Next() {
+		err := manager.ParseDwarfEntry(entry)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+	}
+	for _, v := range tests {
+		str, err := manager.ParseBytes(v.offset, v.data)
+		if err != nil || str != v.expected {
+			t.Errorf("Expected %s but got %s (%v)", v.expected, str, err)
+		}
+	}
+
+	if _, ok := manager.Lookup("enum state").(*Enum); !ok {
+		t.Errorf("Expected enum state to be found")
+	}
+	enum, enumerator := manager.Enumerator("FORWARDS")
+	if enum == nil || enum.Name != "direction" || enumerator.Value != 1 {
+		t.Errorf("Expected FORWARDS to be 1 in enum direction")
+	}
+}
+
+func TestBitfield(t *testing.T) {
+	entry := []byte{0xab, 0x5a, 0x34, 0x12, 0x00, 0x00, 0xf0, 0xff}
+	header := []byte{0xe3, 0x00, 0x9c, 0xaf, 0x2a, 0x00, 0x00, 0x00}
+	value := []byte{0xef, 0xbe, 0xad, 0xde}
+	pte := "{ present: 1 writable: 1 user: 0 reserved: 341 frame: 74565 available: 2047 nx: -1 }"
+	ring := "{ version: 3 delta: -2 count: -100 state: STATE_RUNNING (2) busy: true id: 42 }"
+	reg := "{ raw : 3735928559 low : 48879 }"
+
+	//DWARF 5 gives the offset of the bits from the start of the struct and
+	//DWARF 4 from the most significant bit of the unit they're stored in
+	files := map[string][]val{
+		"./testfiles/bitfields": []val{
+			val{offset: 0x0000005a, data: entry, expected: pte},
+			val{offset: 0x000000d1, data: header, expected: ring},
+			val{offset: 0x00000148, data: value, expected: reg},
+		},
+		"./testfiles/bitfields_dwarf4": []val{
+			val{offset: 0x00000059, data: entry, expected: pte},
+			val{offset: 0x000000e4, data: header, expected: ring},
+			val{offset: 0x0000016a, data: value, expected: reg},
+		},
+	}
+	for filename, tests := range files {
+		reader := setup(filename, t)
+		var manager TypeManager
+		manager.Endianess = binary.LittleEndian
+		for entry, _ := reader.Next(); entry != nil; entry, _ = reader.Next() {
+			err := manager.ParseDwarfEntry(entry)
+			if err != nil {
+				t.Fatalf(err.Error())
+			}
+		}
+		for _, v := range tests {
+			str, err := manager.ParseBytes(v.offset, v.data)
+			if err != nil || str != v.expected {
+				t.Errorf("Expected %s but got %s in %s (%v)", v.expected, str, filename, err)
+			}
+		}
+	}
+}
+
+func TestBitfieldBigEndian(t *testing.T) {
+	//A 3 bit field starting 6 bits into the first byte spills into the second
+	attr := &Attribute{FieldName: "mode", base: &BaseType{size: 4, Encoding: Sinteger, Name: "int"}, BitSize: 3, BitOffset: 6}
+	bytes := attr.extract([]byte{0x02, 0x80}, binary.BigEndian)
+	if value := int32(binary.BigEndian.Uint32(bytes)); value != -3 {
+		t.Errorf("Expected the big endian bitfield to be -3 not %d", value)
+	}
+	bytes = attr.extract([]byte{0x80, 0x02}, binary.LittleEndian)
+	if value := int32(binary.LittleEndian.Uint32(bytes)); value != 2 {
+		t.Errorf("Expected the little endian bitfield to be 2 not %d", value)
+	}
+}
@@ -0,0 +1,161 @@
+package file
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/StardustOS/duster/debugger"
+)
+
+//cName - returns the name of a type as it is written in C
+func cName(t Type) string {
+	switch t := t.(type) {
+	case nil:
+		return "void"
+	case *BaseType:
+		return t.Name
+	case *TypeDef:
+		return t.Name
+	case *Struct:
+		return "struct " + t.Name
+	case *Union:
+		return "union " + t.Name
+	case *Enum:
+		if t.Name == "" {
+			return "enum {...}"
+		}
+		return "enum " + t.Name
+	case *ConstType:
+		return "const " + cName(t.t)
+	case *VolatileType:
+		return "volatile " + cName(t.t)
+	case *Pointer:
+		name := cName(t.typeOfPointer)
+		if strings.HasSuffix(name, "*") {
+			return name + "*"
+		}
+		return name + " *"
+	case *Array:
+		return fmt.Sprintf("%s [%d]", cName(t.typeArray), t.Length())
+	}
+	return "?"
+}
+
+//valueKind - returns the kind of value a type holds
+func valueKind(t Type) debugger.ValueKind {
+	switch t := resolve(t).(type) {
+	case *BaseType:
+		switch t.Encoding {
+		case Float:
+			return debugger.FloatValue
+		case Boolean:
+			return debugger.BoolValue
+		case Schar, Uchar:
+			return debugger.CharValue
+		case Sinteger:
+			return debugger.SignedValue
+		}
+	case *Pointer:
+		return debugger.PointerValue
+	case *Struct:
+		return debugger.StructValue
+	case *Union:
+		return debugger.UnionValue
+	case *Array:
+		return debugger.ArrayValue
+	case *Enum:
+		return debugger.EnumValue
+	}
+	return debugger.UnsignedValue
+}
+
+//tree - turns the value of an expression into a Value named name. The bytes of
+//structs, unions and arrays are read once and split between their children.
+func (eval *evaluator) tree(name string, v *value) (*debugger.Value, error) {
+	if v.t == nil {
+		return nil, fmt.Errorf("Error: %s has type void", name)
+	}
+	bytes, err := eval.load(v)
+	if err != nil {
+		return nil, err
+	} else if len(bytes) != v.t.Size() {
+		return nil, fmt.Errorf("Error: %s should be %d bytes but got %d", name, v.t.Size(), len(bytes))
+	}
+
+	result := &debugger.Value{Name: name, Kind: valueKind(v.t), Type: cName(v.t), Address: v.address, InMemory: v.inMemory, Bytes: bytes, Endianess: eval.endianess}
+	var children []*value
+	var names []string
+	switch t := resolve(v.t).(type) {
+	case *Pointer:
+		result.SetTarget(func() (*debugger.Value, error) {
+			return eval.target(name, v)
+		})
+		result.SetMemory(eval.memory)
+	case *Enum:
+		result.SetEnum(t.Symbol(t.integer(bytes, eval.endianess)), t.signed)
+	case *Struct:
+		names, children = eval.members(v, t.attributes)
+	case *Union:
+		names, children = eval.members(v, t.attributes)
+	case *Array:
+		for i := 0; i < t.Length(); i++ {
+			element, err := eval.dereference(v, int64(i))
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, fmt.Sprintf("[%d]", i))
+			children = append(children, element)
+		}
+	}
+
+	for i, child := range children {
+		//The children have already been read with their parent
+		if child.bytes == nil {
+			child.bytes = bytes[child.address-v.address : child.address-v.address+uint64(child.t.Size())]
+		}
+		childValue, err := eval.tree(names[i], child)
+		if err != nil {
+			return nil, err
+		}
+		result.Children = append(result.Children, childValue)
+	}
+	return result, nil
+}
+
+//members - returns the names and values of the members of a struct or union
+//(the bytes of the struct or union must have been loaded)
+func (eval *evaluator) members(v *value, attributes []*Attribute) ([]string, []*value) {
+	var names []string
+	var members []*value
+	for _, attribute := range attributes {
+		if attribute.base == nil {
+			continue
+		}
+		member := &value{t: attribute.base, address: v.address + uint64(attribute.Offset), inMemory: v.inMemory}
+		if attribute.BitSize > 0 {
+			//Bitfields have no address of their own
+			member = &value{t: attribute.base, bytes: attribute.field(v.bytes, eval.endianess)}
+		} else if !v.inMemory {
+			member.bytes = v.bytes[attribute.Offset : attribute.Offset+attribute.base.Size()]
+		}
+		names = append(names, attribute.FieldName)
+		members = append(members, member)
+	}
+	return names, members
+}
+
+//target - returns the value a pointer points to
+func (eval *evaluator) target(name string, pointer *value) (*debugger.Value, error) {
+	address, err := eval.scalar(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if address.i == 0 {
+		return nil, fmt.Errorf("Error: %s is a null pointer", name)
+	}
+	pointee, err := eval.dereference(pointer, 0)
+	if err != nil {
+		return nil, err
+	}
+	return eval.tree("*"+name, pointee)
+}
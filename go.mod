@@ -10,4 +10,5 @@ require (
 	github.com/mattn/go-tty v0.0.3 // indirect
 	github.com/pkg/term v0.0.0-20190109203006-aa71e9d9e942 // indirect
 	github.com/stretchr/testify v1.5.1
+	golang.org/x/arch v0.0.0-20190927153633-4e8777c89be4
 )
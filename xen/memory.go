@@ -326,6 +326,17 @@ func (mem *Memory) UnMap(address uint64) error {
 	return nil
 }
 
+//UnMapAll - unmaps all of the memory of the VM that has been mapped
+func (mem *Memory) UnMapAll() error {
+	for len(mem.maps) > 0 {
+		err := mem.UnMap(mem.maps[0].StartingAddress())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 //Read memory from the VM uses the interface set out by the debugger
 func (mem *Memory) Read(address uint64, size uint) ([]byte, error) {
 	memoryMap, index := mem.getMap(address)
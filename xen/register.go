@@ -105,6 +105,12 @@ func (register *Register) convertC() C.struct_Regs {
 	regs.R14 = C.ulong(register.registers["r14"])
 	regs.R15 = C.ulong(register.registers["r15"])
 	regs.Rflags = C.ulong(register.registers["rflags"])
+	regs.Dr0 = C.ulong(register.registers["dr0"])
+	regs.Dr1 = C.ulong(register.registers["dr1"])
+	regs.Dr2 = C.ulong(register.registers["dr2"])
+	regs.Dr3 = C.ulong(register.registers["dr3"])
+	regs.Dr6 = C.ulong(register.registers["dr6"])
+	regs.Dr7 = C.ulong(register.registers["dr7"])
 	return regs
 }
 
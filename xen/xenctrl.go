@@ -42,6 +42,13 @@ struct Regs {
 	uint64_t ss;
 	uint64_t es;
 	uint64_t cs;
+	uint64_t Xmm0;
+	uint64_t Dr0;
+	uint64_t Dr1;
+	uint64_t Dr2;
+	uint64_t Dr3;
+	uint64_t Dr6;
+	uint64_t Dr7;
 };
 
 // We need these helper functions (i.e. we can't xc_vcpu_get/setcontext directly in go). This is because
@@ -83,6 +90,17 @@ int getRegister(xc_interface* key, uint32_t domainid, uint32_t vcpu, struct Regs
 	buffer->es = context.x64.user_regs.es;
 	buffer->cs = context.x64.user_regs.cs;
 	buffer->Rip = context.x64.user_regs.rip;
+	// The FPU context is stored in the FXSAVE format where the
+	// XMM registers start at byte 160 (we only need the low 64 bits
+	// of xmm0 for floating point return values)
+	memcpy(&buffer->Xmm0, &context.x64.fpu_ctxt.x[160], sizeof(uint64_t));
+	// Debug registers (DR4 and DR5 are aliases of DR6 and DR7)
+	buffer->Dr0 = context.x64.debugreg[0];
+	buffer->Dr1 = context.x64.debugreg[1];
+	buffer->Dr2 = context.x64.debugreg[2];
+	buffer->Dr3 = context.x64.debugreg[3];
+	buffer->Dr6 = context.x64.debugreg[6];
+	buffer->Dr7 = context.x64.debugreg[7];
 
 	return 0;
 }
@@ -119,6 +137,12 @@ int setRegister(xc_interface* key, struct Regs regs, uint32_t domainid, uint32_t
 	// context.x64.user_regs.es = regs.es;
 	// context.x64.user_regs.cs = regs.cs;
 	context.x64.user_regs.rip = regs.Rip;
+	context.x64.debugreg[0] = regs.Dr0;
+	context.x64.debugreg[1] = regs.Dr1;
+	context.x64.debugreg[2] = regs.Dr2;
+	context.x64.debugreg[3] = regs.Dr3;
+	context.x64.debugreg[6] = regs.Dr6;
+	context.x64.debugreg[7] = regs.Dr7;
 	//printf("FROM C: %lu\n", context.x64.user_regs.rflags);
 	//xc_vcpu_getcontext(key, domainid, vcpu, &context);
 	//printf("FROM C: %lu\n", context.x64.user_regs.rflags);
@@ -144,11 +168,59 @@ int is_paused(xc_interface *xch, uint32_t domaind) {
 	}
 	return info.paused;
 }
+
+// Capitalised for the same reason as Regs
+struct DomainState {
+	int Paused;
+	int Shutdown;
+	int Crashed;
+	int Destroyed;
+	unsigned int Reason;
+};
+
+int domain_state(xc_interface *xch, uint32_t domainid, struct DomainState *state) {
+	xc_dominfo_t info;
+	int no = xc_domain_getinfo(xch, domainid, 1, &info);
+	if (no == -1) {
+		puts(xc_strerror(xch, errno));
+		return -1;
+	}
+	// xc_domain_getinfo returns the next domain along once ours has gone
+	if (no == 0 || info.domid != domainid) {
+		state->Destroyed = 1;
+		return 0;
+	}
+	state->Paused = info.paused;
+	state->Shutdown = info.shutdown;
+	state->Crashed = info.crashed;
+	state->Reason = info.shutdown_reason;
+	return 0;
+}
+
+int domain_vcpus(xc_interface *xch, uint32_t domainid) {
+	xc_dominfo_t info;
+	int no = xc_domain_getinfo(xch, domainid, 1, &info);
+	if (no != 1 || info.domid != domainid) {
+		return -1;
+	}
+	return info.max_vcpu_id + 1;
+}
 */
 import "C"
 
 import (
+	"context"
 	"errors"
+	"time"
+)
+
+//A breakpoint is normally hit within microseconds of unpausing the domain, so
+//WaitForStop polls straight away a few times before backing off to sleeping
+//between polls (doubling the sleep each time up to maximumPollInterval)
+const (
+	spinPolls           = 100
+	minimumPollInterval = 50 * time.Microsecond
+	maximumPollInterval = 20 * time.Millisecond
 )
 
 type Uint64 C.ulong
@@ -174,6 +246,65 @@ func (control *Xenctrl) IsPaused() bool {
 	}
 }
 
+//State returns whether the domain is paused, has shut down (and why) or has crashed
+func (control *Xenctrl) State() (debugger.DomainState, error) {
+	var state C.struct_DomainState
+	err := C.domain_state(control.key, C.uint32_t(control.DomainID), &state)
+	if err != 0 {
+		return debugger.DomainState{}, errors.New("Error: could not get the state of the domain")
+	}
+	return debugger.DomainState{
+		Paused:    state.Paused != 0,
+		Shutdown:  state.Shutdown != 0,
+		Reason:    int(state.Reason),
+		Crashed:   state.Crashed != 0,
+		Destroyed: state.Destroyed != 0,
+	}, nil
+}
+
+//VCPUs returns the number of vcpus the domain has
+func (control *Xenctrl) VCPUs() (uint32, error) {
+	vcpus := C.domain_vcpus(control.key, C.uint32_t(control.DomainID))
+	if vcpus < 0 {
+		return 0, errors.New("Error: could not get the number of vcpus of the domain")
+	}
+	return uint32(vcpus), nil
+}
+
+//WaitForStop blocks until the domain is paused (e.g. by hitting a breakpoint),
+//shuts down or crashes and returns its state. Returns the error of the context
+//if it is cancelled first (the domain is left running).
+func (control *Xenctrl) WaitForStop(ctx context.Context) (debugger.DomainState, error) {
+	interval := minimumPollInterval
+	for polls := 0; ; polls += 1 {
+		state, err := control.State()
+		if err != nil {
+			return state, err
+		}
+		if state.Paused || state.Shutdown || state.Crashed || state.Destroyed {
+			return state, nil
+		}
+
+		if polls < spinPolls {
+			if ctx.Err() != nil {
+				return debugger.DomainState{}, ctx.Err()
+			}
+			continue
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return debugger.DomainState{}, ctx.Err()
+		case <-timer.C:
+		}
+		if interval < maximumPollInterval {
+			interval *= 2
+		}
+	}
+}
+
 //Close destories the handler required to access 
 //Xen control API
 func (control *Xenctrl) Close() error {
@@ -244,6 +375,13 @@ func (control *Xenctrl) GetRegisters(vcpu uint32) (debugger.Registers, error) {
 	register.SetRegister("r14", uint64(context.R14))
 	register.SetRegister("r15", uint64(context.R15))
 	register.SetRegister("rflags", uint64(context.Rflags))
+	register.SetRegister("xmm0", uint64(context.Xmm0))
+	register.SetRegister("dr0", uint64(context.Dr0))
+	register.SetRegister("dr1", uint64(context.Dr1))
+	register.SetRegister("dr2", uint64(context.Dr2))
+	register.SetRegister("dr3", uint64(context.Dr3))
+	register.SetRegister("dr6", uint64(context.Dr6))
+	register.SetRegister("dr7", uint64(context.Dr7))
 	return register, nil
 }
 